@@ -29,6 +29,7 @@ install -p -m 755 ./_output/bin/lighthouse $RPM_BUILD_ROOT/%{_bindir}/lighthouse
 install -p -m 644 ./build/config $RPM_BUILD_ROOT/etc/lighthouse/config
 install -p -m 644 ./build/config.yaml $RPM_BUILD_ROOT/etc/lighthouse/config.yaml
 install -p -m 644 ./build/lighthouse.service $RPM_BUILD_ROOT/%{_unitdir}/
+install -p -m 644 ./build/lighthouse.socket $RPM_BUILD_ROOT/%{_unitdir}/
 
 %clean
 rm -rf $RPM_BUILD_ROOT
@@ -38,5 +39,6 @@ rm -rf $RPM_BUILD_ROOT
 %config(noreplace,missingok) /etc/lighthouse/config.yaml
 
 /%{_unitdir}/lighthouse.service
+/%{_unitdir}/lighthouse.socket
 
 /%{_bindir}/lighthouse
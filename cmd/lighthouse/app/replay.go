@@ -0,0 +1,209 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+	"github.com/mYmNeo/lighthouse/pkg/record"
+)
+
+type ReplayOptions struct {
+	*Options
+	RequestsFile      string
+	BackendAPIVersion string
+}
+
+func NewReplayCommand() *cobra.Command {
+	opts := &ReplayOptions{Options: NewOptions()}
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Apply the hooks of a configuration to captured requests",
+		Long: "Replay applies the hooks of a configuration to the requests of a fixture recorded by --record, and prints" +
+			" the decision of each hook and the diff of the bodies. Post hooks get the recorded response of Docker if" +
+			" there is one. No listener is started and no request is sent to Docker. The webhooks are called, except the" +
+			" side effect only and async ones",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := opts.Complete(); err != nil {
+				klog.Fatalf("failed complete: %v", err)
+			}
+
+			if err := opts.Run(os.Stdout); err != nil {
+				klog.Exit(err)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (o *ReplayOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "The path to the configuration file")
+	fs.StringVar(&o.RequestsFile, "requests", o.RequestsFile, "The path to the fixture file of the captured requests")
+	fs.StringVar(&o.BackendAPIVersion, "backend-api-version", o.BackendAPIVersion,
+		"The API version of the Docker the requests are captured from, it's required by API translation")
+}
+
+func (o *ReplayOptions) Run(out io.Writer) error {
+	if len(o.RequestsFile) == 0 {
+		return fmt.Errorf("--requests is required")
+	}
+
+	f, err := os.Open(o.RequestsFile)
+	if err != nil {
+		return fmt.Errorf("can't open requests file %q, %v", o.RequestsFile, err)
+	}
+	defer f.Close()
+
+	exchanges, err := record.LoadFixture(f)
+	if err != nil {
+		return fmt.Errorf("can't load requests file %q, %v", o.RequestsFile, err)
+	}
+
+	// Docker is not called, so /version can't tell the API version to translate to
+	if len(o.BackendAPIVersion) > 0 {
+		o.config.APITranslation.BackendAPIVersion = o.BackendAPIVersion
+	}
+	if o.config.APITranslation.Enabled && len(o.config.APITranslation.BackendAPIVersion) == 0 {
+		return fmt.Errorf("--backend-api-version is required by API translation")
+	}
+
+	hm := hook.NewManager(hook.WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("no backend in replay"))
+	})), hook.WithSystemd(false))
+	if err := hm.InitFromConfig(o.config); err != nil {
+		return err
+	}
+
+	for _, ex := range exchanges {
+		result := hm.Replay(&hook.ReplayRequest{
+			Method:            ex.Method,
+			URI:               ex.URI,
+			Body:              []byte(ex.Body),
+			BackendStatusCode: ex.BackendStatusCode,
+			BackendBody:       []byte(ex.BackendBody),
+		})
+		printReplayResult(out, &ex, result)
+	}
+
+	return nil
+}
+
+func printReplayResult(out io.Writer, ex *record.Exchange, result *hook.ReplayResult) {
+	fmt.Fprintf(out, "=== %s %s\n", ex.Method, ex.URI)
+	if len(result.Decisions) == 0 {
+		fmt.Fprintf(out, "no hook\n")
+	}
+
+	for _, d := range result.Decisions {
+		fmt.Fprintf(out, "%s %s %s", d.HookType, d.Hook, d.Decision)
+		if len(d.Changed) > 0 {
+			fmt.Fprintf(out, " %s", strings.Join(d.Changed, " "))
+		}
+		if len(d.Message) > 0 {
+			fmt.Fprintf(out, ": %s", d.Message)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if result.Rejected {
+		fmt.Fprintf(out, "rejected with %d: %s\n\n", result.StatusCode, result.ResponseBody)
+		return
+	}
+	printBodyDiff(out, "request body", ex.Body, string(result.Body))
+
+	if result.StatusCode == 0 {
+		fmt.Fprintln(out)
+		return
+	}
+
+	if result.StatusCode != ex.BackendStatusCode {
+		fmt.Fprintf(out, "response status code: %d -> %d\n", ex.BackendStatusCode, result.StatusCode)
+	}
+	printBodyDiff(out, "response body", ex.BackendBody, string(result.ResponseBody))
+	fmt.Fprintln(out)
+}
+
+// printBodyDiff prints the line diff of the bodies, JSON bodies are indented before compared
+func printBodyDiff(out io.Writer, name, before, after string) {
+	if before == after {
+		fmt.Fprintf(out, "%s unchanged\n", name)
+		return
+	}
+
+	fmt.Fprintf(out, "%s:\n", name)
+	for _, l := range diffLines(splitBody(before), splitBody(after)) {
+		fmt.Fprintln(out, l)
+	}
+}
+
+func splitBody(body string) []string {
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, []byte(body), "", "  "); err == nil {
+		body = indented.String()
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+}
+
+// diffLines returns the lines of a and b prefixed by " ", "-" or "+" based on their longest common subsequence
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ret := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ret = append(ret, "-"+a[i])
+			i++
+		default:
+			ret = append(ret, "+"+b[j])
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		ret = append(ret, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		ret = append(ret, "+"+b[j])
+	}
+
+	return ret
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"github.com/mYmNeo/version/verflag"
 	"github.com/spf13/cobra"
@@ -15,11 +16,13 @@ import (
 	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig/v1alpha1"
 	"github.com/mYmNeo/lighthouse/pkg/hook"
 	"github.com/mYmNeo/lighthouse/pkg/lighthouse/scheme"
+	"github.com/mYmNeo/lighthouse/pkg/record"
 	"github.com/mYmNeo/lighthouse/pkg/util"
 )
 
 type Options struct {
 	ConfigFile string
+	RecordFile string
 	config     *componentconfig.HookConfiguration
 }
 
@@ -45,6 +48,7 @@ func NewLighthouseCommand() *cobra.Command {
 	}
 
 	opts.AddFlags(cmd.Flags())
+	cmd.AddCommand(NewReplayCommand())
 
 	return cmd
 }
@@ -56,7 +60,20 @@ func NewOptions() *Options {
 }
 
 func (o *Options) Run() error {
-	hookServer := hook.NewHookManager()
+	var opts []hook.Option
+	if len(o.RecordFile) > 0 {
+		f, err := os.OpenFile(o.RecordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("can't open record file %q, %v", o.RecordFile, err)
+		}
+		defer f.Close()
+
+		klog.Infof("Record requests to %s", o.RecordFile)
+		recorder := record.NewRecorder(f)
+		opts = append(opts, hook.WithMiddleware(recorder.Client), hook.WithBackendMiddleware(recorder.Backend))
+	}
+
+	hookServer := hook.NewManager(opts...)
 
 	if err := hookServer.InitFromConfig(o.config); err != nil {
 		return err
@@ -67,6 +84,8 @@ func (o *Options) Run() error {
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "The path to the configuration file")
+	fs.StringVar(&o.RecordFile, "record", o.RecordFile, "The path to the fixture file which the requests and the "+
+		"responses passing through lighthouse are appended to")
 }
 
 func (o *Options) Complete() error {
@@ -11,6 +11,10 @@ import (
 	"k8s.io/component-base/logs"
 
 	"github.com/mYmNeo/lighthouse/cmd/lighthouse/app"
+	// builtin hooks available to the configuration
+	_ "github.com/mYmNeo/lighthouse/pkg/builtin/envinject"
+	_ "github.com/mYmNeo/lighthouse/pkg/builtin/imagerewrite"
+	_ "github.com/mYmNeo/lighthouse/pkg/builtin/runtimeselect"
 )
 
 func main() {
@@ -8,12 +8,15 @@ require (
 	github.com/docker/docker v0.7.3-0.20190327010347-be7ac8be2ae0 // indirect
 	github.com/docker/go-connections v0.4.0
 	github.com/evanphx/json-patch v4.2.0+incompatible
+	github.com/golang/protobuf v1.3.2
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/mux v1.7.0
 	github.com/json-iterator/go v1.1.8
 	github.com/mYmNeo/version v0.0.0-20200424030557-30e59e77cc3e
+	github.com/prometheus/client_golang v1.0.0
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
+	google.golang.org/grpc v1.27.0
 	k8s.io/apimachinery v0.17.4
 	k8s.io/code-generator v0.17.4
 	k8s.io/component-base v0.17.4
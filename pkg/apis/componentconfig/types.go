@@ -4,6 +4,7 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -12,25 +13,92 @@ type HookConfiguration struct {
 	metav1.TypeMeta
 	Timeout        time.Duration
 	ListenAddress  string
+	SocketMode     string
+	SocketOwner    string
 	RemoteEndpoint string
+	AdminAddress   string
+	AsyncWorkers   int
+	AsyncQueueSize int
+	APITranslation APITranslationConfiguration
+	Inventory      InventoryConfiguration
+	Tracing        TracingConfiguration
+	Listeners      ListenerConfigurationList
 	WebHooks       HookConfigurationList
 }
 
+type APITranslationConfiguration struct {
+	Enabled             bool
+	CanonicalAPIVersion string
+	BackendAPIVersion   string
+}
+
+type InventoryConfiguration struct {
+	Enabled   bool
+	StateFile string
+}
+
+type TracingConfiguration struct {
+	Exporter    TracingExporterType
+	Endpoint    string
+	Path        string
+	ServiceName string
+}
+
+type ListenerConfigurationList []ListenerConfiguration
+
+type ListenerConfiguration struct {
+	Name        string
+	Address     string
+	SocketMode  string
+	SocketOwner string
+	ReadOnly    bool
+	WebHooks    []string
+}
+
 type HookConfigurationList []HookConfigurationItem
 
 type HookConfigurationItem struct {
-	Name          string
-	Endpoint      string
-	FailurePolicy FailurePolicyType
-	Stages        HookStageList
+	Name            string
+	Type            WebHookType
+	Builtin         string
+	Options         runtime.RawExtension
+	Endpoint        string
+	FailurePolicy   FailurePolicyType
+	Priority        int
+	HealthPath      string
+	SideEffectOnly  bool
+	Async           bool
+	SandboxAware    bool
+	Protocol        ProtocolType
+	MaxInFlight     int
+	MaxQueueLength  int
+	QueueTimeout    metav1.Duration
+	Cache           HookCacheConfiguration
+	PostHookHeaders PostHookHeadersConfiguration
+	Stages          HookStageList
+}
+
+type HookCacheConfiguration struct {
+	TTL        metav1.Duration
+	MaxEntries int
+}
+
+type PostHookHeadersConfiguration struct {
+	Enabled bool
+	MaxSize int
 }
 
 type HookStageList []HookStage
 
 type HookStage struct {
-	Method     string
-	URLPattern string
-	Type       HookType
+	Method              string
+	URLPattern          string
+	Type                HookType
+	MinAPIVersion       string
+	MaxAPIVersion       string
+	ConflictPolicy      ConflictPolicyType
+	MaxRequestBodySize  int64
+	MaxResponseBodySize int64
 }
 
 type FailurePolicyType string
@@ -40,6 +108,38 @@ const (
 	PolicyIgnore FailurePolicyType = "Ignore"
 )
 
+type WebHookType string
+
+const (
+	RemoteWebHook  WebHookType = "remote"
+	BuiltinWebHook WebHookType = "builtin"
+)
+
+type ProtocolType string
+
+const (
+	ProtocolV1   ProtocolType = "v1"
+	ProtocolV2   ProtocolType = "v2"
+	ProtocolGRPC ProtocolType = "grpc"
+)
+
+type TracingExporterType string
+
+const (
+	TracingExporterNone   TracingExporterType = ""
+	TracingExporterOTLP   TracingExporterType = "otlp"
+	TracingExporterStdout TracingExporterType = "stdout"
+	TracingExporterFile   TracingExporterType = "file"
+)
+
+type ConflictPolicyType string
+
+const (
+	ConflictLastWins ConflictPolicyType = "LastWins"
+	ConflictWarn     ConflictPolicyType = "Warn"
+	ConflictFail     ConflictPolicyType = "Fail"
+)
+
 type HookType string
 
 const (
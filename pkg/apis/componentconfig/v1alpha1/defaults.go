@@ -18,16 +18,56 @@ func SetDefaults_HookConfiguration(obj *HookConfiguration) {
 	if obj.RemoteEndpoint == "" {
 		obj.RemoteEndpoint = "unix:///var/run/docker.sock"
 	}
+
+	if obj.AsyncWorkers == 0 {
+		obj.AsyncWorkers = 4
+	}
+
+	if obj.AsyncQueueSize == 0 {
+		obj.AsyncQueueSize = 1024
+	}
+
+	if obj.APITranslation.CanonicalAPIVersion == "" {
+		obj.APITranslation.CanonicalAPIVersion = "1.44"
+	}
+
+	if obj.Tracing.ServiceName == "" {
+		obj.Tracing.ServiceName = "lighthouse"
+	}
+
+	if obj.Tracing.Exporter == TracingExporterOTLP && obj.Tracing.Endpoint == "" {
+		obj.Tracing.Endpoint = "http://127.0.0.1:4318"
+	}
 }
 
 func SetDefaults_HookConfigurationItem(obj *HookConfigurationItem) {
 	if obj.FailurePolicy == "" {
 		obj.FailurePolicy = PolicyFail
 	}
+
+	if obj.Type == "" {
+		obj.Type = RemoteWebHook
+	}
+
+	if obj.Protocol == "" {
+		obj.Protocol = ProtocolV1
+	}
+
+	if obj.Cache.TTL.Duration > 0 && obj.Cache.MaxEntries == 0 {
+		obj.Cache.MaxEntries = 1024
+	}
+
+	if obj.PostHookHeaders.Enabled && obj.PostHookHeaders.MaxSize == 0 {
+		obj.PostHookHeaders.MaxSize = 4096
+	}
 }
 
 func SetDefaults_HookStage(obj *HookStage) {
 	if obj.Method == "" {
 		obj.Method = http.MethodPost
 	}
+
+	if obj.ConflictPolicy == "" {
+		obj.ConflictPolicy = ConflictLastWins
+	}
 }
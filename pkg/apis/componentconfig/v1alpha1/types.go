@@ -4,25 +4,128 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type HookConfiguration struct {
 	metav1.TypeMeta `json:",inline"`
-	Timeout         time.Duration         `json:"timeout,omitempty"`
-	ListenAddress   string                `json:"listenAddress,omitempty"`
-	RemoteEndpoint  string                `json:"remoteEndpoint,omitempty"`
-	WebHooks        HookConfigurationList `json:"webhooks,omitempty"`
+	Timeout         time.Duration `json:"timeout,omitempty"`
+	ListenAddress   string        `json:"listenAddress,omitempty"`
+	SocketMode      string        `json:"socketMode,omitempty"`
+	SocketOwner     string        `json:"socketOwner,omitempty"`
+	RemoteEndpoint  string        `json:"remoteEndpoint,omitempty"`
+	AdminAddress    string        `json:"adminAddress,omitempty"`
+	// AsyncWorkers is the number of workers running async hooks
+	AsyncWorkers int `json:"asyncWorkers,omitempty"`
+	// AsyncQueueSize is the max number of async hooks waiting for a worker
+	AsyncQueueSize int `json:"asyncQueueSize,omitempty"`
+	// APITranslation converts the bodies of create and inspect requests, so hooks always see one API version
+	APITranslation APITranslationConfiguration `json:"apiTranslation,omitempty"`
+	// Inventory tracks the containers created through lighthouse, so hooks of the requests with a container ID get
+	// the labels of the container
+	Inventory InventoryConfiguration `json:"inventory,omitempty"`
+	// Tracing exports the spans of the requests and the hooks, it's disabled if the exporter is empty
+	Tracing   TracingConfiguration      `json:"tracing,omitempty"`
+	Listeners ListenerConfigurationList `json:"listeners,omitempty"`
+	WebHooks  HookConfigurationList     `json:"webhooks,omitempty"`
+}
+
+type APITranslationConfiguration struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// CanonicalAPIVersion is the Docker API version seen by hooks
+	CanonicalAPIVersion string `json:"canonicalAPIVersion,omitempty"`
+	// BackendAPIVersion is the Docker API version of the backend, it's queried from /version if it's empty
+	BackendAPIVersion string `json:"backendAPIVersion,omitempty"`
+}
+
+type InventoryConfiguration struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// StateFile persists the inventory across restarts, the inventory is only kept in memory if it's empty
+	StateFile string `json:"stateFile,omitempty"`
+}
+
+type TracingConfiguration struct {
+	Exporter TracingExporterType `json:"exporter,omitempty"`
+	// Endpoint is the OTLP/HTTP endpoint of the collector, e.g. http://127.0.0.1:4318
+	Endpoint string `json:"endpoint,omitempty"`
+	// Path is the file the spans are appended to by the file exporter
+	Path string `json:"path,omitempty"`
+	// ServiceName is the service.name of the spans, lighthouse by default
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+type ListenerConfigurationList []ListenerConfiguration
+
+type ListenerConfiguration struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address,omitempty"`
+	// SocketMode is the octal permission of a unix socket, e.g. "0660"
+	SocketMode string `json:"socketMode,omitempty"`
+	// SocketOwner is the "user[:group]" owning a unix socket, e.g. "root:docker"
+	SocketOwner string `json:"socketOwner,omitempty"`
+	// ReadOnly only allows the requests reading the state of the backend, which excludes attaching to containers and
+	// copying files out of containers or images
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// WebHooks is the names of webhooks served on this listener, all webhooks are served if it's empty
+	WebHooks []string `json:"webhooks,omitempty"`
 }
 
 type HookConfigurationList []HookConfigurationItem
 
 type HookConfigurationItem struct {
-	Name          string            `json:"name,omitempty"`
-	Endpoint      string            `json:"endpoint,omitempty"`
-	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty"`
-	Stages        HookStageList     `json:"stages,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Type is remote for a hook server behind endpoint, or builtin for a hook registered by hook.RegisterBuiltin
+	Type WebHookType `json:"type,omitempty"`
+	// Builtin is the registered name of a builtin hook
+	Builtin string `json:"builtin,omitempty"`
+	// Options is passed to the factory of a builtin hook as is
+	Options       runtime.RawExtension `json:"options,omitempty"`
+	Endpoint      string               `json:"endpoint,omitempty"`
+	FailurePolicy FailurePolicyType    `json:"failurePolicy,omitempty"`
+	// Priority orders the hooks matching a request, a hook with a higher priority runs earlier, hooks with the same
+	// priority run in the order of configuration
+	Priority int `json:"priority,omitempty"`
+	// HealthPath is requested to check the readiness of a hook, a connection is made if it's empty
+	HealthPath string `json:"healthPath,omitempty"`
+	// SideEffectOnly hooks run concurrently and never patch the body
+	SideEffectOnly bool `json:"sideEffectOnly,omitempty"`
+	// Async hooks are side effect only, and they are queued without blocking the request
+	Async bool `json:"async,omitempty"`
+	// SandboxAware hooks patch the pod sandbox and the app containers of kubelet with the same rule, the pod level
+	// fields of a patch are only applied to the sandbox, the other fields only to the app containers
+	SandboxAware bool `json:"sandboxAware,omitempty"`
+	// Protocol is the wire protocol of the webhook, v1 by default. v2 sends the raw body with metadata in headers, and
+	// expects a raw patch. grpc calls the Hook service of pkg/hook/hookpb
+	Protocol ProtocolType `json:"protocol,omitempty"`
+	// MaxInFlight is the max number of concurrent calls of the webhook, it's unlimited if it's 0
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+	// MaxQueueLength is the max number of calls waiting for MaxInFlight, a call exceeding it fails at once
+	MaxQueueLength int `json:"maxQueueLength,omitempty"`
+	// QueueTimeout is the max time a call waits in the queue, the call waits until the hook timeout if it's 0
+	QueueTimeout metav1.Duration `json:"queueTimeout,omitempty"`
+	// Cache keeps the answers of a hook which is a pure function of the request, it's disabled if the TTL is 0
+	Cache HookCacheConfiguration `json:"cache,omitempty"`
+	// PostHookHeaders sends the request bodies and the hook state to the post hooks of protocol v2 in headers, they
+	// are not sent by default because the bodies may exceed the header limits of the hook server
+	PostHookHeaders PostHookHeadersConfiguration `json:"postHookHeaders,omitempty"`
+	Stages          HookStageList                `json:"stages,omitempty"`
+}
+
+type HookCacheConfiguration struct {
+	// TTL is how long an answer is kept
+	TTL metav1.Duration `json:"ttl,omitempty"`
+	// MaxEntries is the max number of answers kept, the least recently used one is evicted. It's 1024 by default
+	MaxEntries int `json:"maxEntries,omitempty"`
+}
+
+type PostHookHeadersConfiguration struct {
+	// Enabled sends X-Lighthouse-Original-Request, X-Lighthouse-Request and X-Lighthouse-Hook-State
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxSize is the max bytes of each header after base64 encoding, a larger header is not sent. It's 4096 by
+	// default
+	MaxSize int `json:"maxSize,omitempty"`
 }
 
 type HookStageList []HookStage
@@ -31,6 +134,17 @@ type HookStage struct {
 	Method     string `json:"method,omitempty"`
 	URLPattern string `json:"urlPattern,omitempty"`
 	Type       string `json:"type,omitempty"`
+	// MinAPIVersion and MaxAPIVersion limit the Docker API versions of the requests, e.g. "1.40"
+	MinAPIVersion string `json:"minAPIVersion,omitempty"`
+	MaxAPIVersion string `json:"maxAPIVersion,omitempty"`
+	// ConflictPolicy decides what happens when a hook changes a field set by an earlier hook of the same chain, the
+	// strictest policy of the matched stages is used
+	ConflictPolicy ConflictPolicyType `json:"conflictPolicy,omitempty"`
+	// MaxRequestBodySize and MaxResponseBodySize are the max bytes of the bodies buffered for the hooks, the smallest
+	// limit of the matched stages is used. A request exceeding them fails with 413, or bypasses the hooks if all the
+	// hooks bypassed have failure policy Ignore. They are unlimited if they are 0
+	MaxRequestBodySize  int64 `json:"maxRequestBodySize,omitempty"`
+	MaxResponseBodySize int64 `json:"maxResponseBodySize,omitempty"`
 }
 
 type FailurePolicyType string
@@ -40,6 +154,41 @@ const (
 	PolicyIgnore FailurePolicyType = "Ignore"
 )
 
+type WebHookType string
+
+const (
+	RemoteWebHook  WebHookType = "remote"
+	BuiltinWebHook WebHookType = "builtin"
+)
+
+type ProtocolType string
+
+const (
+	ProtocolV1 ProtocolType = "v1"
+	ProtocolV2 ProtocolType = "v2"
+	// ProtocolGRPC calls the Hook service defined in pkg/hook/hookpb
+	ProtocolGRPC ProtocolType = "grpc"
+)
+
+type TracingExporterType string
+
+const (
+	TracingExporterNone TracingExporterType = ""
+	// TracingExporterOTLP sends the spans to a collector by OTLP/HTTP in JSON
+	TracingExporterOTLP TracingExporterType = "otlp"
+	// TracingExporterStdout and TracingExporterFile write a span per line in JSON
+	TracingExporterStdout TracingExporterType = "stdout"
+	TracingExporterFile   TracingExporterType = "file"
+)
+
+type ConflictPolicyType string
+
+const (
+	ConflictLastWins ConflictPolicyType = "LastWins"
+	ConflictWarn     ConflictPolicyType = "Warn"
+	ConflictFail     ConflictPolicyType = "Fail"
+)
+
 type HookType string
 
 const (
@@ -20,6 +20,26 @@ func init() {
 // RegisterConversions adds conversion functions to the given scheme.
 // Public to allow building arbitrary schemes.
 func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*APITranslationConfiguration)(nil), (*componentconfig.APITranslationConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration(a.(*APITranslationConfiguration), b.(*componentconfig.APITranslationConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.APITranslationConfiguration)(nil), (*APITranslationConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration(a.(*componentconfig.APITranslationConfiguration), b.(*APITranslationConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*HookCacheConfiguration)(nil), (*componentconfig.HookCacheConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration(a.(*HookCacheConfiguration), b.(*componentconfig.HookCacheConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.HookCacheConfiguration)(nil), (*HookCacheConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration(a.(*componentconfig.HookCacheConfiguration), b.(*HookCacheConfiguration), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*HookConfiguration)(nil), (*componentconfig.HookConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_HookConfiguration_To_componentconfig_HookConfiguration(a.(*HookConfiguration), b.(*componentconfig.HookConfiguration), scope)
 	}); err != nil {
@@ -50,13 +70,114 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*InventoryConfiguration)(nil), (*componentconfig.InventoryConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration(a.(*InventoryConfiguration), b.(*componentconfig.InventoryConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.InventoryConfiguration)(nil), (*InventoryConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration(a.(*componentconfig.InventoryConfiguration), b.(*InventoryConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ListenerConfiguration)(nil), (*componentconfig.ListenerConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ListenerConfiguration_To_componentconfig_ListenerConfiguration(a.(*ListenerConfiguration), b.(*componentconfig.ListenerConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.ListenerConfiguration)(nil), (*ListenerConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_ListenerConfiguration_To_v1alpha1_ListenerConfiguration(a.(*componentconfig.ListenerConfiguration), b.(*ListenerConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*PostHookHeadersConfiguration)(nil), (*componentconfig.PostHookHeadersConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration(a.(*PostHookHeadersConfiguration), b.(*componentconfig.PostHookHeadersConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.PostHookHeadersConfiguration)(nil), (*PostHookHeadersConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration(a.(*componentconfig.PostHookHeadersConfiguration), b.(*PostHookHeadersConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*TracingConfiguration)(nil), (*componentconfig.TracingConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration(a.(*TracingConfiguration), b.(*componentconfig.TracingConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*componentconfig.TracingConfiguration)(nil), (*TracingConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration(a.(*componentconfig.TracingConfiguration), b.(*TracingConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func autoConvert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration(in *APITranslationConfiguration, out *componentconfig.APITranslationConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.CanonicalAPIVersion = in.CanonicalAPIVersion
+	out.BackendAPIVersion = in.BackendAPIVersion
+	return nil
+}
+
+// Convert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration(in *APITranslationConfiguration, out *componentconfig.APITranslationConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration(in *componentconfig.APITranslationConfiguration, out *APITranslationConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.CanonicalAPIVersion = in.CanonicalAPIVersion
+	out.BackendAPIVersion = in.BackendAPIVersion
+	return nil
+}
+
+// Convert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration(in *componentconfig.APITranslationConfiguration, out *APITranslationConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration(in *HookCacheConfiguration, out *componentconfig.HookCacheConfiguration, s conversion.Scope) error {
+	out.TTL = in.TTL
+	out.MaxEntries = in.MaxEntries
 	return nil
 }
 
+// Convert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration(in *HookCacheConfiguration, out *componentconfig.HookCacheConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration(in *componentconfig.HookCacheConfiguration, out *HookCacheConfiguration, s conversion.Scope) error {
+	out.TTL = in.TTL
+	out.MaxEntries = in.MaxEntries
+	return nil
+}
+
+// Convert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration(in *componentconfig.HookCacheConfiguration, out *HookCacheConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration(in, out, s)
+}
+
 func autoConvert_v1alpha1_HookConfiguration_To_componentconfig_HookConfiguration(in *HookConfiguration, out *componentconfig.HookConfiguration, s conversion.Scope) error {
 	out.Timeout = time.Duration(in.Timeout)
 	out.ListenAddress = in.ListenAddress
+	out.SocketMode = in.SocketMode
+	out.SocketOwner = in.SocketOwner
 	out.RemoteEndpoint = in.RemoteEndpoint
+	out.AdminAddress = in.AdminAddress
+	out.AsyncWorkers = in.AsyncWorkers
+	out.AsyncQueueSize = in.AsyncQueueSize
+	if err := Convert_v1alpha1_APITranslationConfiguration_To_componentconfig_APITranslationConfiguration(&in.APITranslation, &out.APITranslation, s); err != nil {
+		return err
+	}
+	if err := Convert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration(&in.Inventory, &out.Inventory, s); err != nil {
+		return err
+	}
+	if err := Convert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration(&in.Tracing, &out.Tracing, s); err != nil {
+		return err
+	}
+	out.Listeners = *(*componentconfig.ListenerConfigurationList)(unsafe.Pointer(&in.Listeners))
 	out.WebHooks = *(*componentconfig.HookConfigurationList)(unsafe.Pointer(&in.WebHooks))
 	return nil
 }
@@ -69,7 +190,22 @@ func Convert_v1alpha1_HookConfiguration_To_componentconfig_HookConfiguration(in
 func autoConvert_componentconfig_HookConfiguration_To_v1alpha1_HookConfiguration(in *componentconfig.HookConfiguration, out *HookConfiguration, s conversion.Scope) error {
 	out.Timeout = time.Duration(in.Timeout)
 	out.ListenAddress = in.ListenAddress
+	out.SocketMode = in.SocketMode
+	out.SocketOwner = in.SocketOwner
 	out.RemoteEndpoint = in.RemoteEndpoint
+	out.AdminAddress = in.AdminAddress
+	out.AsyncWorkers = in.AsyncWorkers
+	out.AsyncQueueSize = in.AsyncQueueSize
+	if err := Convert_componentconfig_APITranslationConfiguration_To_v1alpha1_APITranslationConfiguration(&in.APITranslation, &out.APITranslation, s); err != nil {
+		return err
+	}
+	if err := Convert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration(&in.Inventory, &out.Inventory, s); err != nil {
+		return err
+	}
+	if err := Convert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration(&in.Tracing, &out.Tracing, s); err != nil {
+		return err
+	}
+	out.Listeners = *(*ListenerConfigurationList)(unsafe.Pointer(&in.Listeners))
 	out.WebHooks = *(*HookConfigurationList)(unsafe.Pointer(&in.WebHooks))
 	return nil
 }
@@ -81,8 +217,26 @@ func Convert_componentconfig_HookConfiguration_To_v1alpha1_HookConfiguration(in
 
 func autoConvert_v1alpha1_HookConfigurationItem_To_componentconfig_HookConfigurationItem(in *HookConfigurationItem, out *componentconfig.HookConfigurationItem, s conversion.Scope) error {
 	out.Name = in.Name
+	out.Type = componentconfig.WebHookType(in.Type)
+	out.Builtin = in.Builtin
+	out.Options = in.Options
 	out.Endpoint = in.Endpoint
 	out.FailurePolicy = componentconfig.FailurePolicyType(in.FailurePolicy)
+	out.Priority = in.Priority
+	out.HealthPath = in.HealthPath
+	out.SideEffectOnly = in.SideEffectOnly
+	out.Async = in.Async
+	out.SandboxAware = in.SandboxAware
+	out.Protocol = componentconfig.ProtocolType(in.Protocol)
+	out.MaxInFlight = in.MaxInFlight
+	out.MaxQueueLength = in.MaxQueueLength
+	out.QueueTimeout = in.QueueTimeout
+	if err := Convert_v1alpha1_HookCacheConfiguration_To_componentconfig_HookCacheConfiguration(&in.Cache, &out.Cache, s); err != nil {
+		return err
+	}
+	if err := Convert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration(&in.PostHookHeaders, &out.PostHookHeaders, s); err != nil {
+		return err
+	}
 	out.Stages = *(*componentconfig.HookStageList)(unsafe.Pointer(&in.Stages))
 	return nil
 }
@@ -94,8 +248,26 @@ func Convert_v1alpha1_HookConfigurationItem_To_componentconfig_HookConfiguration
 
 func autoConvert_componentconfig_HookConfigurationItem_To_v1alpha1_HookConfigurationItem(in *componentconfig.HookConfigurationItem, out *HookConfigurationItem, s conversion.Scope) error {
 	out.Name = in.Name
+	out.Type = WebHookType(in.Type)
+	out.Builtin = in.Builtin
+	out.Options = in.Options
 	out.Endpoint = in.Endpoint
 	out.FailurePolicy = FailurePolicyType(in.FailurePolicy)
+	out.Priority = in.Priority
+	out.HealthPath = in.HealthPath
+	out.SideEffectOnly = in.SideEffectOnly
+	out.Async = in.Async
+	out.SandboxAware = in.SandboxAware
+	out.Protocol = ProtocolType(in.Protocol)
+	out.MaxInFlight = in.MaxInFlight
+	out.MaxQueueLength = in.MaxQueueLength
+	out.QueueTimeout = in.QueueTimeout
+	if err := Convert_componentconfig_HookCacheConfiguration_To_v1alpha1_HookCacheConfiguration(&in.Cache, &out.Cache, s); err != nil {
+		return err
+	}
+	if err := Convert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration(&in.PostHookHeaders, &out.PostHookHeaders, s); err != nil {
+		return err
+	}
 	out.Stages = *(*HookStageList)(unsafe.Pointer(&in.Stages))
 	return nil
 }
@@ -109,6 +281,11 @@ func autoConvert_v1alpha1_HookStage_To_componentconfig_HookStage(in *HookStage,
 	out.Method = in.Method
 	out.URLPattern = in.URLPattern
 	out.Type = componentconfig.HookType(in.Type)
+	out.MinAPIVersion = in.MinAPIVersion
+	out.MaxAPIVersion = in.MaxAPIVersion
+	out.ConflictPolicy = componentconfig.ConflictPolicyType(in.ConflictPolicy)
+	out.MaxRequestBodySize = in.MaxRequestBodySize
+	out.MaxResponseBodySize = in.MaxResponseBodySize
 	return nil
 }
 
@@ -121,6 +298,11 @@ func autoConvert_componentconfig_HookStage_To_v1alpha1_HookStage(in *componentco
 	out.Method = in.Method
 	out.URLPattern = in.URLPattern
 	out.Type = string(in.Type)
+	out.MinAPIVersion = in.MinAPIVersion
+	out.MaxAPIVersion = in.MaxAPIVersion
+	out.ConflictPolicy = ConflictPolicyType(in.ConflictPolicy)
+	out.MaxRequestBodySize = in.MaxRequestBodySize
+	out.MaxResponseBodySize = in.MaxResponseBodySize
 	return nil
 }
 
@@ -128,3 +310,103 @@ func autoConvert_componentconfig_HookStage_To_v1alpha1_HookStage(in *componentco
 func Convert_componentconfig_HookStage_To_v1alpha1_HookStage(in *componentconfig.HookStage, out *HookStage, s conversion.Scope) error {
 	return autoConvert_componentconfig_HookStage_To_v1alpha1_HookStage(in, out, s)
 }
+
+func autoConvert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration(in *InventoryConfiguration, out *componentconfig.InventoryConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.StateFile = in.StateFile
+	return nil
+}
+
+// Convert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration(in *InventoryConfiguration, out *componentconfig.InventoryConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_InventoryConfiguration_To_componentconfig_InventoryConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration(in *componentconfig.InventoryConfiguration, out *InventoryConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.StateFile = in.StateFile
+	return nil
+}
+
+// Convert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration(in *componentconfig.InventoryConfiguration, out *InventoryConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_InventoryConfiguration_To_v1alpha1_InventoryConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_ListenerConfiguration_To_componentconfig_ListenerConfiguration(in *ListenerConfiguration, out *componentconfig.ListenerConfiguration, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Address = in.Address
+	out.SocketMode = in.SocketMode
+	out.SocketOwner = in.SocketOwner
+	out.ReadOnly = in.ReadOnly
+	out.WebHooks = *(*[]string)(unsafe.Pointer(&in.WebHooks))
+	return nil
+}
+
+// Convert_v1alpha1_ListenerConfiguration_To_componentconfig_ListenerConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_ListenerConfiguration_To_componentconfig_ListenerConfiguration(in *ListenerConfiguration, out *componentconfig.ListenerConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ListenerConfiguration_To_componentconfig_ListenerConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_ListenerConfiguration_To_v1alpha1_ListenerConfiguration(in *componentconfig.ListenerConfiguration, out *ListenerConfiguration, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Address = in.Address
+	out.SocketMode = in.SocketMode
+	out.SocketOwner = in.SocketOwner
+	out.ReadOnly = in.ReadOnly
+	out.WebHooks = *(*[]string)(unsafe.Pointer(&in.WebHooks))
+	return nil
+}
+
+// Convert_componentconfig_ListenerConfiguration_To_v1alpha1_ListenerConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_ListenerConfiguration_To_v1alpha1_ListenerConfiguration(in *componentconfig.ListenerConfiguration, out *ListenerConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_ListenerConfiguration_To_v1alpha1_ListenerConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration(in *PostHookHeadersConfiguration, out *componentconfig.PostHookHeadersConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.MaxSize = in.MaxSize
+	return nil
+}
+
+// Convert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration(in *PostHookHeadersConfiguration, out *componentconfig.PostHookHeadersConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_PostHookHeadersConfiguration_To_componentconfig_PostHookHeadersConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration(in *componentconfig.PostHookHeadersConfiguration, out *PostHookHeadersConfiguration, s conversion.Scope) error {
+	out.Enabled = in.Enabled
+	out.MaxSize = in.MaxSize
+	return nil
+}
+
+// Convert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration(in *componentconfig.PostHookHeadersConfiguration, out *PostHookHeadersConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_PostHookHeadersConfiguration_To_v1alpha1_PostHookHeadersConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration(in *TracingConfiguration, out *componentconfig.TracingConfiguration, s conversion.Scope) error {
+	out.Exporter = componentconfig.TracingExporterType(in.Exporter)
+	out.Endpoint = in.Endpoint
+	out.Path = in.Path
+	out.ServiceName = in.ServiceName
+	return nil
+}
+
+// Convert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration(in *TracingConfiguration, out *componentconfig.TracingConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_TracingConfiguration_To_componentconfig_TracingConfiguration(in, out, s)
+}
+
+func autoConvert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration(in *componentconfig.TracingConfiguration, out *TracingConfiguration, s conversion.Scope) error {
+	out.Exporter = TracingExporterType(in.Exporter)
+	out.Endpoint = in.Endpoint
+	out.Path = in.Path
+	out.ServiceName = in.ServiceName
+	return nil
+}
+
+// Convert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration is an autogenerated conversion function.
+func Convert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration(in *componentconfig.TracingConfiguration, out *TracingConfiguration, s conversion.Scope) error {
+	return autoConvert_componentconfig_TracingConfiguration_To_v1alpha1_TracingConfiguration(in, out, s)
+}
@@ -8,10 +8,53 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APITranslationConfiguration) DeepCopyInto(out *APITranslationConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APITranslationConfiguration.
+func (in *APITranslationConfiguration) DeepCopy() *APITranslationConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(APITranslationConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HookCacheConfiguration) DeepCopyInto(out *HookCacheConfiguration) {
+	*out = *in
+	out.TTL = in.TTL
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HookCacheConfiguration.
+func (in *HookCacheConfiguration) DeepCopy() *HookCacheConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(HookCacheConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HookConfiguration) DeepCopyInto(out *HookConfiguration) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
+	out.APITranslation = in.APITranslation
+	out.Inventory = in.Inventory
+	out.Tracing = in.Tracing
+	if in.Listeners != nil {
+		in, out := &in.Listeners, &out.Listeners
+		*out = make(ListenerConfigurationList, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.WebHooks != nil {
 		in, out := &in.WebHooks, &out.WebHooks
 		*out = make(HookConfigurationList, len(*in))
@@ -43,6 +86,10 @@ func (in *HookConfiguration) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HookConfigurationItem) DeepCopyInto(out *HookConfigurationItem) {
 	*out = *in
+	in.Options.DeepCopyInto(&out.Options)
+	out.QueueTimeout = in.QueueTimeout
+	out.Cache = in.Cache
+	out.PostHookHeaders = in.PostHookHeaders
 	if in.Stages != nil {
 		in, out := &in.Stages, &out.Stages
 		*out = make(HookStageList, len(*in))
@@ -118,3 +165,94 @@ func (in HookStageList) DeepCopy() HookStageList {
 	in.DeepCopyInto(out)
 	return *out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryConfiguration) DeepCopyInto(out *InventoryConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryConfiguration.
+func (in *InventoryConfiguration) DeepCopy() *InventoryConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ListenerConfiguration) DeepCopyInto(out *ListenerConfiguration) {
+	*out = *in
+	if in.WebHooks != nil {
+		in, out := &in.WebHooks, &out.WebHooks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ListenerConfiguration.
+func (in *ListenerConfiguration) DeepCopy() *ListenerConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(ListenerConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in ListenerConfigurationList) DeepCopyInto(out *ListenerConfigurationList) {
+	{
+		in := &in
+		*out = make(ListenerConfigurationList, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+		return
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ListenerConfigurationList.
+func (in ListenerConfigurationList) DeepCopy() ListenerConfigurationList {
+	if in == nil {
+		return nil
+	}
+	out := new(ListenerConfigurationList)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PostHookHeadersConfiguration) DeepCopyInto(out *PostHookHeadersConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PostHookHeadersConfiguration.
+func (in *PostHookHeadersConfiguration) DeepCopy() *PostHookHeadersConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(PostHookHeadersConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracingConfiguration) DeepCopyInto(out *TracingConfiguration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracingConfiguration.
+func (in *TracingConfiguration) DeepCopy() *TracingConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(TracingConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,361 @@
+// Package envinject is a builtin hook injecting environment variables and bind mounts into the created containers. The
+// variables come from the configuration, env files and a directory of secrets which are reloaded when they change
+package envinject
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+)
+
+// Name is the builtin name of the hook
+const Name = "env-inject"
+
+const defaultReloadInterval = 10 * time.Second
+
+func init() {
+	hook.RegisterBuiltin(Name, func(cfg *hook.BuiltinConfig) (hook.HookHandler, error) {
+		opts := &Options{}
+		if len(cfg.Options) > 0 {
+			if err := json.Unmarshal(cfg.Options, opts); err != nil {
+				return nil, fmt.Errorf("can't decode options, %v", err)
+			}
+		}
+		return New(cfg.Name, opts)
+	})
+}
+
+// Options are the variables and the mounts to inject. A variable of a later source replaces the one of the same name
+// of an earlier source, the sources are Env, EnvFiles in order and SecretDir
+type Options struct {
+	// Selector is a label selector of the containers, e.g. io.kubernetes.docker.type=container, all the containers
+	// are selected if it's empty
+	Selector string `json:"selector,omitempty"`
+	// Env are the variables by their names
+	Env map[string]string `json:"env,omitempty"`
+	// EnvFiles have a NAME=VALUE per line, empty lines and lines starting with # are ignored
+	EnvFiles []string `json:"envFiles,omitempty"`
+	// SecretDir has a file per variable, the file name is the name of the variable and its content without the
+	// trailing newline is the value
+	SecretDir string `json:"secretDir,omitempty"`
+	// ReloadInterval is how often EnvFiles and SecretDir are read again, it's 10s by default
+	ReloadInterval metav1.Duration `json:"reloadInterval,omitempty"`
+	// Mounts are bind mounted into the containers
+	Mounts []Mount `json:"mounts,omitempty"`
+}
+
+// Mount is a bind mount of a host path
+type Mount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// EnvInject is the hook injecting the variables and the mounts. The values are never logged, since they are
+// usually credentials
+type EnvInject struct {
+	name     string
+	selector labels.Selector
+	env      map[string]string
+	files    []string
+	dir      string
+	binds    []string
+	targets  []string
+
+	lock sync.RWMutex
+	// loaded are the variables of all the sources
+	loaded map[string]string
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+var _ hook.HookHandler = (*EnvInject)(nil)
+
+// New returns the hook named name, it reloads the files until Close is called
+func New(name string, opts *Options) (*EnvInject, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q, %v", opts.Selector, err)
+	}
+
+	ei := &EnvInject{
+		name:     name,
+		selector: selector,
+		env:      opts.Env,
+		files:    opts.EnvFiles,
+		dir:      opts.SecretDir,
+		stopCh:   make(chan struct{}),
+	}
+
+	for k := range opts.Env {
+		if !validName(k) {
+			return nil, fmt.Errorf("invalid variable name %q", k)
+		}
+	}
+
+	for _, m := range opts.Mounts {
+		if !filepath.IsAbs(m.Source) || !filepath.IsAbs(m.Target) {
+			return nil, fmt.Errorf("mount %s:%s is not absolute", m.Source, m.Target)
+		}
+		bind := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			bind += ":ro"
+		}
+		ei.binds = append(ei.binds, bind)
+		ei.targets = append(ei.targets, filepath.Clean(m.Target))
+	}
+
+	loaded, err := ei.load()
+	if err != nil {
+		return nil, err
+	}
+	ei.loaded = loaded
+
+	if len(ei.files) > 0 || len(ei.dir) > 0 {
+		interval := opts.ReloadInterval.Duration
+		if interval <= 0 {
+			interval = defaultReloadInterval
+		}
+		go ei.reload(interval)
+	}
+
+	return ei, nil
+}
+
+func (ei *EnvInject) PreHook(ctx context.Context, patch *hook.PatchData, method, path string, body []byte) error {
+	if method != http.MethodPost || hook.UnversionedPath(path) != "/containers/create" {
+		return nil
+	}
+
+	config := struct {
+		Env        []string          `json:"Env"`
+		Labels     map[string]string `json:"Labels"`
+		HostConfig struct {
+			Binds  []string `json:"Binds"`
+			Mounts []struct {
+				Target string `json:"Target"`
+			} `json:"Mounts"`
+		} `json:"HostConfig"`
+	}{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("can't decode create body, %v", err)
+	}
+
+	if !ei.selector.Matches(labels.Set(config.Labels)) {
+		return nil
+	}
+
+	// the variables and the mounts of the pod are never overwritten
+	set := make(map[string]bool, len(config.Env))
+	for _, e := range config.Env {
+		set[strings.SplitN(e, "=", 2)[0]] = true
+	}
+	mounted := make(map[string]bool)
+	for _, b := range config.HostConfig.Binds {
+		if parts := strings.Split(b, ":"); len(parts) > 1 {
+			mounted[filepath.Clean(parts[1])] = true
+		}
+	}
+	for _, m := range config.HostConfig.Mounts {
+		mounted[filepath.Clean(m.Target)] = true
+	}
+
+	ei.lock.RLock()
+	var env, names []string
+	for k, v := range ei.loaded {
+		if !set[k] {
+			env = append(env, k+"="+v)
+			names = append(names, k)
+		}
+	}
+	ei.lock.RUnlock()
+	sort.Strings(env)
+	sort.Strings(names)
+
+	var binds []string
+	for i, b := range ei.binds {
+		if !mounted[ei.targets[i]] {
+			binds = append(binds, b)
+		}
+	}
+
+	if len(env) == 0 && len(binds) == 0 {
+		return nil
+	}
+
+	klog.V(4).Infof("Inject variables %v and %d mounts into container", names, len(binds))
+	injected := map[string]interface{}{}
+	if len(env) > 0 {
+		injected["Env"] = env
+	}
+	if len(binds) > 0 {
+		injected["HostConfig"] = map[string]interface{}{"Binds": binds}
+	}
+	data, err := json.Marshal(injected)
+	if err != nil {
+		return err
+	}
+
+	// the entries are merged into the lists of the pod by their names and destinations
+	patch.PatchType = string(types.StrategicMergePatchType)
+	patch.PatchData = data
+	return nil
+}
+
+func (ei *EnvInject) PostHook(ctx context.Context, patch *hook.PatchData, method, path string, body []byte) error {
+	return nil
+}
+
+// Close stops reloading the files
+func (ei *EnvInject) Close() error {
+	ei.stopOnce.Do(func() {
+		close(ei.stopCh)
+	})
+	return nil
+}
+
+func (ei *EnvInject) reload(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ei.stopCh:
+			return
+		}
+
+		loaded, err := ei.load()
+		if err != nil {
+			// the variables loaded before are kept
+			klog.Errorf("can't reload variables of %s, %v", ei.name, err)
+			continue
+		}
+
+		ei.lock.Lock()
+		if !equalEnv(ei.loaded, loaded) {
+			klog.Infof("Reload %d variables of %s", len(loaded), ei.name)
+		}
+		ei.loaded = loaded
+		ei.lock.Unlock()
+	}
+}
+
+// load reads the variables of all the sources
+func (ei *EnvInject) load() (map[string]string, error) {
+	loaded := make(map[string]string, len(ei.env))
+	for k, v := range ei.env {
+		loaded[k] = v
+	}
+
+	for _, f := range ei.files {
+		if err := loadEnvFile(f, loaded); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ei.dir) > 0 {
+		if err := loadSecretDir(ei.dir, loaded); err != nil {
+			return nil, err
+		}
+	}
+
+	return loaded, nil
+}
+
+// loadEnvFile adds the variables of the file to env, the errors never include the values
+func loadEnvFile(path string, env map[string]string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read env file %s, %v", path, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || !validName(kv[0]) {
+			return fmt.Errorf("invalid line %d of env file %s", n, path)
+		}
+		env[kv[0]] = kv[1]
+	}
+
+	return scanner.Err()
+}
+
+// loadSecretDir adds a variable for each regular file of dir, the hidden files are skipped, e.g. the ..data links
+// of a Kubernetes volume
+func loadSecretDir(dir string, env map[string]string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("can't read secret dir %s, %v", dir, err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		// the files are usually symbolic links
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("can't stat secret %s, %v", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if !validName(name) {
+			return fmt.Errorf("invalid variable name of secret %s", path)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("can't read secret %s, %v", path, err)
+		}
+		env[name] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return nil
+}
+
+// validName returns whether name is a variable name which Docker accepts in Env
+func validName(name string) bool {
+	return len(name) > 0 && !strings.ContainsAny(name, "= \t\n\x00")
+}
+
+func equalEnv(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, found := b[k]; !found || bv != v {
+			return false
+		}
+	}
+	return true
+}
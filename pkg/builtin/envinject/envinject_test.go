@@ -0,0 +1,198 @@
+package envinject
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+)
+
+type createBody struct {
+	Env        []string          `json:"Env"`
+	Labels     map[string]string `json:"Labels"`
+	HostConfig struct {
+		Binds []string `json:"Binds"`
+	} `json:"HostConfig"`
+}
+
+func newTestManager(t *testing.T, ei *EnvInject) (*hook.Manager, chan createBody) {
+	bodies := make(chan createBody, 1)
+	hm := hook.NewManager(hook.WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := createBody{}
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		bodies <- body
+		w.WriteHeader(http.StatusCreated)
+	})), hook.WithSystemd(false))
+
+	if err := hm.RegisterHook(hook.HookRegistration{
+		Name:    Name,
+		Handler: ei,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	return hm, bodies
+}
+
+func create(hm *hook.Manager, body string) int {
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/v1.40/containers/create", strings.NewReader(body)))
+	return ans.Code
+}
+
+func TestEnvInject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envinject")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "node.env")
+	if err := ioutil.WriteFile(envFile, []byte("# node settings\nZONE=zone-a\n\nHTTP_PROXY=http://proxy:3128\n"),
+		0644); err != nil {
+		t.Fatalf("can't write env file: %v", err)
+	}
+	secretDir := filepath.Join(dir, "secrets")
+	os.Mkdir(secretDir, 0700)
+	if err := ioutil.WriteFile(filepath.Join(secretDir, "TOKEN"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatalf("can't write secret: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(secretDir, ".hidden"), []byte("skipped"), 0600)
+
+	ei, err := New(Name, &Options{
+		Selector:       "io.kubernetes.docker.type=container",
+		Env:            map[string]string{"RACK": "r1", "ZONE": "overridden"},
+		EnvFiles:       []string{envFile},
+		SecretDir:      secretDir,
+		ReloadInterval: metav1.Duration{Duration: 10 * time.Millisecond},
+		Mounts: []Mount{
+			{Source: "/etc/node", Target: "/etc/node", ReadOnly: true},
+			{Source: "/var/run/creds", Target: "/creds"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+	defer ei.Close()
+	hm, bodies := newTestManager(t, ei)
+
+	if code := create(hm, `{"Env":["RACK=pod","PATH=/bin"],"Labels":{"io.kubernetes.docker.type":"container"},`+
+		`"HostConfig":{"Binds":["/data:/creds"]}}`); code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be 201", code)
+	}
+	body := <-bodies
+	expectedEnv := []string{"RACK=pod", "PATH=/bin", "HTTP_PROXY=http://proxy:3128", "TOKEN=s3cr3t", "ZONE=zone-a"}
+	if !reflect.DeepEqual(body.Env, expectedEnv) {
+		t.Errorf("expect env %v to be %v", body.Env, expectedEnv)
+	}
+	expectedBinds := []string{"/data:/creds", "/etc/node:/etc/node:ro"}
+	if !reflect.DeepEqual(body.HostConfig.Binds, expectedBinds) {
+		t.Errorf("expect binds %v to be %v", body.HostConfig.Binds, expectedBinds)
+	}
+
+	// the sandbox is not selected
+	if code := create(hm, `{"Labels":{"io.kubernetes.docker.type":"podsandbox"}}`); code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be 201", code)
+	}
+	if body := <-bodies; len(body.Env) != 0 || len(body.HostConfig.Binds) != 0 {
+		t.Errorf("expect sandbox not to be injected, got %v %v", body.Env, body.HostConfig.Binds)
+	}
+
+	// the rotated secret is reloaded
+	if err := ioutil.WriteFile(filepath.Join(secretDir, "TOKEN"), []byte("rotated"), 0600); err != nil {
+		t.Fatalf("can't write secret: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		ei.lock.RLock()
+		token := ei.loaded["TOKEN"]
+		ei.lock.RUnlock()
+		if token == "rotated" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect secret to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEnvInjectRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	flags.Set("v", "5")
+	flags.Set("logtostderr", "false")
+	klog.SetOutput(&logs)
+	defer func() {
+		flags.Set("v", "0")
+		flags.Set("logtostderr", "true")
+	}()
+
+	ei, err := New(Name, &Options{Env: map[string]string{"PASSWORD": "hunter2"}})
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+	hm, bodies := newTestManager(t, ei)
+
+	if code := create(hm, `{"Image":"busybox"}`); code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be 201", code)
+	}
+	if body := <-bodies; !reflect.DeepEqual(body.Env, []string{"PASSWORD=hunter2"}) {
+		t.Errorf("expect env %v to be injected", body.Env)
+	}
+
+	klog.Flush()
+	if strings.Contains(logs.String(), "hunter2") {
+		t.Errorf("expect the value to be kept out of logs:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "PASSWORD") {
+		t.Errorf("expect the injected name to be logged:\n%s", logs.String())
+	}
+}
+
+func TestEnvInjectInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envinject")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "bad.env")
+	ioutil.WriteFile(envFile, []byte("SECRET=value\nnot a variable\n"), 0644)
+
+	for desc, opts := range map[string]*Options{
+		"invalid selector": {Selector: "a in b"},
+		"invalid name":     {Env: map[string]string{"A=B": "c"}},
+		"invalid env file": {EnvFiles: []string{envFile}},
+		"missing env file": {EnvFiles: []string{filepath.Join(dir, "missing.env")}},
+		"relative mount":   {Mounts: []Mount{{Source: "data", Target: "/data"}}},
+	} {
+		ei, err := New(Name, opts)
+		if err == nil {
+			ei.Close()
+			t.Errorf("%s: expect an error", desc)
+			continue
+		}
+		if strings.Contains(err.Error(), "value") {
+			t.Errorf("%s: expect the value to be kept out of error %v", desc, err)
+		}
+	}
+}
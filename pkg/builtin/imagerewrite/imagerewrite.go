@@ -0,0 +1,368 @@
+// Package imagerewrite is a builtin hook rewriting the image references of container creates and image pulls. It
+// redirects repositories to mirrors, pins tags to digests and denies the registries which are not allowed
+package imagerewrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+)
+
+// Name is the builtin name of the hook
+const Name = "image-rewrite"
+
+// headerRegistryAuth carries the credentials of the registry of an image pull
+const headerRegistryAuth = "X-Registry-Auth"
+
+// imageIDRegexp matches the image IDs, which are not rewritten
+var imageIDRegexp = regexp.MustCompile(`^(sha256:)?[a-f0-9]{12,64}$`)
+
+func init() {
+	hook.RegisterBuiltin(Name, func(cfg *hook.BuiltinConfig) (hook.HookHandler, error) {
+		opts := &Options{}
+		if len(cfg.Options) > 0 {
+			if err := json.Unmarshal(cfg.Options, opts); err != nil {
+				return nil, fmt.Errorf("can't decode options, %v", err)
+			}
+		}
+		return New(cfg.Name, opts, cfg.Backend)
+	})
+}
+
+// Options are the rules of the hook, they are applied in order: the registry policy to the reference given by the
+// client, the digest pinning, and the mirrors
+type Options struct {
+	// Mirrors redirect the repositories to mirrors, the longest matched prefix is used
+	Mirrors []Mirror `json:"mirrors,omitempty"`
+	// DigestFile is a JSON object mapping repository:tag to its digest, e.g. {"docker.io/library/nginx:1.19":
+	// "sha256:..."}. The file is read again when it's modified
+	DigestFile string `json:"digestFile,omitempty"`
+	// AllowedRegistries are the only registries allowed if it's not empty
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	// DeniedRegistries are the registries denied
+	DeniedRegistries []string `json:"deniedRegistries,omitempty"`
+}
+
+// Mirror replaces the prefix of the normalized repositories, e.g. docker.io/library/ with mirror.local/library/
+type Mirror struct {
+	Prefix      string `json:"prefix"`
+	Replacement string `json:"replacement"`
+	// AuthFile is the JSON of the credentials of the mirror, which replaces X-Registry-Auth of the pulls redirected to
+	// another registry. The credentials of the original registry are dropped if it's not set
+	AuthFile string `json:"authFile,omitempty"`
+}
+
+// ImageRewrite is the hook rewriting the image references
+type ImageRewrite struct {
+	name    string
+	mirrors []Mirror
+	allowed map[string]bool
+	denied  map[string]bool
+	digests *digestFile
+	// backend tags the images pulled by rewritten references
+	backend http.Handler
+}
+
+// pullState is the state handed from the pre hook of a rewritten pull to its post hook
+type pullState struct {
+	// Image is the reference pulled by the client
+	Image string `json:"image"`
+	// Rewritten is the reference pulled from the backend
+	Rewritten string `json:"rewritten"`
+}
+
+var _ hook.HookHandler = (*ImageRewrite)(nil)
+
+// New returns the hook named name, the images pulled by rewritten references are tagged through backend with the
+// references given by the clients. They are not tagged if backend is nil
+func New(name string, opts *Options, backend http.Handler) (*ImageRewrite, error) {
+	ir := &ImageRewrite{
+		name:    name,
+		backend: backend,
+		allowed: make(map[string]bool),
+		denied:  make(map[string]bool),
+	}
+
+	for _, m := range opts.Mirrors {
+		prefix, replacement := strings.TrimSuffix(m.Prefix, "/"), strings.TrimSuffix(m.Replacement, "/")
+		if len(prefix) == 0 || len(replacement) == 0 {
+			return nil, fmt.Errorf("mirror of %q has an empty prefix or replacement", m.Prefix)
+		}
+		ir.mirrors = append(ir.mirrors, Mirror{Prefix: prefix, Replacement: replacement, AuthFile: m.AuthFile})
+	}
+	// the longest prefix is matched first
+	sort.SliceStable(ir.mirrors, func(i, j int) bool {
+		return len(ir.mirrors[i].Prefix) > len(ir.mirrors[j].Prefix)
+	})
+
+	for _, r := range opts.AllowedRegistries {
+		ir.allowed[normalizeDomain(r)] = true
+	}
+	for _, r := range opts.DeniedRegistries {
+		ir.denied[normalizeDomain(r)] = true
+	}
+
+	if len(opts.DigestFile) > 0 {
+		ir.digests = &digestFile{path: opts.DigestFile}
+		if _, err := ir.digests.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ir, nil
+}
+
+func normalizeDomain(domain string) string {
+	if domain == legacyDomain {
+		return defaultDomain
+	}
+	return domain
+}
+
+func (ir *ImageRewrite) PreHook(ctx context.Context, patch *hook.PatchData, method, path string, body []byte) error {
+	if method != http.MethodPost {
+		return nil
+	}
+
+	switch hook.UnversionedPath(path) {
+	case "/containers/create":
+		return ir.rewriteCreate(patch, body)
+	case "/images/create":
+		return ir.rewritePull(patch, hook.RequestInfoFrom(ctx))
+	}
+	return nil
+}
+
+func (ir *ImageRewrite) PostHook(ctx context.Context, patch *hook.PatchData, method, path string, body []byte) error {
+	if method != http.MethodPost || hook.UnversionedPath(path) != "/images/create" || len(patch.State) == 0 {
+		return nil
+	}
+	return ir.tagPull(ctx, patch.State, body)
+}
+
+func (ir *ImageRewrite) rewriteCreate(patch *hook.PatchData, body []byte) error {
+	config := struct {
+		Image string `json:"Image"`
+	}{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("can't decode create body, %v", err)
+	}
+
+	// kubelet creates containers by image IDs, which don't refer to a registry
+	if len(config.Image) == 0 || imageIDRegexp.MatchString(config.Image) {
+		return nil
+	}
+
+	ref, err := parseReference(config.Image)
+	if err != nil {
+		return err
+	}
+
+	rewritten, _, err := ir.rewrite(ref)
+	if err != nil || rewritten.String() == ref.String() {
+		return err
+	}
+
+	klog.V(4).Infof("Rewrite image %s of container create to %s", config.Image, rewritten)
+	data, err := json.Marshal(map[string]string{"Image": rewritten.String()})
+	if err != nil {
+		return err
+	}
+	patch.PatchType = string(types.MergePatchType)
+	patch.PatchData = data
+	return nil
+}
+
+func (ir *ImageRewrite) rewritePull(patch *hook.PatchData, info *hook.RequestInfo) error {
+	query := info.Query()
+	fromImage := query.Get("fromImage")
+	// an import from a source is not a pull
+	if len(fromImage) == 0 {
+		return nil
+	}
+
+	image := fromImage
+	if tag := query.Get("tag"); len(tag) > 0 {
+		if strings.Contains(tag, ":") {
+			image += "@" + tag
+		} else {
+			image += ":" + tag
+		}
+	}
+
+	ref, err := parseReference(image)
+	if err != nil {
+		return err
+	}
+
+	rewritten, mirror, err := ir.rewrite(ref)
+	if err != nil || rewritten.String() == ref.String() {
+		return err
+	}
+
+	klog.V(4).Infof("Rewrite image %s of pull to %s", image, rewritten)
+	query.Set("fromImage", rewritten.Name)
+	if len(rewritten.Digest) > 0 {
+		query.Set("tag", rewritten.Digest)
+	} else {
+		query.Set("tag", rewritten.Tag)
+	}
+	patch.Query = query
+
+	state, err := json.Marshal(&pullState{Image: image, Rewritten: rewritten.String()})
+	if err != nil {
+		return err
+	}
+	patch.State = state
+
+	// the credentials of a registry are never sent to another one
+	if rewritten.Domain() != ref.Domain() {
+		patch.Header = http.Header{headerRegistryAuth: nil}
+		if mirror != nil && len(mirror.AuthFile) > 0 {
+			auth, err := ioutil.ReadFile(mirror.AuthFile)
+			if err != nil {
+				return fmt.Errorf("can't read credentials of mirror %s, %v", mirror.Replacement, err)
+			}
+			patch.Header.Set(headerRegistryAuth, base64.URLEncoding.EncodeToString(auth))
+		}
+	}
+
+	return nil
+}
+
+// tagPull tags the image pulled by the rewritten reference with the reference given by the client, so the clients
+// which inspect the image by the reference they pulled, like dockershim, find it
+func (ir *ImageRewrite) tagPull(ctx context.Context, data []byte, body []byte) error {
+	info := hook.RequestInfoFrom(ctx)
+	// a failed pull answers 200 as well, with the error in the stream
+	if info.StatusCode != http.StatusOK || bytes.Contains(body, []byte(`"errorDetail"`)) {
+		return nil
+	}
+
+	state := &pullState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("can't decode state of pull, %v", err)
+	}
+	// an image can't be tagged with a digest
+	if strings.Contains(state.Image, "@") {
+		klog.V(4).Infof("Skip tagging %s with digest reference %s", state.Rewritten, state.Image)
+		return nil
+	}
+	if ir.backend == nil {
+		klog.Warningf("Can't tag %s with %s, no backend", state.Rewritten, state.Image)
+		return nil
+	}
+
+	repo, tag := state.Image, "latest"
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+
+	query := url.Values{"repo": []string{repo}, "tag": []string{tag}}
+	recorder := httptest.NewRecorder()
+	ir.backend.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost,
+		"/images/"+state.Rewritten+"/tag?"+query.Encode(), nil).WithContext(ctx))
+	if recorder.Code != http.StatusCreated {
+		return fmt.Errorf("can't tag %s with %s, status code %d, %s", state.Rewritten, state.Image, recorder.Code,
+			strings.TrimSpace(recorder.Body.String()))
+	}
+
+	klog.V(4).Infof("Tag %s with %s", state.Rewritten, state.Image)
+	return nil
+}
+
+// rewrite checks the registry of ref, and returns the pinned and redirected reference with the mirror used
+func (ir *ImageRewrite) rewrite(ref *reference) (*reference, *Mirror, error) {
+	domain := ref.Domain()
+	if ir.denied[domain] || (len(ir.allowed) > 0 && !ir.allowed[domain]) {
+		return nil, nil, &hook.DeniedError{Hook: ir.name, Message: fmt.Sprintf("registry %s is not allowed", domain)}
+	}
+
+	rewritten := *ref
+	if len(rewritten.Digest) == 0 && ir.digests != nil {
+		digests, err := ir.digests.load()
+		if err != nil {
+			return nil, nil, err
+		}
+		if digest, found := digests[ref.NameTag()]; found {
+			rewritten.Digest = digest
+		}
+	}
+	// the tag is ignored by the registry if the digest is given
+	if len(rewritten.Digest) > 0 {
+		rewritten.Tag = ""
+	}
+
+	for i := range ir.mirrors {
+		m := &ir.mirrors[i]
+		if rewritten.Name == m.Prefix || strings.HasPrefix(rewritten.Name, m.Prefix+"/") {
+			rewritten.Name = m.Replacement + strings.TrimPrefix(rewritten.Name, m.Prefix)
+			return &rewritten, m, nil
+		}
+	}
+
+	return &rewritten, nil, nil
+}
+
+// digestFile caches the digests of a file until it's modified
+type digestFile struct {
+	path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	digests map[string]string
+}
+
+func (df *digestFile) load() (map[string]string, error) {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	info, err := os.Stat(df.path)
+	if err != nil {
+		return nil, fmt.Errorf("can't stat digest file %s, %v", df.path, err)
+	}
+	if df.digests != nil && info.ModTime().Equal(df.modTime) {
+		return df.digests, nil
+	}
+
+	data, err := ioutil.ReadFile(df.path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read digest file %s, %v", df.path, err)
+	}
+
+	pinned := make(map[string]string)
+	if err := json.Unmarshal(data, &pinned); err != nil {
+		return nil, fmt.Errorf("can't decode digest file %s, %v", df.path, err)
+	}
+
+	// the keys are normalized, so nginx:1.19 pins docker.io/library/nginx:1.19
+	digests := make(map[string]string, len(pinned))
+	for image, digest := range pinned {
+		ref, err := parseReference(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image of digest file %s, %v", df.path, err)
+		}
+		digests[ref.NameTag()] = digest
+	}
+
+	klog.V(2).Infof("Load %d digests from %s", len(digests), df.path)
+	df.digests, df.modTime = digests, info.ModTime()
+	return digests, nil
+}
@@ -0,0 +1,260 @@
+package imagerewrite
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+type backendRequest struct {
+	query string
+	auth  string
+	image string
+}
+
+func newTestManager(t *testing.T, opts *Options) (*hook.Manager, chan backendRequest) {
+	requests := make(chan backendRequest, 1)
+	hm := hook.NewManager(hook.WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		config := struct {
+			Image string `json:"Image"`
+		}{}
+		json.Unmarshal(body, &config)
+		requests <- backendRequest{query: r.URL.RawQuery, auth: r.Header.Get(headerRegistryAuth), image: config.Image}
+		w.WriteHeader(http.StatusOK)
+	})), hook.WithSystemd(false))
+
+	ir, err := New(Name, opts, nil)
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+
+	if err := hm.RegisterHook(hook.HookRegistration{
+		Name:    Name,
+		Handler: ir,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+			{Method: http.MethodPost, URLPattern: "/images/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	return hm, requests
+}
+
+func TestImageRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagerewrite")
+	if err != nil {
+		t.Fatalf("can't create dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	digestFile := filepath.Join(dir, "digests.json")
+	if err := ioutil.WriteFile(digestFile, []byte(`{"nginx:1.19":"sha256:1234"}`), 0644); err != nil {
+		t.Fatalf("can't write digests: %v", err)
+	}
+	authFile := filepath.Join(dir, "auth.json")
+	mirrorAuth := []byte(`{"username":"mirror","password":"secret"}`)
+	if err := ioutil.WriteFile(authFile, mirrorAuth, 0600); err != nil {
+		t.Fatalf("can't write auth: %v", err)
+	}
+
+	hm, requests := newTestManager(t, &Options{
+		Mirrors: []Mirror{
+			{Prefix: "docker.io/", Replacement: "mirror.local/hub/", AuthFile: authFile},
+			{Prefix: "docker.io/library/busybox", Replacement: "docker.io/mirrored/busybox"},
+			{Prefix: "quay.io", Replacement: "mirror.local/quay"},
+		},
+		DigestFile:       digestFile,
+		DeniedRegistries: []string{"evil.io"},
+	})
+
+	for _, c := range []struct {
+		desc          string
+		path          string
+		body          string
+		auth          string
+		expectedCode  int
+		expectedQuery string
+		expectedAuth  string
+		expectedImage string
+	}{
+		{
+			desc:          "create with mirror",
+			path:          "/v1.40/containers/create",
+			body:          `{"Image":"redis:6"}`,
+			expectedCode:  http.StatusOK,
+			expectedImage: "mirror.local/hub/library/redis:6",
+		},
+		{
+			desc:          "create with pinned digest",
+			path:          "/containers/create",
+			body:          `{"Image":"nginx:1.19"}`,
+			expectedCode:  http.StatusOK,
+			expectedImage: "mirror.local/hub/library/nginx@sha256:1234",
+		},
+		{
+			desc:          "create by image ID",
+			path:          "/containers/create",
+			body:          `{"Image":"sha256:0123456789abcdef"}`,
+			expectedCode:  http.StatusOK,
+			expectedImage: "sha256:0123456789abcdef",
+		},
+		{
+			desc:         "create with denied registry",
+			path:         "/containers/create",
+			body:         `{"Image":"evil.io/miner"}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			desc:          "pull to another registry with mirror credentials",
+			path:          "/images/create?fromImage=nginx&tag=1.19",
+			auth:          "original",
+			expectedCode:  http.StatusOK,
+			expectedQuery: "fromImage=mirror.local%2Fhub%2Flibrary%2Fnginx&tag=sha256%3A1234",
+			expectedAuth:  base64.URLEncoding.EncodeToString(mirrorAuth),
+		},
+		{
+			desc:          "pull to another registry without credentials",
+			path:          "/images/create?fromImage=quay.io%2Fcoreos%2Fetcd%3Av3.4",
+			auth:          "original",
+			expectedCode:  http.StatusOK,
+			expectedQuery: "fromImage=mirror.local%2Fquay%2Fcoreos%2Fetcd&tag=v3.4",
+		},
+		{
+			desc:          "pull to the same registry",
+			path:          "/images/create?fromImage=busybox&tag=1.32",
+			auth:          "original",
+			expectedCode:  http.StatusOK,
+			expectedQuery: "fromImage=docker.io%2Fmirrored%2Fbusybox&tag=1.32",
+			expectedAuth:  "original",
+		},
+		{
+			desc:          "pull unchanged",
+			path:          "/images/create?fromImage=gcr.io%2Fpause&tag=3.1",
+			auth:          "original",
+			expectedCode:  http.StatusOK,
+			expectedQuery: "fromImage=gcr.io%2Fpause&tag=3.1",
+			expectedAuth:  "original",
+		},
+		{
+			desc:         "pull from denied registry",
+			path:         "/images/create?fromImage=evil.io%2Fminer",
+			expectedCode: http.StatusForbidden,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(c.body))
+		if len(c.auth) > 0 {
+			req.Header.Set(headerRegistryAuth, c.auth)
+		}
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, req)
+		if ans.Code != c.expectedCode {
+			t.Errorf("%s: expect status code %d to be %d, %s", c.desc, ans.Code, c.expectedCode, ans.Body.String())
+			continue
+		}
+		if ans.Code != http.StatusOK {
+			continue
+		}
+
+		got := <-requests
+		if strings.HasPrefix(c.path, "/images") && got.query != c.expectedQuery {
+			t.Errorf("%s: expect query %s to be %s", c.desc, got.query, c.expectedQuery)
+		}
+		if got.auth != c.expectedAuth {
+			t.Errorf("%s: expect registry auth %q to be %q", c.desc, got.auth, c.expectedAuth)
+		}
+		if got.image != c.expectedImage {
+			t.Errorf("%s: expect image %s to be %s", c.desc, got.image, c.expectedImage)
+		}
+	}
+}
+
+func TestImageRewriteAllowedRegistries(t *testing.T) {
+	hm, requests := newTestManager(t, &Options{AllowedRegistries: []string{"index.docker.io"}})
+
+	for image, expectedCode := range map[string]int{
+		"nginx":              http.StatusOK,
+		"docker.io/user/app": http.StatusOK,
+		"gcr.io/pause":       http.StatusForbidden,
+	} {
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create",
+			strings.NewReader(`{"Image":"`+image+`"}`)))
+		if ans.Code != expectedCode {
+			t.Errorf("%s: expect status code %d to be %d", image, ans.Code, expectedCode)
+		}
+		if ans.Code == http.StatusOK {
+			if got := <-requests; got.image != image {
+				t.Errorf("%s: expect image %s not to be rewritten", image, got.image)
+			}
+		}
+	}
+}
+
+func TestImageRewriteTagsPull(t *testing.T) {
+	docker := test.NewFakeDocker()
+	ir, err := New(Name, &Options{
+		Mirrors: []Mirror{{Prefix: "docker.io/", Replacement: "mirror.local/hub/"}},
+	}, docker)
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+
+	hm := hook.NewManager(hook.WithBackend(docker), hook.WithSystemd(false))
+	if err := hm.RegisterHook(hook.HookRegistration{
+		Name:    Name,
+		Handler: ir,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/images/create", Type: componentconfig.PreHookType},
+			{Method: http.MethodPost, URLPattern: "/images/create", Type: componentconfig.PostHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	for _, c := range []struct {
+		path      string
+		reference string
+	}{
+		{"/v1.40/images/create?fromImage=nginx&tag=1.19", "nginx:1.19"},
+		{"/v1.40/images/create?fromImage=redis", "redis"},
+		{"/v1.40/images/create?fromImage=quay.io%2Fcoreos%2Fetcd%3Av3.4", "quay.io/coreos/etcd:v3.4"},
+	} {
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, c.path, nil))
+		if ans.Code != http.StatusOK {
+			t.Fatalf("%s: expect status code %d to be %d, %s", c.path, ans.Code, http.StatusOK, ans.Body.String())
+		}
+
+		ans = httptest.NewRecorder()
+		docker.ServeHTTP(ans, httptest.NewRequest(http.MethodGet, "/v1.40/images/"+c.reference+"/json", nil))
+		if ans.Code != http.StatusOK {
+			t.Errorf("%s: expect image %s to be found, status code %d", c.path, c.reference, ans.Code)
+		}
+	}
+
+	images := docker.Images()
+	if len(images) != 3 {
+		t.Fatalf("expect 3 images, got %+v", images)
+	}
+	expected := []string{"mirror.local/hub/library/nginx:1.19", "nginx:1.19"}
+	if got := images[0].References; strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expect references %v to be %v", got, expected)
+	}
+	// the image pulled from the original registry is not tagged again
+	if got := images[2].References; len(got) != 1 {
+		t.Errorf("expect image %v not to be tagged", got)
+	}
+}
@@ -0,0 +1,99 @@
+package imagerewrite
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultDomain    = "docker.io"
+	legacyDomain     = "index.docker.io"
+	officialRepoPath = "library/"
+)
+
+// reference is an image reference normalized as Docker does, e.g. nginx is docker.io/library/nginx:latest
+type reference struct {
+	// Name is the repository with its registry domain
+	Name   string
+	Tag    string
+	Digest string
+}
+
+// parseReference normalizes an image reference, the tag is latest if neither a tag nor a digest is given
+func parseReference(s string) (*reference, error) {
+	if len(s) == 0 || strings.ContainsAny(s, " \t\n") || s != strings.TrimSpace(s) {
+		return nil, fmt.Errorf("invalid image reference %q", s)
+	}
+
+	ref := &reference{}
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, ref.Digest = s[:i], s[i+1:]
+		if !strings.Contains(ref.Digest, ":") {
+			return nil, fmt.Errorf("invalid digest of image reference %q", s)
+		}
+	}
+
+	// the tag is after the last colon which is not a part of the registry host
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		s, ref.Tag = s[:i], s[i+1:]
+		if len(ref.Tag) == 0 {
+			return nil, fmt.Errorf("empty tag of image reference %q", s)
+		}
+	}
+
+	if len(s) == 0 || strings.HasSuffix(s, "/") || strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid repository of image reference %q", s)
+	}
+
+	domain, path := splitDomain(s)
+	if domain == defaultDomain && !strings.Contains(path, "/") {
+		path = officialRepoPath + path
+	}
+	ref.Name = domain + "/" + strings.ToLower(path)
+
+	if len(ref.Tag) == 0 && len(ref.Digest) == 0 {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// splitDomain splits the registry domain of a repository, the first component is a domain if it has a dot or a port,
+// or it's localhost
+func splitDomain(name string) (string, string) {
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return defaultDomain, name
+	}
+
+	first := name[:i]
+	if !strings.ContainsAny(first, ".:") && first != "localhost" && strings.ToLower(first) == first {
+		return defaultDomain, name
+	}
+
+	if first == legacyDomain {
+		first = defaultDomain
+	}
+	return first, name[i+1:]
+}
+
+// Domain returns the registry of the reference
+func (r *reference) Domain() string {
+	return r.Name[:strings.Index(r.Name, "/")]
+}
+
+// NameTag returns the repository with the tag, which is the key of the digest lookup
+func (r *reference) NameTag() string {
+	return r.Name + ":" + r.Tag
+}
+
+func (r *reference) String() string {
+	s := r.Name
+	if len(r.Tag) > 0 {
+		s += ":" + r.Tag
+	}
+	if len(r.Digest) > 0 {
+		s += "@" + r.Digest
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package imagerewrite
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	for _, c := range []struct {
+		image    string
+		expected string
+		domain   string
+		invalid  bool
+	}{
+		{image: "nginx", expected: "docker.io/library/nginx:latest", domain: "docker.io"},
+		{image: "nginx:1.19", expected: "docker.io/library/nginx:1.19", domain: "docker.io"},
+		{image: "user/app", expected: "docker.io/user/app:latest", domain: "docker.io"},
+		{image: "index.docker.io/user/app:v1", expected: "docker.io/user/app:v1", domain: "docker.io"},
+		{image: "localhost/app", expected: "localhost/app:latest", domain: "localhost"},
+		{image: "registry:5000/app:v1", expected: "registry:5000/app:v1", domain: "registry:5000"},
+		{image: "gcr.io/pause@sha256:abc", expected: "gcr.io/pause@sha256:abc", domain: "gcr.io"},
+		{image: "gcr.io/pause:3.1@sha256:abc", expected: "gcr.io/pause:3.1@sha256:abc", domain: "gcr.io"},
+		{image: "", invalid: true},
+		{image: "nginx:", invalid: true},
+		{image: "nginx@abc", invalid: true},
+		{image: "gcr.io/", invalid: true},
+	} {
+		ref, err := parseReference(c.image)
+		if c.invalid {
+			if err == nil {
+				t.Errorf("%q: expect an error, got %s", c.image, ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.image, err)
+			continue
+		}
+		if ref.String() != c.expected || ref.Domain() != c.domain {
+			t.Errorf("%q: expect %s of %s to be %s of %s", c.image, ref, ref.Domain(), c.expected, c.domain)
+		}
+	}
+}
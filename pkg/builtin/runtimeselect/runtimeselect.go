@@ -0,0 +1,340 @@
+// Package runtimeselect is a builtin hook selecting the OCI runtime of the created containers, e.g. a sandboxed
+// runtime for untrusted pods on nodes where RuntimeClass is not available through dockershim
+package runtimeselect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+)
+
+// Name is the builtin name of the hook
+const Name = "runtime-select"
+
+// What a rule does if its runtime is not installed
+const (
+	// MissingFail denies the create
+	MissingFail = "Fail"
+	// MissingFallback creates the container with the fallback runtime of the rule
+	MissingFallback = "Fallback"
+)
+
+const defaultInfoTTL = time.Minute
+
+func init() {
+	hook.RegisterBuiltin(Name, func(cfg *hook.BuiltinConfig) (hook.HookHandler, error) {
+		opts := &Options{}
+		if len(cfg.Options) > 0 {
+			if err := json.Unmarshal(cfg.Options, opts); err != nil {
+				return nil, fmt.Errorf("can't decode options, %v", err)
+			}
+		}
+		return New(cfg.Name, opts, cfg.Backend)
+	})
+}
+
+// Options are the rules of the hook, the first rule matching a container selects its runtime
+type Options struct {
+	Rules []Rule `json:"rules"`
+	// InfoTTL is how long the runtimes reported by /info of the backend are kept, it's 1m by default
+	InfoTTL metav1.Duration `json:"infoTTL,omitempty"`
+}
+
+// Rule selects a runtime for the containers matching both the selector and the images
+type Rule struct {
+	// Selector is a label selector of the containers, all the containers are matched if it's empty. Kubelet sets the
+	// annotations of a pod as labels prefixed with annotation.
+	Selector string `json:"selector,omitempty"`
+	// Images are the patterns of path.Match of the image, all the images are matched if it's empty. Kubelet creates
+	// the containers by image IDs
+	Images  []string `json:"images,omitempty"`
+	Runtime string   `json:"runtime"`
+	// SecurityOpt and Annotations are added to the HostConfig if the runtime is selected
+	SecurityOpt []string          `json:"securityOpt,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// OnMissing is Fail or Fallback, it's Fail by default
+	OnMissing string `json:"onMissing,omitempty"`
+	// FallbackRuntime is used if the runtime is not installed and OnMissing is Fallback, the default runtime of the
+	// backend is used if it's empty
+	FallbackRuntime string `json:"fallbackRuntime,omitempty"`
+}
+
+type rule struct {
+	Rule
+	selector labels.Selector
+}
+
+// RuntimeSelect is the hook selecting the runtimes
+type RuntimeSelect struct {
+	name    string
+	rules   []rule
+	backend http.Handler
+	infoTTL time.Duration
+
+	lock      sync.Mutex
+	runtimes  map[string]bool
+	fetchedAt time.Time
+	// fetching is the running fetch of the runtimes, the concurrent creates wait for it instead of fetching again
+	fetching *fetchCall
+}
+
+type fetchCall struct {
+	done     chan struct{}
+	runtimes map[string]bool
+	err      error
+}
+
+var _ hook.HookHandler = (*RuntimeSelect)(nil)
+
+// New returns the hook named name, the installed runtimes are got from /info of backend
+func New(name string, opts *Options, backend http.Handler) (*RuntimeSelect, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("no backend")
+	}
+
+	rs := &RuntimeSelect{
+		name:    name,
+		backend: backend,
+		infoTTL: opts.InfoTTL.Duration,
+	}
+	if rs.infoTTL <= 0 {
+		rs.infoTTL = defaultInfoTTL
+	}
+
+	for i, r := range opts.Rules {
+		if len(r.Runtime) == 0 {
+			return nil, fmt.Errorf("rule %d has no runtime", i)
+		}
+
+		switch r.OnMissing {
+		case "":
+			r.OnMissing = MissingFail
+		case MissingFail, MissingFallback:
+		default:
+			return nil, fmt.Errorf("unknown onMissing %s of rule %d", r.OnMissing, i)
+		}
+
+		selector, err := labels.Parse(r.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q of rule %d, %v", r.Selector, i, err)
+		}
+
+		for _, pattern := range r.Images {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid image pattern %q of rule %d, %v", pattern, i, err)
+			}
+		}
+
+		rs.rules = append(rs.rules, rule{Rule: r, selector: selector})
+	}
+
+	return rs, nil
+}
+
+func (rs *RuntimeSelect) PreHook(ctx context.Context, patch *hook.PatchData, method, urlPath string,
+	body []byte) error {
+	if method != http.MethodPost || hook.UnversionedPath(urlPath) != "/containers/create" {
+		return nil
+	}
+
+	config := struct {
+		Image      string            `json:"Image"`
+		Labels     map[string]string `json:"Labels"`
+		HostConfig struct {
+			Runtime     string   `json:"Runtime"`
+			SecurityOpt []string `json:"SecurityOpt"`
+		} `json:"HostConfig"`
+	}{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return fmt.Errorf("can't decode create body, %v", err)
+	}
+
+	// the runtime given by the client is kept
+	if len(config.HostConfig.Runtime) > 0 {
+		return nil
+	}
+
+	r := rs.match(config.Image, config.Labels)
+	if r == nil {
+		return nil
+	}
+
+	installed, err := rs.installed(ctx, r.Runtime)
+	if err != nil {
+		return err
+	}
+
+	hostConfig := map[string]interface{}{}
+	if installed {
+		klog.V(4).Infof("Select runtime %s for image %s", r.Runtime, config.Image)
+		hostConfig["Runtime"] = r.Runtime
+		if len(r.SecurityOpt) > 0 {
+			// SecurityOpt is replaced as a whole by the merge patch
+			hostConfig["SecurityOpt"] = appendMissing(config.HostConfig.SecurityOpt, r.SecurityOpt)
+		}
+		if len(r.Annotations) > 0 {
+			hostConfig["Annotations"] = r.Annotations
+		}
+	} else {
+		if r.OnMissing == MissingFail {
+			return &hook.DeniedError{Hook: rs.name, Message: fmt.Sprintf("runtime %s is not installed", r.Runtime)}
+		}
+
+		if len(r.FallbackRuntime) == 0 {
+			klog.Warningf("Runtime %s is not installed, fall back to the default runtime for image %s", r.Runtime,
+				config.Image)
+			return nil
+		}
+
+		fallback, err := rs.installed(ctx, r.FallbackRuntime)
+		if err != nil {
+			return err
+		}
+		if !fallback {
+			return &hook.DeniedError{Hook: rs.name, Message: fmt.Sprintf("runtime %s and fallback %s are not installed",
+				r.Runtime, r.FallbackRuntime)}
+		}
+		klog.Warningf("Runtime %s is not installed, fall back to %s for image %s", r.Runtime, r.FallbackRuntime,
+			config.Image)
+		hostConfig["Runtime"] = r.FallbackRuntime
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"HostConfig": hostConfig})
+	if err != nil {
+		return err
+	}
+	patch.PatchType = string(types.MergePatchType)
+	patch.PatchData = data
+	return nil
+}
+
+func (rs *RuntimeSelect) PostHook(ctx context.Context, patch *hook.PatchData, method, path string,
+	body []byte) error {
+	return nil
+}
+
+// match returns the first rule matching the container
+func (rs *RuntimeSelect) match(image string, containerLabels map[string]string) *rule {
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if !r.selector.Matches(labels.Set(containerLabels)) {
+			continue
+		}
+
+		matched := len(r.Images) == 0
+		for _, pattern := range r.Images {
+			if ok, _ := path.Match(pattern, image); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			return r
+		}
+	}
+	return nil
+}
+
+// installed returns whether the runtime is reported by /info of the backend. The runtimes are fetched again if they
+// are older than infoTTL, or the runtime is not found, so a runtime installed later is used without a restart. The
+// backend is requested without the lock, and only once for the concurrent creates
+func (rs *RuntimeSelect) installed(ctx context.Context, runtime string) (bool, error) {
+	for {
+		rs.lock.Lock()
+		if rs.runtimes != nil && time.Since(rs.fetchedAt) < rs.infoTTL && rs.runtimes[runtime] {
+			rs.lock.Unlock()
+			return true, nil
+		}
+
+		// a missing runtime is checked at most once a second
+		if rs.runtimes != nil && time.Since(rs.fetchedAt) < time.Second {
+			found := rs.runtimes[runtime]
+			rs.lock.Unlock()
+			return found, nil
+		}
+
+		call := rs.fetching
+		if call == nil {
+			call = &fetchCall{done: make(chan struct{})}
+			rs.fetching = call
+			rs.lock.Unlock()
+
+			call.runtimes, call.err = rs.fetch(ctx)
+			rs.lock.Lock()
+			if call.err == nil {
+				rs.runtimes, rs.fetchedAt = call.runtimes, time.Now()
+			}
+			rs.fetching = nil
+			rs.lock.Unlock()
+			close(call.done)
+		} else {
+			rs.lock.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+
+		switch {
+		case (call.err == context.Canceled || call.err == context.DeadlineExceeded) && ctx.Err() == nil:
+			// the fetch of another create is canceled with its request, the runtimes are fetched again
+			continue
+		case call.err != nil:
+			return false, call.err
+		}
+		return call.runtimes[runtime], nil
+	}
+}
+
+func (rs *RuntimeSelect) fetch(ctx context.Context) (map[string]bool, error) {
+	recorder := httptest.NewRecorder()
+	rs.backend.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/info", nil).WithContext(ctx))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if recorder.Code != http.StatusOK {
+		return nil, fmt.Errorf("can't get runtimes of backend, status code is %d", recorder.Code)
+	}
+
+	info := struct {
+		Runtimes map[string]json.RawMessage `json:"Runtimes"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("can't decode info of backend, %v", err)
+	}
+
+	runtimes := make(map[string]bool, len(info.Runtimes))
+	for name := range info.Runtimes {
+		runtimes[name] = true
+	}
+	klog.V(4).Infof("Backend runtimes %v", runtimes)
+	return runtimes, nil
+}
+
+func appendMissing(list, items []string) []string {
+	ret := append([]string(nil), list...)
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		seen[s] = true
+	}
+	for _, s := range items {
+		if !seen[s] {
+			ret = append(ret, s)
+			seen[s] = true
+		}
+	}
+	return ret
+}
@@ -0,0 +1,201 @@
+package runtimeselect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/hook"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+func TestRuntimeSelect(t *testing.T) {
+	docker := test.NewFakeDocker()
+	docker.SetRuntimes("kata")
+
+	rs, err := New(Name, &Options{
+		Rules: []Rule{
+			{
+				Selector:    "annotation.io.kubernetes.cri.untrusted-workload=true",
+				Runtime:     "kata",
+				SecurityOpt: []string{"seccomp=unconfined"},
+				Annotations: map[string]string{"io.katacontainers.config.hypervisor.default_memory": "512"},
+			},
+			{Images: []string{"untrusted/*"}, Runtime: "runsc", OnMissing: MissingFallback, FallbackRuntime: "kata"},
+			{Images: []string{"gpu/*"}, Runtime: "nvidia", OnMissing: MissingFallback},
+			{Images: []string{"secure/*"}, Runtime: "runsc"},
+		},
+	}, docker)
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+
+	hm := hook.NewManager(hook.WithBackend(docker), hook.WithSystemd(false))
+	if err := hm.RegisterHook(hook.HookRegistration{
+		Name:    Name,
+		Handler: rs,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	for _, c := range []struct {
+		desc                string
+		body                string
+		expectedCode        int
+		expectedRuntime     interface{}
+		expectedSecurityOpt interface{}
+	}{
+		{
+			desc: "selected by label",
+			body: `{"Image":"busybox","Labels":{"annotation.io.kubernetes.cri.untrusted-workload":"true"},` +
+				`"HostConfig":{"SecurityOpt":["no-new-privileges"]}}`,
+			expectedCode:        http.StatusCreated,
+			expectedRuntime:     "kata",
+			expectedSecurityOpt: []interface{}{"no-new-privileges", "seccomp=unconfined"},
+		},
+		{
+			desc: "runtime of client is kept",
+			body: `{"Image":"busybox","Labels":{"annotation.io.kubernetes.cri.untrusted-workload":"true"},` +
+				`"HostConfig":{"Runtime":"runc"}}`,
+			expectedCode:    http.StatusCreated,
+			expectedRuntime: "runc",
+		},
+		{
+			desc:            "fallback runtime",
+			body:            `{"Image":"untrusted/app"}`,
+			expectedCode:    http.StatusCreated,
+			expectedRuntime: "kata",
+		},
+		{
+			desc:         "fallback to default runtime",
+			body:         `{"Image":"gpu/cuda"}`,
+			expectedCode: http.StatusCreated,
+		},
+		{
+			desc:         "missing runtime",
+			body:         `{"Image":"secure/app"}`,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			desc:         "not matched",
+			body:         `{"Image":"busybox"}`,
+			expectedCode: http.StatusCreated,
+		},
+	} {
+		before := len(docker.Containers())
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/v1.40/containers/create", strings.NewReader(c.body)))
+		if ans.Code != c.expectedCode {
+			t.Errorf("%s: expect status code %d to be %d, %s", c.desc, ans.Code, c.expectedCode, ans.Body.String())
+			continue
+		}
+		if ans.Code != http.StatusCreated {
+			continue
+		}
+
+		containers := docker.Containers()
+		if len(containers) != before+1 {
+			t.Fatalf("%s: expect a container to be created", c.desc)
+		}
+		hostConfig := containers[len(containers)-1].HostConfig
+		if hostConfig["Runtime"] != c.expectedRuntime {
+			t.Errorf("%s: expect runtime %v to be %v", c.desc, hostConfig["Runtime"], c.expectedRuntime)
+		}
+		if c.expectedSecurityOpt != nil && !reflect.DeepEqual(hostConfig["SecurityOpt"], c.expectedSecurityOpt) {
+			t.Errorf("%s: expect security options %v to be %v", c.desc, hostConfig["SecurityOpt"],
+				c.expectedSecurityOpt)
+		}
+	}
+}
+
+func TestRuntimeSelectInstalledLater(t *testing.T) {
+	docker := test.NewFakeDocker()
+	rs, err := New(Name, &Options{Rules: []Rule{{Runtime: "kata"}}}, docker)
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+
+	if installed, err := rs.installed(context.Background(), "kata"); err != nil || installed {
+		t.Fatalf("expect kata not to be installed, %v", err)
+	}
+
+	docker.SetRuntimes("kata")
+	// the missing runtime is checked again after a second
+	rs.fetchedAt = rs.fetchedAt.Add(-2 * time.Second)
+	if installed, err := rs.installed(context.Background(), "kata"); err != nil || !installed {
+		t.Fatalf("expect kata to be installed, %v", err)
+	}
+}
+
+func TestRuntimeSelectInvalid(t *testing.T) {
+	docker := test.NewFakeDocker()
+	for desc, opts := range map[string]*Options{
+		"no runtime":        {Rules: []Rule{{}}},
+		"unknown onMissing": {Rules: []Rule{{Runtime: "kata", OnMissing: "Retry"}}},
+		"invalid selector":  {Rules: []Rule{{Runtime: "kata", Selector: "a in b"}}},
+		"invalid pattern":   {Rules: []Rule{{Runtime: "kata", Images: []string{"["}}}},
+	} {
+		if _, err := New(Name, opts, docker); err == nil {
+			t.Errorf("%s: expect an error", desc)
+		}
+	}
+
+	if _, err := New(Name, &Options{}, nil); err == nil {
+		t.Errorf("expect an error without backend")
+	}
+}
+
+func TestRuntimeSelectFetchOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-release:
+			w.Write([]byte(`{"Runtimes":{"kata":{}}}`))
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	rs, err := New(Name, &Options{Rules: []Rule{{Runtime: "kata"}}}, backend)
+	if err != nil {
+		t.Fatalf("can't create hook: %v", err)
+	}
+
+	// a slow backend fails the create by its context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := rs.installed(ctx, "kata"); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if installed, err := rs.installed(context.Background(), "kata"); err != nil || !installed {
+				t.Errorf("expect kata to be installed, %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("expect info to be fetched once, got %d", calls)
+	}
+}
@@ -0,0 +1,67 @@
+package hook
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionedPathRegexp = regexp.MustCompile(`^/v([0-9]+\.[0-9]+)(/.*)$`)
+
+// splitVersionedPath splits /vX.Y/foo to X.Y and /foo, an empty version is returned if the path is not versioned
+func splitVersionedPath(path string) (string, string) {
+	m := versionedPathRegexp.FindStringSubmatch(path)
+	if m == nil {
+		return "", path
+	}
+
+	return m[1], m[2]
+}
+
+// UnversionedPath returns the path without the API version prefix
+func UnversionedPath(path string) string {
+	_, unversioned := splitVersionedPath(path)
+	return unversioned
+}
+
+func parseAPIVersion(v string) (int, int, error) {
+	seps := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 2)
+	if len(seps) != 2 {
+		return 0, 0, fmt.Errorf("malformed API version %q", v)
+	}
+
+	major, err := strconv.Atoi(seps[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed API version %q", v)
+	}
+
+	minor, err := strconv.Atoi(seps[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed API version %q", v)
+	}
+
+	return major, minor, nil
+}
+
+// compareAPIVersion returns -1, 0, 1 if a is older than, same as, newer than b, malformed versions are treated as
+// 0.0
+func compareAPIVersion(a, b string) int {
+	aMajor, aMinor, _ := parseAPIVersion(a)
+	bMajor, bMinor, _ := parseAPIVersion(b)
+
+	switch {
+	case aMajor != bMajor:
+		if aMajor < bMajor {
+			return -1
+		}
+		return 1
+	case aMinor != bMinor:
+		if aMinor < bMinor {
+			return -1
+		}
+		return 1
+	}
+
+	return 0
+}
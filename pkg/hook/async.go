@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	errAsyncQueueFull   = errors.New("queue is full")
+	errAsyncQueueClosed = errors.New("queue is closed")
+)
+
+// asyncQueue runs jobs by a fixed number of workers, jobs are dropped if the queue is full
+type asyncQueue struct {
+	// lock keeps jobs from being added while the queue is closing
+	lock    sync.RWMutex
+	closed  bool
+	jobs    chan func()
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+func newAsyncQueue(workers, size int) *asyncQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	q := &asyncQueue{
+		jobs: make(chan func(), size),
+		stop: make(chan struct{}),
+	}
+
+	q.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+
+	return q
+}
+
+func (q *asyncQueue) worker() {
+	defer q.workers.Done()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case job, ok := <-q.jobs:
+			if !ok {
+				return
+			}
+			job()
+		}
+	}
+}
+
+// add queues the job without blocking, errAsyncQueueFull is returned if the queue is full, and errAsyncQueueClosed
+// if it's closed
+func (q *asyncQueue) add(job func()) error {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	if q.closed {
+		return errAsyncQueueClosed
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		klog.Warningf("Async queue is full, %d jobs are waiting", len(q.jobs))
+		return errAsyncQueueFull
+	}
+}
+
+// close stops accepting jobs, and waits for the queued jobs until timeout. The number of the jobs which are not run
+// is returned
+func (q *asyncQueue) close(timeout time.Duration) int {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return 0
+	}
+	q.closed = true
+	close(q.jobs)
+	q.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return 0
+	case <-timer.C:
+	}
+
+	// the jobs left are dropped, the running ones are not waited
+	close(q.stop)
+	dropped := 0
+	for range q.jobs {
+		dropped++
+	}
+	return dropped
+}
@@ -0,0 +1,77 @@
+package hook
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestAsyncQueueClose(t *testing.T) {
+	q := newAsyncQueue(1, 4)
+	var ran int32
+	for i := 0; i < 3; i++ {
+		if err := q.add(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&ran, 1)
+		}); err != nil {
+			t.Fatalf("can't add job: %v", err)
+		}
+	}
+
+	if dropped := q.close(5 * time.Second); dropped != 0 {
+		t.Errorf("expect no job to be dropped, got %d", dropped)
+	}
+	if atomic.LoadInt32(&ran) != 3 {
+		t.Errorf("expect the queued jobs to run before close returns, %d ran", ran)
+	}
+	if err := q.add(func() {}); err != errAsyncQueueClosed {
+		t.Errorf("expect a job added after close to be rejected, got %v", err)
+	}
+
+	q = newAsyncQueue(1, 4)
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 4; i++ {
+		if err := q.add(func() { <-block }); err != nil {
+			t.Fatalf("can't add job: %v", err)
+		}
+	}
+	// the worker is blocked by the first job, so the queue has room for one more
+	time.Sleep(10 * time.Millisecond)
+	if err := q.add(func() {}); err != nil {
+		t.Fatalf("can't add job: %v", err)
+	}
+	if err := q.add(func() {}); err != errAsyncQueueFull {
+		t.Errorf("expect a job added to a full queue to be rejected, got %v", err)
+	}
+
+	if dropped := q.close(10 * time.Millisecond); dropped != 4 {
+		t.Errorf("expect the 4 jobs left to be dropped, got %d", dropped)
+	}
+}
+
+func TestManagerQueueAsyncAfterInit(t *testing.T) {
+	hm := NewManager(WithBackend(http.NotFoundHandler()), WithSystemd(false))
+	old := hm.asyncQueue
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{Timeout: 1, AsyncWorkers: 1,
+		AsyncQueueSize: 1}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+
+	done := make(chan struct{})
+	if err := hm.queueAsync(func() { close(done) }); err != nil {
+		t.Fatalf("can't queue job: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expect the job to run on the new queue")
+	}
+
+	if err := old.add(func() {}); err != errAsyncQueueClosed {
+		t.Errorf("expect the replaced queue to be closed, got %v", err)
+	}
+}
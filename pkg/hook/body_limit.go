@@ -0,0 +1,149 @@
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+// minBodyLimit returns the smaller limit, 0 is unlimited
+func minBodyLimit(a, b int64) int64 {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// canBypass returns whether the hooks can be bypassed if a body is too large, which needs the failures of all the
+// hooks to be ignored and the request not to be translated, since the client can't read a body of another API version
+func canBypass(translation *apiTranslation, hooks ...[]*hookHandle) bool {
+	if translation != nil {
+		return false
+	}
+	for _, hs := range hooks {
+		for _, h := range hs {
+			if h.failurePolicy != componentconfig.PolicyIgnore {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// limitRequestBody reads at most limit bytes of the request body, and returns false if the body is larger. The body of
+// r is replaced so it can be read again, a larger body is not buffered beyond limit, and it's streamed if it's read
+func limitRequestBody(r *http.Request, limit int64) (bool, error) {
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true, nil
+	}
+
+	if r.ContentLength > limit {
+		return false, nil
+	}
+
+	buffered, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return false, err
+	}
+
+	if int64(len(buffered)) > limit {
+		r.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(buffered), r.Body), Closer: r.Body}
+		return false, nil
+	}
+
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(buffered))
+	return true, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedRecorder buffers the response of the backend for post hooks up to limit bytes. If the response is larger, it's
+// streamed to w if bypass is set, otherwise it's discarded
+type limitedRecorder struct {
+	*httptest.ResponseRecorder
+	w      http.ResponseWriter
+	limit  int64
+	bypass bool
+
+	wroteHeader bool
+	// exceeded is set if the response is larger than limit
+	exceeded bool
+}
+
+func newLimitedRecorder(w http.ResponseWriter, limit int64, bypass bool) *limitedRecorder {
+	return &limitedRecorder{ResponseRecorder: httptest.NewRecorder(), w: w, limit: limit, bypass: bypass}
+}
+
+func (lr *limitedRecorder) WriteHeader(statusCode int) {
+	if lr.wroteHeader {
+		return
+	}
+	lr.wroteHeader = true
+	lr.ResponseRecorder.WriteHeader(statusCode)
+
+	if length, err := strconv.ParseInt(lr.Header().Get("Content-Length"), 10, 64); err == nil && length > lr.limit {
+		lr.exceed()
+	}
+}
+
+func (lr *limitedRecorder) Write(data []byte) (int, error) {
+	if !lr.wroteHeader {
+		lr.WriteHeader(http.StatusOK)
+	}
+
+	if !lr.exceeded && int64(lr.Body.Len()+len(data)) > lr.limit {
+		lr.exceed()
+	}
+
+	if !lr.exceeded {
+		return lr.ResponseRecorder.Write(data)
+	}
+	if lr.bypass {
+		return lr.w.Write(data)
+	}
+	// the response is dropped, the client gets an error
+	return len(data), nil
+}
+
+// exceed sends the buffered response to w if bypass is set, otherwise it frees the buffered body
+func (lr *limitedRecorder) exceed() {
+	lr.exceeded = true
+	if !lr.bypass {
+		lr.Body = &bytes.Buffer{}
+		return
+	}
+
+	for k, vs := range lr.ResponseRecorder.Header() {
+		for _, v := range vs {
+			lr.w.Header().Add(k, v)
+		}
+	}
+	lr.w.WriteHeader(lr.Code)
+	lr.w.Write(lr.Body.Bytes())
+	lr.Body = &bytes.Buffer{}
+}
+
+func (lr *limitedRecorder) Flush() {
+	if !lr.exceeded || !lr.bypass {
+		return
+	}
+	if f, ok := lr.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// bodyTooLarge writes the 413 error of a body larger than limit
+func bodyTooLarge(w http.ResponseWriter, name string, limit int64) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	w.Write([]byte(fmt.Sprintf("%s body is larger than %d bytes", name, limit)))
+}
@@ -0,0 +1,176 @@
+package hook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestBodyLimit(t *testing.T) {
+	response := strings.Repeat("r", 64)
+	testUnits := []struct {
+		name          string
+		failurePolicy componentconfig.FailurePolicyType
+		body          string
+		chunked       bool
+		maxRequest    int64
+		maxResponse   int64
+		code          int
+		backendBody   string
+		preHooked     bool
+		postHooked    bool
+	}{
+		{
+			name:        "within",
+			body:        `{"a":1}`,
+			maxRequest:  16,
+			maxResponse: 64,
+			code:        http.StatusOK,
+			backendBody: `{"a":1}`,
+			preHooked:   true,
+			postHooked:  true,
+		},
+		{
+			name:       "request-rejected",
+			body:       strings.Repeat("a", 32),
+			maxRequest: 16,
+			code:       http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "chunked-request-rejected",
+			body:       strings.Repeat("a", 32),
+			chunked:    true,
+			maxRequest: 16,
+			code:       http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:          "chunked-request-bypassed",
+			failurePolicy: componentconfig.PolicyIgnore,
+			body:          strings.Repeat("a", 32),
+			chunked:       true,
+			maxRequest:    16,
+			code:          http.StatusOK,
+			backendBody:   strings.Repeat("a", 32),
+		},
+		{
+			name:        "response-rejected",
+			body:        `{}`,
+			maxResponse: 16,
+			code:        http.StatusRequestEntityTooLarge,
+			backendBody: `{}`,
+			preHooked:   true,
+		},
+		{
+			name:          "response-bypassed",
+			failurePolicy: componentconfig.PolicyIgnore,
+			body:          `{}`,
+			maxResponse:   16,
+			code:          http.StatusOK,
+			backendBody:   `{}`,
+			preHooked:     true,
+		},
+	}
+
+	for _, u := range testUnits {
+		var backendBody string
+		hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			backendBody = string(body)
+			w.Write([]byte(response))
+		})), WithSystemd(false))
+
+		var preHooked, postHooked bool
+		failurePolicy := u.failurePolicy
+		if len(failurePolicy) == 0 {
+			failurePolicy = componentconfig.PolicyFail
+		}
+		if err := hm.RegisterHook(HookRegistration{
+			Name: "limited",
+			Handler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					preHooked = true
+					return nil
+				},
+				postHook: func(patch *PatchData, body []byte) error {
+					postHooked = true
+					return nil
+				},
+			},
+			FailurePolicy: failurePolicy,
+			Stages: componentconfig.HookStageList{
+				{Method: http.MethodPost, URLPattern: "/build", Type: componentconfig.PreHookType,
+					MaxRequestBodySize: u.maxRequest},
+				{Method: http.MethodPost, URLPattern: "/build", Type: componentconfig.PostHookType,
+					MaxResponseBodySize: u.maxResponse},
+			},
+		}); err != nil {
+			t.Fatalf("%s: can't register hook: %v", u.name, err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(u.body))
+		if u.chunked {
+			req.ContentLength = -1
+		}
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, req)
+
+		if ans.Code != u.code {
+			t.Errorf("%s: expect status code %d to be %d, body %s", u.name, ans.Code, u.code, ans.Body)
+		}
+		if backendBody != u.backendBody {
+			t.Errorf("%s: expect backend body %q to be %q", u.name, backendBody, u.backendBody)
+		}
+		if preHooked != u.preHooked || postHooked != u.postHooked {
+			t.Errorf("%s: expect hooked %t %t to be %t %t", u.name, preHooked, postHooked, u.preHooked, u.postHooked)
+		}
+		if ans.Code == http.StatusOK && ans.Body.String() != response {
+			t.Errorf("%s: expect response %s to be %s", u.name, ans.Body, response)
+		}
+	}
+}
+
+func TestBodyLimitTranslated(t *testing.T) {
+	response := `{"Id":"abc","Config":{"Env":[]},"HostConfig":{"DeviceRequests":[{"Driver":"nvidia"}]}}`
+	hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.Write([]byte(`{"Version":"24.0.0","ApiVersion":"1.44"}`))
+			return
+		}
+		w.Write([]byte(response))
+	})), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        1,
+		APITranslation: componentconfig.APITranslationConfiguration{Enabled: true, CanonicalAPIVersion: "1.44"},
+	}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+	if err := hm.RegisterHook(HookRegistration{
+		Name:          "limited",
+		Handler:       &fakeHookHandler{},
+		FailurePolicy: componentconfig.PolicyIgnore,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodGet, URLPattern: "/containers/{name:.*}/json", Type: componentconfig.PostHookType,
+				MaxResponseBodySize: 16},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	// the response of the backend version can't be streamed to a client of another version
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodGet, "/v1.39/containers/abc/json", nil))
+	if ans.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expect status code %d to be %d, body %s", ans.Code, http.StatusRequestEntityTooLarge, ans.Body)
+	}
+
+	// the response of the same version is bypassed
+	ans = httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodGet, "/v1.44/containers/abc/json", nil))
+	if ans.Code != http.StatusOK || ans.Body.String() != response {
+		t.Errorf("expect response %d %s to be bypassed", ans.Code, ans.Body)
+	}
+}
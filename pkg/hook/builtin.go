@@ -0,0 +1,114 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// BuiltinConfig is passed to the factory of a builtin hook
+type BuiltinConfig struct {
+	// Name is the name of the webhook in the configuration
+	Name string
+	// Options is the raw JSON of the options of the webhook, it's nil if not set
+	Options []byte
+	// Backend sends requests to the Docker daemon directly, they are not hooked
+	Backend http.Handler
+}
+
+// BuiltinFactory builds a builtin hook from its configuration
+type BuiltinFactory func(cfg *BuiltinConfig) (HookHandler, error)
+
+var (
+	builtinLock      sync.RWMutex
+	builtinFactories = make(map[string]BuiltinFactory)
+)
+
+// RegisterBuiltin makes a Go implementation of HookHandler available as a webhook of type builtin. It's usually called
+// in init, and panics if the name is registered twice
+func RegisterBuiltin(name string, factory BuiltinFactory) {
+	builtinLock.Lock()
+	defer builtinLock.Unlock()
+
+	if factory == nil {
+		panic("hook: RegisterBuiltin factory is nil")
+	}
+
+	if _, found := builtinFactories[name]; found {
+		panic("hook: RegisterBuiltin called twice for " + name)
+	}
+
+	builtinFactories[name] = factory
+}
+
+func newBuiltinHook(builtin string, cfg *BuiltinConfig) (*builtinHook, error) {
+	builtinLock.RLock()
+	factory, found := builtinFactories[builtin]
+	builtinLock.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("unknown builtin hook %s", builtin)
+	}
+
+	h, err := factory(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &builtinHook{name: cfg.Name, handler: h}, nil
+}
+
+// builtinHook runs a builtin hook in-process, the timeout of the request is enforced even if the hook doesn't
+// respect its context
+type builtinHook struct {
+	name    string
+	handler HookHandler
+}
+
+var _ HookHandler = (*builtinHook)(nil)
+
+func (bh *builtinHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return bh.call(ctx, patch, func(p *PatchData) error {
+		return bh.handler.PreHook(ctx, p, method, path, body)
+	})
+}
+
+func (bh *builtinHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return bh.call(ctx, patch, func(p *PatchData) error {
+		return bh.handler.PostHook(ctx, p, method, path, body)
+	})
+}
+
+func (bh *builtinHook) call(ctx context.Context, patch *PatchData, fn func(p *PatchData) error) error {
+	// the patch is not touched by a hook which is timed out, a post hook gets the state of its pre hook
+	p := &PatchData{State: append([]byte(nil), patch.State...)}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(p)
+	}()
+
+	select {
+	case err := <-done:
+		*patch = *p
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("builtin hook %s is timed out, %v", bh.name, ctx.Err())
+	}
+}
+
+// HealthCheck checks the builtin hook if it implements healthChecker
+func (bh *builtinHook) HealthCheck(ctx context.Context) error {
+	if hc, ok := bh.handler.(healthChecker); ok {
+		return hc.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// Close closes the builtin hook if it implements io.Closer
+func (bh *builtinHook) Close() error {
+	if c, ok := bh.handler.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
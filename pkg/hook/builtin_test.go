@@ -0,0 +1,165 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	gjson "encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+type labelHook struct {
+	value string
+	delay time.Duration
+}
+
+func (l *labelHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	time.Sleep(l.delay)
+	patch.PatchType = string(types.MergePatchType)
+	patch.PatchData = []byte(`{"Labels":{"builtin":"` + l.value + `"}}`)
+	return nil
+}
+
+func (l *labelHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return nil
+}
+
+func init() {
+	RegisterBuiltin("test-label", func(cfg *BuiltinConfig) (HookHandler, error) {
+		opts := struct {
+			Value string        `json:"value"`
+			Delay time.Duration `json:"delay"`
+		}{}
+		if err := gjson.Unmarshal(cfg.Options, &opts); err != nil {
+			return nil, err
+		}
+		return &labelHook{value: opts.Value, delay: opts.Delay}, nil
+	})
+}
+
+func TestHookManagerBuiltinHook(t *testing.T) {
+	bodies := make(chan string, 1)
+	backendServer := test.NewUnixSocketServer()
+	backendServer.RegisterHandler("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		backendServer.Start()
+	}()
+	defer backendServer.Stop()
+	<-ready
+
+	stages := componentconfig.HookStageList{
+		{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+	}
+
+	for _, u := range []struct {
+		options  string
+		policy   componentconfig.FailurePolicyType
+		code     int
+		expected string
+	}{
+		{`{"value":"a"}`, componentconfig.PolicyFail, http.StatusCreated, `{"Image":"busybox","Labels":{"builtin":"a"}}`},
+		{`{"value":"a","delay":5000000000}`, componentconfig.PolicyFail, http.StatusInternalServerError, ""},
+		{`{"value":"a","delay":5000000000}`, componentconfig.PolicyIgnore, http.StatusCreated, `{"Image":"busybox"}`},
+	} {
+		cfg := &componentconfig.HookConfiguration{
+			Timeout:        1,
+			ListenAddress:  "unix:///tmp/lighthouse-builtin.sock",
+			RemoteEndpoint: backendServer.GetAddress(),
+			WebHooks: componentconfig.HookConfigurationList{
+				{
+					Name:          "label",
+					Type:          componentconfig.BuiltinWebHook,
+					Builtin:       "test-label",
+					Options:       runtime.RawExtension{Raw: []byte(u.options)},
+					FailurePolicy: u.policy,
+					Stages:        stages,
+				},
+			},
+		}
+
+		hm := NewHookManager()
+		if err := hm.InitFromConfig(cfg); err != nil {
+			t.Fatalf("can't init hook manager: %v", err)
+		}
+
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create",
+			bytes.NewBufferString(`{"Image":"busybox"}`)))
+		if ans.Code != u.code {
+			t.Errorf("expect status code %d of options %s to be %d", ans.Code, u.options, u.code)
+		}
+
+		if len(u.expected) == 0 {
+			continue
+		}
+
+		if body := <-bodies; body != u.expected {
+			t.Errorf("expect body %s of options %s to be %s", body, u.options, u.expected)
+		}
+	}
+
+	cfg := &componentconfig.HookConfiguration{
+		RemoteEndpoint: backendServer.GetAddress(),
+		WebHooks: componentconfig.HookConfigurationList{
+			{Name: "unknown", Type: componentconfig.BuiltinWebHook, Builtin: "not-exist"},
+		},
+	}
+	if err := NewHookManager().InitFromConfig(cfg); err == nil {
+		t.Errorf("expect unknown builtin hook to be rejected")
+	}
+}
+
+type stateHook struct {
+	states chan string
+}
+
+func (s *stateHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	patch.State = []byte("ticket-1")
+	return nil
+}
+
+func (s *stateHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	s.states <- string(patch.State)
+	return nil
+}
+
+func TestBuiltinHookState(t *testing.T) {
+	states := make(chan string, 1)
+	hm := NewManager(WithBackend(test.NewFakeDocker()), WithSystemd(false))
+	if err := hm.RegisterHook(HookRegistration{
+		Name:    "state",
+		Handler: &builtinHook{name: "state", handler: &stateHook{states: states}},
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PostHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create",
+		bytes.NewBufferString(`{"Image":"busybox"}`)))
+	if ans.Code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be %d, %s", ans.Code, http.StatusCreated, ans.Body.String())
+	}
+	if state := <-states; state != "ticket-1" {
+		t.Errorf("expect post hook to get the state of pre hook, got %q", state)
+	}
+}
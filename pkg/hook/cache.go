@@ -0,0 +1,148 @@
+package hook
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+type cacheKey [sha256.Size]byte
+
+// newCacheKey hashes the inputs of a hook call. The status code, the request body and the state of the pre hook are
+// only given to post hooks, they are 0 and nil for pre hooks
+func newCacheKey(hookType componentconfig.HookType, method, path string, statusCode int, request, state,
+	body []byte) cacheKey {
+	h := sha256.New()
+	// every field is prefixed by its length, so the concatenation of different fields never collides
+	for _, field := range [][]byte{[]byte(hookType), []byte(method), []byte(path), request, state, body} {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(field)))
+		h.Write(length[:])
+		h.Write(field)
+	}
+	var status [8]byte
+	binary.BigEndian.PutUint64(status[:], uint64(statusCode))
+	h.Write(status[:])
+
+	var key cacheKey
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	patch   PatchData
+	denied  *DeniedError
+	expires time.Time
+}
+
+// hookCache keeps the answers of a hook, the patches and the denials, in memory. It's an LRU of at most maxEntries
+// answers, each one expires after ttl. The cache belongs to a hook handle, so it's dropped with its hook when the
+// configuration is loaded again
+type hookCache struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	metrics    *hookMetrics
+
+	lock    sync.Mutex
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+}
+
+// newHookCache returns nil if ttl is 0, so the answers are not cached
+func newHookCache(name string, config componentconfig.HookCacheConfiguration, metrics *hookMetrics) (*hookCache,
+	error) {
+	if config.TTL.Duration < 0 || config.MaxEntries < 0 {
+		return nil, fmt.Errorf("negative cache limit")
+	}
+
+	if config.TTL.Duration == 0 {
+		return nil, nil
+	}
+
+	if config.MaxEntries == 0 {
+		return nil, fmt.Errorf("cache has no entries")
+	}
+
+	return &hookCache{
+		name:       name,
+		ttl:        config.TTL.Duration,
+		maxEntries: config.MaxEntries,
+		metrics:    metrics,
+		lru:        list.New(),
+		entries:    make(map[cacheKey]*list.Element),
+	}, nil
+}
+
+// get returns a copy of the cached patch, or the denial of the hook. The last result is false if there is no valid
+// answer of key
+func (c *hookCache) get(key cacheKey) (*PatchData, error, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, found := c.entries[key]
+	if found && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		found = false
+	}
+
+	if !found {
+		c.metrics.hookCacheMisses.WithLabelValues(c.name).Inc()
+		return nil, nil, false
+	}
+
+	c.metrics.hookCacheHits.WithLabelValues(c.name).Inc()
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	if entry.denied != nil {
+		return nil, entry.denied, true
+	}
+	patch := entry.patch
+	return &patch, nil, true
+}
+
+// put keeps the answer of the hook, only patches and denials are cached, other errors are not
+func (c *hookCache) put(key cacheKey, patch *PatchData, err error) {
+	if c == nil {
+		return
+	}
+
+	entry := &cacheEntry{key: key, expires: time.Now().Add(c.ttl)}
+	if err != nil {
+		var denied *DeniedError
+		if !errors.As(err, &denied) {
+			return
+		}
+		entry.denied = denied
+	} else {
+		entry.patch = *patch
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestHookCache(t *testing.T) {
+	calls := 0
+	hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})), WithSystemd(false))
+
+	if err := hm.RegisterHook(HookRegistration{
+		Name: "cached",
+		Handler: &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				calls++
+				if strings.Contains(string(body), "deny") {
+					return &DeniedError{Hook: "cached", Message: "denied"}
+				}
+				patch.PatchType = string(types.MergePatchType)
+				patch.PatchData = []byte(`{"Labels":{"cached":"true"}}`)
+				return nil
+			},
+		},
+		CacheTTL:        time.Minute,
+		CacheMaxEntries: 10,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	for _, c := range []struct {
+		body          string
+		expectedCode  int
+		expectedCalls int
+	}{
+		{body: `{"Image":"a"}`, expectedCode: http.StatusOK, expectedCalls: 1},
+		{body: `{"Image":"a"}`, expectedCode: http.StatusOK, expectedCalls: 1},
+		{body: `{"Image":"b"}`, expectedCode: http.StatusOK, expectedCalls: 2},
+		{body: `{"Image":"deny"}`, expectedCode: http.StatusForbidden, expectedCalls: 3},
+		{body: `{"Image":"deny"}`, expectedCode: http.StatusForbidden, expectedCalls: 3},
+	} {
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(c.body)))
+		if ans.Code != c.expectedCode {
+			t.Errorf("%s: expect status code %d to be %d", c.body, ans.Code, c.expectedCode)
+		}
+		if calls != c.expectedCalls {
+			t.Errorf("%s: expect %d calls to be %d", c.body, calls, c.expectedCalls)
+		}
+	}
+
+	if n := testutil.ToFloat64(hm.metrics.hookCacheHits.WithLabelValues("cached")); n != 2 {
+		t.Errorf("expect %v hits to be 2", n)
+	}
+	if n := testutil.ToFloat64(hm.metrics.hookCacheMisses.WithLabelValues("cached")); n != 3 {
+		t.Errorf("expect %v misses to be 3", n)
+	}
+}
+
+func TestHookCacheLimits(t *testing.T) {
+	hm := NewManager(WithSystemd(false))
+	cache, err := newHookCache("limited", componentconfig.HookCacheConfiguration{
+		TTL:        metav1.Duration{Duration: 50 * time.Millisecond},
+		MaxEntries: 2,
+	}, hm.metrics)
+	if err != nil {
+		t.Fatalf("can't create cache: %v", err)
+	}
+
+	keys := make([]cacheKey, 3)
+	for i := range keys {
+		keys[i] = newCacheKey(componentconfig.PreHookType, http.MethodPost, "/containers/create", 0, nil, nil,
+			[]byte{byte(i)})
+		cache.put(keys[i], &PatchData{PatchData: []byte{byte(i)}}, nil)
+	}
+
+	// the least recently used one is evicted
+	if _, _, found := cache.get(keys[0]); found {
+		t.Errorf("expect the oldest entry to be evicted")
+	}
+	patch, err, found := cache.get(keys[2])
+	if !found || err != nil || patch.PatchData[0] != 2 {
+		t.Errorf("expect entry 2 to be cached, got %v %v %v", patch, err, found)
+	}
+
+	// errors other than denials are not cached
+	cache.put(keys[0], nil, &OverloadedError{Hook: "limited", Reason: rejectQueueFull})
+	if _, _, found := cache.get(keys[0]); found {
+		t.Errorf("expect the failure not to be cached")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, _, found := cache.get(keys[2]); found {
+		t.Errorf("expect the entry to expire")
+	}
+
+	if _, err := newHookCache("invalid", componentconfig.HookCacheConfiguration{
+		TTL: metav1.Duration{Duration: time.Minute},
+	}, hm.metrics); err == nil {
+		t.Errorf("expect the cache without entries to be invalid")
+	}
+}
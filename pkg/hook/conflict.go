@@ -0,0 +1,284 @@
+package hook
+
+import (
+	"bytes"
+	gjson "encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+var conflictPolicyOrder = map[componentconfig.ConflictPolicyType]int{
+	"":                               0,
+	componentconfig.ConflictLastWins: 0,
+	componentconfig.ConflictWarn:     1,
+	componentconfig.ConflictFail:     2,
+}
+
+func validConflictPolicy(policy componentconfig.ConflictPolicyType) bool {
+	_, found := conflictPolicyOrder[policy]
+	return found
+}
+
+// stricterConflictPolicy returns the stricter one of a and b
+func stricterConflictPolicy(a, b componentconfig.ConflictPolicyType) componentconfig.ConflictPolicyType {
+	if conflictPolicyOrder[b] > conflictPolicyOrder[a] {
+		return b
+	}
+	return a
+}
+
+type patchConflict struct {
+	pointer      string
+	hook         string
+	previousHook string
+}
+
+func (c patchConflict) String() string {
+	return fmt.Sprintf("%s set by %s is changed by %s", c.pointer, c.previousHook, c.hook)
+}
+
+// patchTracker records the JSON pointers changed by each hook of a chain, a conflict is found if a hook changes a
+// pointer, or its parent or child, which is changed by an earlier hook
+type patchTracker struct {
+	policy    componentconfig.ConflictPolicyType
+	hookType  componentconfig.HookType
+	metrics   *hookMetrics
+	owners    map[string]string
+	conflicts []patchConflict
+}
+
+// newPatchTracker returns nil if the policy doesn't care about conflicts
+func newPatchTracker(policy componentconfig.ConflictPolicyType, hookType componentconfig.HookType,
+	metrics *hookMetrics) *patchTracker {
+	if conflictPolicyOrder[policy] == 0 {
+		return nil
+	}
+
+	return &patchTracker{
+		policy:   policy,
+		hookType: hookType,
+		metrics:  metrics,
+		owners:   make(map[string]string),
+	}
+}
+
+// record finds the pointers changed by the hook, an error is returned if a conflict is found with Fail policy
+func (t *patchTracker) record(hook string, before, after []byte) error {
+	changed, err := changedPointers(before, after)
+	if err != nil {
+		klog.Warningf("can't find fields changed by %s, %v", hook, err)
+		return nil
+	}
+
+	var conflicts []patchConflict
+	for _, p := range changed {
+		for owned, owner := range t.owners {
+			if owner == hook || !pointerOverlaps(owned, p) {
+				continue
+			}
+			conflicts = append(conflicts, patchConflict{pointer: p, hook: hook, previousHook: owner})
+		}
+	}
+
+	for _, p := range changed {
+		t.owners[p] = hook
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].pointer != conflicts[j].pointer {
+			return conflicts[i].pointer < conflicts[j].pointer
+		}
+		return conflicts[i].previousHook < conflicts[j].previousHook
+	})
+
+	for _, c := range conflicts {
+		t.metrics.patchConflicts.WithLabelValues(string(t.hookType), c.hook, c.previousHook,
+			string(t.policy)).Inc()
+	}
+	t.conflicts = append(t.conflicts, conflicts...)
+
+	if len(conflicts) > 0 && t.policy == componentconfig.ConflictFail {
+		return fmt.Errorf("patch conflict, %s", formatConflicts(conflicts))
+	}
+
+	return nil
+}
+
+// report logs the conflicts of the chain
+func (t *patchTracker) report(method, path string) {
+	if t == nil || len(t.conflicts) == 0 || t.policy != componentconfig.ConflictWarn {
+		return
+	}
+
+	klog.Warningf("Patch conflict of %s %s %s, %s", t.hookType, method, path, formatConflicts(t.conflicts))
+}
+
+func formatConflicts(conflicts []patchConflict) string {
+	strs := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		strs = append(strs, c.String())
+	}
+	return strings.Join(strs, "; ")
+}
+
+// pointerOverlaps returns whether a equals b, or one of them is the parent of the other
+func pointerOverlaps(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || strings.HasPrefix(b, a+"/")
+}
+
+// changedPointers returns the JSON pointers of the leaf values which differ between before and after. Objects are
+// compared by their members, and the members added or removed are reported by their leaves, so two hooks adding
+// different keys under a new object don't conflict. Arrays are compared by their items, an item inserted or removed
+// only changes its own pointer rather than the ones of the items after it
+func changedPointers(before, after []byte) ([]string, error) {
+	var b, a interface{}
+
+	for _, v := range []struct {
+		data []byte
+		obj  *interface{}
+	}{{before, &b}, {after, &a}} {
+		if len(bytes.TrimSpace(v.data)) == 0 {
+			continue
+		}
+
+		decoder := gjson.NewDecoder(bytes.NewReader(v.data))
+		decoder.UseNumber()
+		if err := decoder.Decode(v.obj); err != nil {
+			return nil, err
+		}
+	}
+
+	var changed []string
+	diffValue("", b, a, &changed)
+	return changed, nil
+}
+
+func diffValue(pointer string, before, after interface{}, changed *[]string) {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		for k, bv := range b {
+			av, found := a[k]
+			if !found {
+				leafPointers(pointer+"/"+escapePointer(k), bv, changed)
+				continue
+			}
+			diffValue(pointer+"/"+escapePointer(k), bv, av, changed)
+		}
+
+		for k, av := range a {
+			if _, found := b[k]; !found {
+				leafPointers(pointer+"/"+escapePointer(k), av, changed)
+			}
+		}
+		return
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+
+		diffArray(pointer, b, a, changed)
+		return
+	case nil:
+		// a value added where there was nothing
+		if after != nil {
+			leafPointers(pointer, after, changed)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changed = append(*changed, pointer)
+	}
+}
+
+// diffArray matches the items of before and after by their longest common subsequence. The items inserted are
+// reported by their indexes in after, the ones removed by their indexes in before, and an item replaced at the same
+// place is compared by its members
+func diffArray(pointer string, before, after []interface{}, changed *[]string) {
+	// lcs[i][j] is the length of the longest common subsequence of before[i:] and after[j:]
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			switch {
+			case reflect.DeepEqual(before[i], after[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var removed, inserted []int
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(inserted); k++ {
+			switch {
+			case k >= len(inserted):
+				leafPointers(pointer+"/"+strconv.Itoa(removed[k]), before[removed[k]], changed)
+			case k >= len(removed):
+				leafPointers(pointer+"/"+strconv.Itoa(inserted[k]), after[inserted[k]], changed)
+			default:
+				diffValue(pointer+"/"+strconv.Itoa(inserted[k]), before[removed[k]], after[inserted[k]], changed)
+			}
+		}
+		removed, inserted = removed[:0], inserted[:0]
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && reflect.DeepEqual(before[i], after[j]):
+			flush()
+			i++
+			j++
+		case j >= len(after) || (i < len(before) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			inserted = append(inserted, j)
+			j++
+		}
+	}
+	flush()
+}
+
+// leafPointers reports the pointers of the leaves of value, an empty object or array is a leaf
+func leafPointers(pointer string, value interface{}, changed *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			for k, member := range v {
+				leafPointers(pointer+"/"+escapePointer(k), member, changed)
+			}
+			return
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			for i, item := range v {
+				leafPointers(pointer+"/"+strconv.Itoa(i), item, changed)
+			}
+			return
+		}
+	}
+	*changed = append(*changed, pointer)
+}
@@ -0,0 +1,122 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestHookManagerConflictPolicy(t *testing.T) {
+	mergePatch := func(data string) *fakeHookHandler {
+		return &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.StrategicMergePatchType)
+				patch.PatchData = []byte(data)
+				return nil
+			},
+		}
+	}
+
+	handlers := []*hookHandle{
+		{name: "memory", HookHandler: mergePatch(`{"HostConfig":{"Memory":1024},"Env":["A=1"]}`)},
+		{name: "env", HookHandler: mergePatch(`{"Env":["B=2"]}`)},
+		{name: "resources", HookHandler: mergePatch(`{"HostConfig":{"Memory":2048}}`)},
+	}
+
+	for _, u := range []struct {
+		policy    componentconfig.ConflictPolicyType
+		fail      bool
+		conflicts float64
+	}{
+		{componentconfig.ConflictLastWins, false, 0},
+		{componentconfig.ConflictWarn, false, 1},
+		{componentconfig.ConflictFail, true, 1},
+	} {
+		hm := NewHookManager()
+		hm.timeout = 10 * time.Second
+
+		body := []byte(`{"Image":"busybox","Env":[]}`)
+		err := hm.applyHook(context.Background(), handlers, componentconfig.PreHookType, u.policy, http.MethodPost,
+			"/containers/create", &body)
+		if u.fail {
+			if err == nil || !strings.Contains(err.Error(), "/HostConfig/Memory set by memory is changed by resources") {
+				t.Errorf("expect %s policy to fail with conflict report, got %v", u.policy, err)
+			}
+		} else if err != nil {
+			t.Errorf("expect %s policy not to fail, got %v", u.policy, err)
+		} else if string(body) != `{"Env":["A=1","B=2"],"HostConfig":{"Memory":2048},"Image":"busybox"}` {
+			t.Errorf("expect body %s of %s policy to be patched by the last hook", string(body), u.policy)
+		}
+
+		got := testutil.ToFloat64(hm.metrics.patchConflicts.WithLabelValues(string(componentconfig.PreHookType),
+			"resources", "memory", string(u.policy)))
+		if got != u.conflicts {
+			t.Errorf("expect %v conflicts of %s policy to be %v", got, u.policy, u.conflicts)
+		}
+	}
+}
+
+func TestChangedPointers(t *testing.T) {
+	for _, u := range []struct {
+		before   string
+		after    string
+		expected []string
+	}{
+		{`{"Image":"busybox"}`, `{"Image":"busybox","Labels":{"a":"1","b":{}}}`, []string{"/Labels/a", "/Labels/b"}},
+		{`{"Labels":{"a":"1","b":"2"}}`, `{}`, []string{"/Labels/a", "/Labels/b"}},
+		{`{"Env":["A=1","B=2"]}`, `{"Env":["C=3","A=1","B=2"]}`, []string{"/Env/0"}},
+		{`{"Env":["A=1","B=2","C=3"]}`, `{"Env":["A=1","C=3"]}`, []string{"/Env/1"}},
+		{
+			`{"Mounts":[{"Source":"/a","Target":"/a"}]}`,
+			`{"Mounts":[{"Source":"/b","Target":"/a"}]}`,
+			[]string{"/Mounts/0/Source"},
+		},
+		{``, `{"Env":[]}`, []string{"/Env"}},
+	} {
+		got, err := changedPointers([]byte(u.before), []byte(u.after))
+		if err != nil {
+			t.Errorf("can't diff %s and %s: %v", u.before, u.after, err)
+			continue
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(u.expected, ",") {
+			t.Errorf("expect pointers changed from %s to %s to be %v, got %v", u.before, u.after, u.expected, got)
+		}
+	}
+}
+
+func TestHookManagerConflictNewObject(t *testing.T) {
+	labels := func(data string) *fakeHookHandler {
+		return &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.MergePatchType)
+				patch.PatchData = []byte(data)
+				return nil
+			},
+		}
+	}
+
+	hm := NewHookManager()
+	hm.timeout = 10 * time.Second
+
+	body := []byte(`{"Image":"busybox"}`)
+	if err := hm.applyHook(context.Background(), []*hookHandle{
+		{name: "team", HookHandler: labels(`{"Labels":{"team":"a"}}`)},
+		{name: "zone", HookHandler: labels(`{"Labels":{"zone":"b"}}`)},
+	}, componentconfig.PreHookType, componentconfig.ConflictFail, http.MethodPost, "/containers/create",
+		&body); err != nil {
+		t.Fatalf("expect labels added by different hooks not to conflict, got %v", err)
+	}
+
+	if expected := `{"Image":"busybox","Labels":{"team":"a","zone":"b"}}`; string(body) != expected {
+		t.Errorf("expect body %s to be %s", string(body), expected)
+	}
+}
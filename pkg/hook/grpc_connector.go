@@ -0,0 +1,156 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/hook/hookpb"
+	"github.com/mYmNeo/lighthouse/pkg/trace"
+	"github.com/mYmNeo/lighthouse/pkg/util"
+)
+
+// grpcConnector calls the hook server of protocol grpc, the connection is kept and reconnected by grpc
+type grpcConnector struct {
+	name     string
+	endpoint string
+	conn     *grpc.ClientConn
+	client   hookpb.HookClient
+}
+
+var _ HookHandler = (*grpcConnector)(nil)
+
+func newGRPCConnector(name, endpoint string) (*grpcConnector, error) {
+	proto, addr, err := util.GetProtoAndAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if proto != util.UnixProto && proto != "tcp" {
+		return nil, fmt.Errorf("unsupported protocol %s of grpc endpoint %s", proto, endpoint)
+	}
+
+	// the address is resolved by the dialer, so abstract unix sockets work as well
+	conn, err := grpc.Dial("passthrough:///"+addr, grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, proto, addr)
+		}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcConnector{
+		name:     name,
+		endpoint: endpoint,
+		conn:     conn,
+		client:   hookpb.NewHookClient(conn),
+	}, nil
+}
+
+func (gc *grpcConnector) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return gc.performHook(ctx, componentconfig.PreHookType, patch, method, path, body)
+}
+
+func (gc *grpcConnector) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return gc.performHook(ctx, componentconfig.PostHookType, patch, method, path, body)
+}
+
+func (gc *grpcConnector) performHook(ctx context.Context, hookType componentconfig.HookType, patch *PatchData,
+	method, path string, body []byte) error {
+	info := RequestInfoFrom(ctx)
+	req := &hookpb.HookRequest{
+		Method:           method,
+		Path:             path,
+		Body:             body,
+		ApiVersion:       info.APIVersion,
+		ClientApiVersion: info.ClientAPIVersion,
+		StatusCode:       int32(info.StatusCode),
+		Container:        containerToProto(info.Container),
+		Uid:              info.UID,
+		ContainerType:    info.ContainerType,
+		Sandbox:          containerToProto(info.Sandbox),
+	}
+	if hookType == componentconfig.PostHookType {
+		req.OriginalRequestBody, req.RequestBody, req.State = info.OriginalRequestBody, info.RequestBody, patch.State
+	}
+
+	if sc := trace.SpanContextFrom(ctx); sc.IsValid() {
+		ctx = metadata.AppendToOutgoingContext(ctx, trace.HeaderTraceParent, sc.TraceParent())
+	}
+
+	klog.V(4).Infof("Call %s %s %s for %s", hookType, method, path, gc.name)
+	var (
+		resp *hookpb.HookResponse
+		err  error
+	)
+	switch hookType {
+	case componentconfig.PreHookType:
+		resp, err = gc.client.PreHook(ctx, req)
+	case componentconfig.PostHookType:
+		resp, err = gc.client.PostHook(ctx, req)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if resp.Denied {
+		return &DeniedError{Hook: gc.name, Message: resp.Message}
+	}
+
+	if len(resp.Patch) > 0 {
+		patch.PatchType = resp.PatchType
+		patch.PatchData = resp.Patch
+	}
+	if hookType == componentconfig.PreHookType {
+		patch.State = resp.State
+	}
+
+	return nil
+}
+
+// HealthCheck waits until the connection is ready
+func (gc *grpcConnector) HealthCheck(ctx context.Context) error {
+	for {
+		state := gc.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection is %s", state)
+		}
+
+		if !gc.conn.WaitForStateChange(ctx, state) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (gc *grpcConnector) Close() error {
+	return gc.conn.Close()
+}
+
+func containerToProto(c *ContainerInfo) *hookpb.Container {
+	if c == nil {
+		return nil
+	}
+
+	container := &hookpb.Container{
+		Id:        c.ID,
+		Name:      c.Name,
+		Labels:    c.Labels,
+		State:     c.State,
+		Type:      c.Type,
+		SandboxId: c.SandboxID,
+	}
+	for _, p := range c.Patches {
+		container.Patches = append(container.Patches, &hookpb.AppliedPatch{Hook: p.Hook, Changed: p.Changed})
+	}
+	return container
+}
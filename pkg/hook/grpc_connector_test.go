@@ -0,0 +1,105 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/hook/hookpb"
+)
+
+type fakeHookServer struct {
+	requests chan *hookpb.HookRequest
+}
+
+func (s *fakeHookServer) PreHook(ctx context.Context, req *hookpb.HookRequest) (*hookpb.HookResponse, error) {
+	s.requests <- req
+	return &hookpb.HookResponse{
+		PatchType: string(types.MergePatchType),
+		Patch:     []byte(`{"foo":"1"}`),
+	}, nil
+}
+
+func (s *fakeHookServer) PostHook(ctx context.Context, req *hookpb.HookRequest) (*hookpb.HookResponse, error) {
+	s.requests <- req
+	return &hookpb.HookResponse{Denied: true, Message: "not allowed"}, nil
+}
+
+func TestGRPCConnector(t *testing.T) {
+	endpoints := []struct {
+		network string
+		address string
+	}{
+		{"unix", fmt.Sprintf("@lighthouse-grpc-%s", uuid.New().String())},
+		{"tcp", "127.0.0.1:0"},
+	}
+
+	for _, e := range endpoints {
+		l, err := net.Listen(e.network, e.address)
+		if err != nil {
+			t.Fatalf("can't listen on %s://%s: %v", e.network, e.address, err)
+		}
+
+		server := grpc.NewServer()
+		hs := &fakeHookServer{requests: make(chan *hookpb.HookRequest, 1)}
+		hookpb.RegisterHookServer(server, hs)
+		go server.Serve(l)
+
+		func() {
+			defer server.Stop()
+
+			gc, err := newGRPCConnector("grpc", fmt.Sprintf("%s://%s", e.network, l.Addr().String()))
+			if err != nil {
+				t.Fatalf("can't create grpc connector: %v", err)
+			}
+			defer gc.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = WithRequestInfo(ctx, &RequestInfo{APIVersion: "1.44", ClientAPIVersion: "1.40"})
+
+			if err := gc.HealthCheck(ctx); err != nil {
+				t.Errorf("expect %s connection to be ready, got %v", e.network, err)
+			}
+
+			patch := &PatchData{}
+			if err := gc.PreHook(ctx, patch, http.MethodPost, "/v1.40/containers/create",
+				[]byte(`{"foo":"bar"}`)); err != nil {
+				t.Fatalf("can't perform pre hook: %v", err)
+			}
+
+			req := <-hs.requests
+			if req.Path != "/v1.40/containers/create" || string(req.Body) != `{"foo":"bar"}` ||
+				req.ApiVersion != "1.44" || req.ClientApiVersion != "1.40" {
+				t.Errorf("unexpected request %+v", req)
+			}
+
+			if patch.PatchType != string(types.MergePatchType) || string(patch.PatchData) != `{"foo":"1"}` {
+				t.Errorf("unexpected patch %s %s", patch.PatchType, string(patch.PatchData))
+			}
+
+			err = gc.PostHook(WithRequestInfo(ctx, &RequestInfo{StatusCode: http.StatusCreated}), &PatchData{},
+				http.MethodPost, "/containers/create", []byte(`{"Id":"abc"}`))
+			var denied *DeniedError
+			if !errors.As(err, &denied) || denied.Message != "not allowed" {
+				t.Errorf("expect post hook to be denied, got %v", err)
+			}
+
+			if code := hookErrorStatusCode(err); code != http.StatusForbidden {
+				t.Errorf("expect status code %d of denial to be %d", code, http.StatusForbidden)
+			}
+
+			if req := <-hs.requests; req.StatusCode != http.StatusCreated {
+				t.Errorf("expect status code %d of post hook to be %d", req.StatusCode, http.StatusCreated)
+			}
+		}()
+	}
+}
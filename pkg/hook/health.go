@@ -0,0 +1,223 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	systemd "github.com/coreos/go-systemd/v22/daemon"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/util"
+)
+
+const (
+	adminListenerName = "admin"
+	// healthCheckTimeout is the timeout of each health check
+	healthCheckTimeout = 5 * time.Second
+)
+
+// healthChecker is implemented by the dependencies which can report their health
+type healthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (hm *Manager) buildAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serveHealthChecks(w, r, "healthz", hm.livenessChecks())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		serveHealthChecks(w, r, "readyz", hm.readinessChecks())
+	})
+	mux.Handle("/metrics", hm.metrics.handler())
+
+	return mux
+}
+
+// livenessChecks checks whether lighthouse itself is working
+func (hm *Manager) livenessChecks() []healthCheck {
+	checks := make([]healthCheck, 0, len(hm.listeners))
+	for _, hl := range hm.listeners {
+		hl := hl
+		checks = append(checks, healthCheck{
+			name: "listener/" + hl.name,
+			check: func(ctx context.Context) error {
+				if atomic.LoadInt32(&hl.serving) == 0 {
+					return fmt.Errorf("not serving")
+				}
+				return nil
+			},
+		})
+	}
+
+	return checks
+}
+
+// readinessChecks checks the backend and the hooks which are not allowed to fail
+func (hm *Manager) readinessChecks() []healthCheck {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	checks := make([]healthCheck, 0, len(hm.hooks)+1)
+	if hc, ok := hm.backend.(healthChecker); ok {
+		checks = append(checks, healthCheck{name: "backend", check: hc.HealthCheck})
+	}
+
+	for _, h := range hm.hooks {
+		hc, ok := h.HookHandler.(healthChecker)
+		if !ok || h.failurePolicy != componentconfig.PolicyFail {
+			continue
+		}
+		checks = append(checks, healthCheck{name: "hook/" + h.name, check: hc.HealthCheck})
+	}
+
+	return checks
+}
+
+// runHealthChecks runs the checks concurrently, each check is bounded by healthCheckTimeout, so a slow dependency
+// doesn't fail the others. The report is in the order of the checks
+func runHealthChecks(ctx context.Context, checks []healthCheck) (string, bool) {
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			errs[i] = c.check(checkCtx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &bytes.Buffer{}
+	healthy := true
+	for i, c := range checks {
+		if errs[i] != nil {
+			healthy = false
+			fmt.Fprintf(report, "[-]%s failed: %v\n", c.name, errs[i])
+			continue
+		}
+		fmt.Fprintf(report, "[+]%s ok\n", c.name)
+	}
+
+	return report.String(), healthy
+}
+
+func serveHealthChecks(w http.ResponseWriter, r *http.Request, name string, checks []healthCheck) {
+	report, healthy := runHealthChecks(r.Context(), checks)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !healthy {
+		klog.Warningf("%s check failed\n%s", name, report)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "%s%s check failed\n", report, name)
+		return
+	}
+
+	fmt.Fprintf(w, "%s%s check passed\n", report, name)
+}
+
+// watchdog sends WATCHDOG=1 to systemd periodically if lighthouse is alive, so a wedged process will be restarted by
+// systemd
+func (hm *Manager) watchdog(stop <-chan struct{}) {
+	interval, err := systemd.SdWatchdogEnabled(false)
+	if err != nil {
+		klog.Warningf("Unable to get systemd watchdog interval: %v", err)
+		return
+	}
+
+	if interval == 0 {
+		return
+	}
+
+	var client *http.Client
+	if hm.admin != nil {
+		proto, addr, err := util.GetProtoAndAddress(hm.admin.address)
+		if err != nil {
+			klog.Warningf("Unable to parse admin address %s: %v", hm.admin.address, err)
+			return
+		}
+
+		client = newAdminClient(proto, addr)
+	}
+
+	klog.Infof("Systemd watchdog is enabled, interval %v", interval)
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hm.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		if err := hm.checkAlive(client, interval/2); err != nil {
+			klog.Errorf("Lighthouse is not alive, skip notifying systemd watchdog, %v", err)
+			continue
+		}
+
+		if _, err := systemd.SdNotify(false, "WATCHDOG=1"); err != nil {
+			klog.Warningf("Unable to notify systemd watchdog: %v", err)
+		}
+	}
+}
+
+// newAdminClient returns a client which always dials the admin listener, whatever the host of the URL is
+func newAdminClient(proto, addr string) *http.Client {
+	dialer := &net.Dialer{}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, proto, addr)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// checkAlive requests the healthz of the admin listener if there is a client, so the process is proved to answer
+// requests. Otherwise the liveness checks run in process, which only tell whether the listeners are still serving,
+// not whether they answer in time
+func (hm *Manager) checkAlive(client *http.Client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if client == nil {
+		if report, healthy := runHealthChecks(ctx, hm.livenessChecks()); !healthy {
+			return fmt.Errorf("%s", report)
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://admin/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthz status code is %d", resp.StatusCode)
+	}
+
+	return nil
+}
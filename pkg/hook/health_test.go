@@ -0,0 +1,133 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+func TestHookManagerReadyz(t *testing.T) {
+	backendServer := test.NewUnixSocketServer()
+	backendServer.RegisterHandler("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	hookServer := test.NewUnixSocketServer()
+	hookServer.RegisterHandler("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, s := range []*test.UnixSocketServer{backendServer, hookServer} {
+		ready := make(chan struct{})
+		go func(s *test.UnixSocketServer) {
+			close(ready)
+			s.Start()
+		}(s)
+		defer s.Stop()
+		<-ready
+	}
+
+	cfg := &componentconfig.HookConfiguration{
+		Timeout:        10,
+		RemoteEndpoint: backendServer.GetAddress(),
+		AdminAddress:   "unix:///tmp/lighthouse-admin.sock",
+		WebHooks: componentconfig.HookConfigurationList{
+			{
+				Name:          "connected",
+				Endpoint:      hookServer.GetAddress(),
+				FailurePolicy: componentconfig.PolicyFail,
+			},
+			{
+				Name:          "unhealthy",
+				Endpoint:      hookServer.GetAddress(),
+				FailurePolicy: componentconfig.PolicyFail,
+				HealthPath:    "/healthz",
+			},
+			{
+				Name:          "ignored",
+				Endpoint:      "unix://@lighthouse-not-exist",
+				FailurePolicy: componentconfig.PolicyIgnore,
+			},
+		},
+	}
+
+	hm := NewHookManager()
+	if err := hm.InitFromConfig(cfg); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+
+	ans := httptest.NewRecorder()
+	hm.admin.handler.ServeHTTP(ans, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if ans.Code != http.StatusServiceUnavailable {
+		t.Errorf("expect readyz status code %d to be %d", ans.Code, http.StatusServiceUnavailable)
+	}
+
+	report := ans.Body.String()
+	for _, line := range []string{"[+]backend ok", "[+]hook/connected ok", "[-]hook/unhealthy failed"} {
+		if !strings.Contains(report, line) {
+			t.Errorf("expect readyz report %q to contain %q", report, line)
+		}
+	}
+
+	if strings.Contains(report, "hook/ignored") {
+		t.Errorf("expect hook with Ignore policy not to be checked, got %q", report)
+	}
+}
+
+func TestCheckAliveOverTCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	hm := NewManager(WithSystemd(false))
+	// the host of the healthz URL is not resolved, the admin address is dialed
+	if err := hm.checkAlive(newAdminClient("tcp", server.Listener.Addr().String()), time.Second); err != nil {
+		t.Errorf("expect admin listener to be alive, %v", err)
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	// each check waits for the other one, so they only pass if they run concurrently
+	started := make(chan struct{}, 2)
+	wait := func(ctx context.Context) error {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > healthCheckTimeout {
+			return fmt.Errorf("expect the check to have its own timeout")
+		}
+		started <- struct{}{}
+		for {
+			if len(started) == 2 {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	report, healthy := runHealthChecks(ctx, []healthCheck{
+		{name: "a", check: wait},
+		{name: "b", check: wait},
+		{name: "c", check: func(ctx context.Context) error { return fmt.Errorf("broken") }},
+	})
+	if healthy {
+		t.Errorf("expect the checks to fail")
+	}
+	expected := "[+]a ok\n[+]b ok\n[-]c failed: broken\n"
+	if report != expected {
+		t.Errorf("expect report %q to be %q", report, expected)
+	}
+}
@@ -3,30 +3,46 @@ package hook
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	gjson "encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
 
 	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/trace"
 	"github.com/mYmNeo/lighthouse/pkg/util"
 )
 
+// defaultMaxPostHookHeader is the max size of a post hook header if it's not configured
+const defaultMaxPostHookHeader = 4096
+
 type hookerConnector struct {
-	name          string
-	endpoint      string
-	failurePolicy componentconfig.FailurePolicyType
-	client        *http.Client
+	name       string
+	endpoint   string
+	healthPath string
+	protocol   componentconfig.ProtocolType
+	client     *http.Client
+	// maxPostHookHeader is the max size of the request bodies and the hook state sent to post hooks of protocol v2
+	// in headers, they are not sent if it's 0
+	maxPostHookHeader int
 }
 
 var _ HookHandler = (*hookerConnector)(nil)
 
-func newHookConnector(name, endpoint string, failurePolicy componentconfig.FailurePolicyType) *hookerConnector {
+// newHookConnector returns a connector to a remote webhook, its failures are returned, and ignored by the manager
+// according to the failure policy
+func newHookConnector(name, endpoint string) *hookerConnector {
 	hc := &hookerConnector{
-		name:          name,
-		endpoint:      endpoint,
-		failurePolicy: failurePolicy,
+		name:     name,
+		endpoint: endpoint,
+		protocol: componentconfig.ProtocolV1,
 	}
 
 	if !strings.HasPrefix(endpoint, "unix://") {
@@ -40,32 +56,84 @@ func newHookConnector(name, endpoint string, failurePolicy componentconfig.Failu
 func (hc *hookerConnector) performHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
 	url := fmt.Sprintf("http://%s", hc.endpoint)
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
-	if err != nil && !hc.allowFailure() {
+	if err != nil {
 		klog.Errorf("can't create request %s, %v", url, err)
 		return err
 	}
 
-	if req != nil {
-		req.URL.Path = path
-
-		klog.V(4).Infof("Send request %s %s for %s", method, path, hc.name)
-		resp, err := hc.client.Do(req)
-		if err != nil && !hc.allowFailure() {
+	req.URL.Path = path
+	req.Header.Set(HeaderProtocol, string(hc.protocol))
+	trace.Inject(ctx, req.Header)
+	info := RequestInfoFrom(ctx)
+	if len(info.APIVersion) > 0 {
+		req.Header.Set(HeaderAPIVersion, info.APIVersion)
+	}
+	if len(info.UID) > 0 {
+		req.Header.Set(HeaderRequestUID, info.UID)
+	}
+	if info.StatusCode > 0 && hc.protocol == componentconfig.ProtocolV2 {
+		req.Header.Set(HeaderStatusCode, strconv.Itoa(info.StatusCode))
+		if hc.maxPostHookHeader > 0 {
+			hc.setBase64Header(req.Header, HeaderOriginalRequest, info.OriginalRequestBody)
+			hc.setBase64Header(req.Header, HeaderRequest, info.RequestBody)
+			hc.setBase64Header(req.Header, HeaderHookState, patch.State)
+		}
+	}
+	if info.Container != nil {
+		container, err := encodeJSON(info.Container)
+		if err != nil {
 			return err
 		}
+		req.Header.Set(HeaderContainer, string(container))
+	}
+	if len(info.ContainerType) > 0 {
+		req.Header.Set(HeaderContainerType, info.ContainerType)
+	}
+	if info.Sandbox != nil {
+		sandbox, err := encodeJSON(info.Sandbox)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(HeaderSandbox, string(sandbox))
+	}
 
-		if resp != nil {
-			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && !hc.allowFailure() {
-				return fmt.Errorf("post is not success, status code is %d", resp.StatusCode)
-			}
+	klog.V(4).Infof("Send request %s %s for %s", method, path, hc.name)
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-			if resp.Body != nil {
-				klog.V(4).Infof("Decode response %s for %s", path, hc.name)
-				return json.NewDecoder(resp.Body).Decode(patch)
-			}
-		}
+	success := resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated ||
+		resp.StatusCode == http.StatusNoContent && hc.protocol == componentconfig.ProtocolV2
+	if !success {
+		return fmt.Errorf("post is not success, status code is %d", resp.StatusCode)
+	}
+
+	klog.V(4).Infof("Decode response %s for %s", path, hc.name)
+	return hc.decodePatch(resp, patch)
+}
+
+func (hc *hookerConnector) decodePatch(resp *http.Response, patch *PatchData) error {
+	if hc.protocol != componentconfig.ProtocolV2 {
+		return json.NewDecoder(resp.Body).Decode(patch)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
 	}
 
+	data := &PatchDataV2{}
+	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return err
+	}
+
+	if len(data.Patch) > 0 && string(data.Patch) != "null" {
+		patch.PatchType = data.PatchType
+		patch.PatchData = []byte(data.Patch)
+	}
+	patch.State = data.State
+
 	return nil
 }
 
@@ -73,10 +141,162 @@ func (hc *hookerConnector) PreHook(ctx context.Context, patch *PatchData, method
 	return hc.performHook(ctx, patch, method, HookPath(componentconfig.PreHookType, path), body)
 }
 
+// PostHook sends the raw body with protocol v2, or wraps it into PostHookData with protocol v1. The patch of
+// protocol v1 is converted to patch the raw body
 func (hc *hookerConnector) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
-	return hc.performHook(ctx, patch, method, HookPath(componentconfig.PostHookType, path), body)
+	if hc.protocol == componentconfig.ProtocolV2 {
+		return hc.performHook(ctx, patch, method, HookPath(componentconfig.PostHookType, path), body)
+	}
+
+	info := RequestInfoFrom(ctx)
+	wrapped, err := json.Marshal(&PostHookData{
+		StatusCode:      info.StatusCode,
+		Body:            body,
+		UID:             info.UID,
+		OriginalRequest: rawJSON(info.OriginalRequestBody),
+		Request:         rawJSON(info.RequestBody),
+		State:           patch.State,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := hc.performHook(ctx, patch, method, HookPath(componentconfig.PostHookType, path), wrapped); err != nil {
+		return err
+	}
+
+	if patch.PatchData == nil {
+		return nil
+	}
+
+	return unwrapPostHookPatch(patch, body, wrapped)
+}
+
+// rawJSON returns nil if data is not JSON, so it can be omitted from PostHookData
+func rawJSON(data []byte) gjson.RawMessage {
+	if len(data) == 0 || !gjson.Valid(data) {
+		return nil
+	}
+	return data
+}
+
+// setBase64Header sets the header if its encoded size is within maxPostHookHeader, so a large body doesn't make the
+// request rejected by the header limits of the hook server
+func (hc *hookerConnector) setBase64Header(header http.Header, key string, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	if size := base64.StdEncoding.EncodedLen(len(value)); size > hc.maxPostHookHeader {
+		klog.Warningf("Skip header %s of %d bytes for %s, it exceeds %d bytes", key, size, hc.name,
+			hc.maxPostHookHeader)
+		return
+	}
+	header.Set(key, base64.StdEncoding.EncodeToString(value))
 }
 
-func (hc *hookerConnector) allowFailure() bool {
-	return hc.failurePolicy == componentconfig.PolicyIgnore
+// unwrapPostHookPatch converts the patch of PostHookData to the patch of its body. The patch only touching the body
+// is converted directly, otherwise it's applied to PostHookData, and a merge patch of the body is created
+func unwrapPostHookPatch(patch *PatchData, body, wrapped []byte) error {
+	switch types.PatchType(patch.PatchType) {
+	case types.JSONPatchType:
+		if p, ok := trimJSONPatchPrefix(patch.PatchData, "/body"); ok {
+			patch.PatchData = p
+			return nil
+		}
+	case types.MergePatchType, types.StrategicMergePatchType:
+		obj := make(map[string]gjson.RawMessage)
+		if err := gjson.Unmarshal(patch.PatchData, &obj); err == nil && len(obj) == 1 {
+			// a list is the patch of a list response, e.g. /containers/json
+			if p, found := obj["body"]; found && len(p) > 0 && (p[0] == '{' || p[0] == '[') {
+				patch.PatchData = p
+				return nil
+			}
+		}
+	}
+
+	patched, err := applyPatch(patch, wrapped)
+	if err != nil {
+		return err
+	}
+
+	data := &PostHookData{}
+	if err := json.Unmarshal(patched, data); err != nil {
+		return err
+	}
+
+	p, err := jsonpatch.CreateMergePatch(body, data.Body)
+	if err != nil {
+		return fmt.Errorf("can't convert post hook patch, %v", err)
+	}
+
+	patch.PatchType = string(types.MergePatchType)
+	patch.PatchData = p
+	return nil
+}
+
+// trimJSONPatchPrefix removes prefix from the paths of the JSON patch, false is returned if any path is not under
+// prefix
+func trimJSONPatchPrefix(patch []byte, prefix string) ([]byte, bool) {
+	var ops []map[string]interface{}
+	decoder := gjson.NewDecoder(bytes.NewReader(patch))
+	decoder.UseNumber()
+	if err := decoder.Decode(&ops); err != nil {
+		return nil, false
+	}
+
+	for _, op := range ops {
+		for _, key := range []string{"path", "from"} {
+			v, found := op[key]
+			if !found {
+				continue
+			}
+
+			p, _ := v.(string)
+			if !strings.HasPrefix(p, prefix+"/") {
+				return nil, false
+			}
+			op[key] = strings.TrimPrefix(p, prefix)
+		}
+	}
+
+	data, err := encodeJSON(ops)
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// HealthCheck requests the health path of the hook if it's set, otherwise tries to connect to the hook
+func (hc *hookerConnector) HealthCheck(ctx context.Context) error {
+	if len(hc.healthPath) == 0 {
+		proto, addr, err := util.GetProtoAndAddress(hc.endpoint)
+		if err != nil {
+			return err
+		}
+
+		conn, err := (&net.Dialer{}).DialContext(ctx, proto, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s", hc.endpoint), nil)
+	if err != nil {
+		return err
+	}
+
+	req.URL.Path = hc.healthPath
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("health status code is %d", resp.StatusCode)
+	}
+
+	return nil
 }
@@ -2,10 +2,16 @@ package hook
 
 import (
 	"context"
+	"encoding/base64"
+	gjson "encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/types"
@@ -76,7 +82,7 @@ func TestHookConnectorPreHook(t *testing.T) {
 	defer server.Stop()
 	<-ready
 
-	hc := newHookConnector("test", server.GetAddress(), componentconfig.PolicyFail)
+	hc := newHookConnector("test", server.GetAddress())
 
 	for _, u := range testUnits {
 		p := &PatchData{}
@@ -97,3 +103,289 @@ type testConnectorUnit struct {
 	path    string
 	payload string
 }
+
+func TestHookConnectorPostHookProtocol(t *testing.T) {
+	payload := `{"foo":"bar"}`
+	testUnits := []struct {
+		name     string
+		protocol componentconfig.ProtocolType
+		response string
+		expected string
+	}{
+		{
+			name:     "v1-json",
+			protocol: componentconfig.ProtocolV1,
+			response: `{"patchType":"application/json-patch+json","patchData":"` +
+				base64.StdEncoding.EncodeToString([]byte(`[{"op":"add","path":"/body/a","value":1}]`)) + `"}`,
+			expected: `{"a":1,"foo":"bar"}`,
+		},
+		{
+			name:     "v1-merge",
+			protocol: componentconfig.ProtocolV1,
+			response: `{"patchType":"application/merge-patch+json","patchData":"` +
+				base64.StdEncoding.EncodeToString([]byte(`{"body":{"foo":null,"a":1}}`)) + `"}`,
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "v1-whole-body",
+			protocol: componentconfig.ProtocolV1,
+			response: `{"patchType":"application/json-patch+json","patchData":"` +
+				base64.StdEncoding.EncodeToString([]byte(`[{"op":"replace","path":"/body","value":{"a":1}}]`)) + `"}`,
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "v2",
+			protocol: componentconfig.ProtocolV2,
+			response: `{"patchType":"application/strategic-merge-patch+json","patch":{"a":1}}`,
+			expected: `{"a":1,"foo":"bar"}`,
+		},
+		{
+			name:     "v2-no-patch",
+			protocol: componentconfig.ProtocolV2,
+			expected: payload,
+		},
+	}
+
+	server := test.NewUnixSocketServer()
+	for i := range testUnits {
+		u := testUnits[i]
+		server.RegisterHandler(HookPath(componentconfig.PostHookType, "/"+u.name), func(w http.ResponseWriter,
+			req *http.Request) {
+			bodyBytes, _ := ioutil.ReadAll(req.Body)
+
+			expected := payload
+			if u.protocol == componentconfig.ProtocolV1 {
+				expected = `{"statusCode":201,"body":` + payload + `}`
+			} else if req.Header.Get(HeaderStatusCode) != "201" {
+				t.Errorf("%s: expect status code header %q to be 201", u.name, req.Header.Get(HeaderStatusCode))
+			}
+
+			if string(bodyBytes) != expected {
+				t.Errorf("%s: expect body %s to be %s", u.name, string(bodyBytes), expected)
+			}
+
+			if len(u.response) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Write([]byte(u.response))
+		})
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		server.Start()
+	}()
+
+	defer server.Stop()
+	<-ready
+
+	ctx := WithRequestInfo(context.Background(), &RequestInfo{StatusCode: http.StatusCreated})
+	for _, u := range testUnits {
+		hc := newHookConnector(u.name, server.GetAddress())
+		hc.protocol = u.protocol
+
+		p := &PatchData{}
+		if err := hc.PostHook(ctx, p, http.MethodPost, "/"+u.name, []byte(payload)); err != nil {
+			t.Errorf("%s: can't perform hook, %v", u.name, err)
+			continue
+		}
+
+		body := []byte(payload)
+		if p.PatchData != nil {
+			patched, err := applyPatch(p, body)
+			if err != nil {
+				t.Errorf("%s: can't apply patch %s, %v", u.name, string(p.PatchData), err)
+				continue
+			}
+			body = patched
+		}
+
+		if string(body) != u.expected {
+			t.Errorf("%s: expect patched body %s to be %s", u.name, string(body), u.expected)
+		}
+	}
+}
+
+func BenchmarkHookConnectorPostHook(b *testing.B) {
+	klog.SetOutput(ioutil.Discard)
+	flag.Set("v", "0")
+	flag.Set("logtostderr", "false")
+
+	containers := make([]string, 0, 500)
+	for i := 0; i < cap(containers); i++ {
+		containers = append(containers, fmt.Sprintf(`{"Id":"%064d","Names":["/k8s_app_pod-%d"],"Image":"busybox",`+
+			`"Labels":{"io.kubernetes.pod.name":"pod-%d","io.kubernetes.container.name":"app"},"State":"running",`+
+			`"Status":"Up 2 hours","Mounts":[{"Type":"bind","Source":"/var/lib/kubelet/pods/%d","Destination":"/data"}]}`,
+			i, i, i, i))
+	}
+	payload := []byte(`{"Containers":[` + strings.Join(containers, ",") + `]}`)
+
+	responses := map[componentconfig.ProtocolType]string{
+		componentconfig.ProtocolV1: `{"patchType":"application/json-patch+json","patchData":"` +
+			base64.StdEncoding.EncodeToString([]byte(`[{"op":"add","path":"/body/Hooked","value":true}]`)) + `"}`,
+		componentconfig.ProtocolV2: `{"patchType":"application/json-patch+json","patch":` +
+			`[{"op":"add","path":"/Hooked","value":true}]}`,
+	}
+
+	server := test.NewUnixSocketServer()
+	for protocol, response := range responses {
+		response := response
+		server.RegisterHandler(HookPath(componentconfig.PostHookType, "/"+string(protocol)), func(w http.ResponseWriter,
+			req *http.Request) {
+			ioutil.ReadAll(req.Body)
+			w.Write([]byte(response))
+		})
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		server.Start()
+	}()
+
+	defer server.Stop()
+	<-ready
+
+	ctx := WithRequestInfo(context.Background(), &RequestInfo{StatusCode: http.StatusOK})
+	for _, protocol := range []componentconfig.ProtocolType{componentconfig.ProtocolV1, componentconfig.ProtocolV2} {
+		b.Run(string(protocol), func(b *testing.B) {
+			hc := newHookConnector(string(protocol), server.GetAddress())
+			hc.protocol = protocol
+
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p := &PatchData{}
+				if err := hc.PostHook(ctx, p, http.MethodGet, "/"+string(protocol), payload); err != nil {
+					b.Fatalf("can't perform hook, %v", err)
+				}
+				if _, err := applyPatch(p, payload); err != nil {
+					b.Fatalf("can't apply patch, %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHookConnectorCorrelation(t *testing.T) {
+	type received struct {
+		uid, originalRequest, request, state string
+	}
+	var (
+		lock sync.Mutex
+		uids = make(map[componentconfig.ProtocolType]string)
+		post = make(map[componentconfig.ProtocolType]received)
+	)
+
+	decode := func(value string) string {
+		data, _ := base64.StdEncoding.DecodeString(value)
+		return string(data)
+	}
+
+	server := test.NewUnixSocketServer()
+	server.RegisterHandler(HookPath(componentconfig.PreHookType, "/containers/create"), func(w http.ResponseWriter,
+		req *http.Request) {
+		protocol := componentconfig.ProtocolType(req.Header.Get(HeaderProtocol))
+		lock.Lock()
+		uids[protocol] = req.Header.Get(HeaderRequestUID)
+		lock.Unlock()
+
+		state := base64.StdEncoding.EncodeToString([]byte(string(protocol) + "-state"))
+		if protocol == componentconfig.ProtocolV1 {
+			w.Write([]byte(`{"state":"` + state + `"}`))
+			return
+		}
+		w.Write([]byte(`{"patchType":"application/merge-patch+json","patch":{"Labels":{"a":"b"}},"state":"` + state +
+			`"}`))
+	})
+	server.RegisterHandler(HookPath(componentconfig.PostHookType, "/containers/create"), func(w http.ResponseWriter,
+		req *http.Request) {
+		protocol := componentconfig.ProtocolType(req.Header.Get(HeaderProtocol))
+		r := received{uid: req.Header.Get(HeaderRequestUID)}
+		if protocol == componentconfig.ProtocolV1 {
+			data := &PostHookData{}
+			gjson.NewDecoder(req.Body).Decode(data)
+			r.originalRequest, r.request = string(data.OriginalRequest), string(data.Request)
+			r.state = string(data.State)
+		} else {
+			r.originalRequest = decode(req.Header.Get(HeaderOriginalRequest))
+			r.request = decode(req.Header.Get(HeaderRequest))
+			r.state = decode(req.Header.Get(HeaderHookState))
+		}
+
+		lock.Lock()
+		post[protocol] = r
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	})
+
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		server.Start()
+	}()
+	defer server.Stop()
+	<-ready
+
+	hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})), WithSystemd(false))
+
+	// v2 runs first and patches the labels, so both see the same bodies
+	for i, protocol := range []componentconfig.ProtocolType{componentconfig.ProtocolV2, componentconfig.ProtocolV1} {
+		hc := newHookConnector(string(protocol), server.GetAddress())
+		hc.protocol = protocol
+		hc.maxPostHookHeader = defaultMaxPostHookHeader
+		if err := hm.RegisterHook(HookRegistration{
+			Name:     string(protocol),
+			Handler:  hc,
+			Priority: -i,
+			Stages: componentconfig.HookStageList{
+				{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+				{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PostHookType},
+			},
+		}); err != nil {
+			t.Fatalf("can't register hook: %v", err)
+		}
+	}
+
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(`{"Image":"a"}`)))
+	if ans.Code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be %d, body %s", ans.Code, http.StatusCreated, ans.Body)
+	}
+
+	uid := uids[componentconfig.ProtocolV1]
+	if len(uid) == 0 || uid != uids[componentconfig.ProtocolV2] {
+		t.Errorf("expect pre hooks to get the same UID, %+v", uids)
+	}
+	for _, protocol := range []componentconfig.ProtocolType{componentconfig.ProtocolV1, componentconfig.ProtocolV2} {
+		expected := received{
+			uid:             uids[protocol],
+			originalRequest: `{"Image":"a"}`,
+			request:         `{"Image":"a","Labels":{"a":"b"}}`,
+			state:           string(protocol) + "-state",
+		}
+		if post[protocol] != expected {
+			t.Errorf("%s: expect post hook to get %+v, got %+v", protocol, expected, post[protocol])
+		}
+	}
+}
+
+func TestPostHookHeaderSize(t *testing.T) {
+	hc := &hookerConnector{name: "v2", maxPostHookHeader: 8}
+	header := http.Header{}
+	hc.setBase64Header(header, HeaderHookState, []byte("state"))
+	hc.setBase64Header(header, HeaderRequest, []byte(`{"Image":"a"}`))
+	if header.Get(HeaderHookState) != "c3RhdGU=" {
+		t.Errorf("expect small header to be sent, got %q", header.Get(HeaderHookState))
+	}
+	if _, found := header[HeaderRequest]; found {
+		t.Errorf("expect header larger than %d bytes not to be sent, got %q", hc.maxPostHookHeader,
+			header.Get(HeaderRequest))
+	}
+}
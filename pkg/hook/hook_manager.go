@@ -3,92 +3,208 @@ package hook
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/coreos/go-systemd/v22/activation"
 	systemd "github.com/coreos/go-systemd/v22/daemon"
 	jsonpatch "github.com/evanphx/json-patch"
-	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
 
 	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
-	"github.com/mYmNeo/lighthouse/pkg/util"
+	"github.com/mYmNeo/lighthouse/pkg/trace"
 )
 
-type hookManager struct {
-	timeout       time.Duration
-	listenAddress string
-	mux           *mux.Router
-	backend       http.Handler
-}
+// Manager applies the hooks to the requests sent to the Docker daemon. It's built from the configuration by
+// InitFromConfig, or by the options and RegisterHook if lighthouse is embedded in another program
+type Manager struct {
+	timeout time.Duration
+	backend http.Handler
+	// proxy is the backend wrapped by the backend middlewares
+	proxy     http.Handler
+	listeners []*hookListener
+	// handler serves requests of the first listener, or all the hooks if there is no listener
+	handler    http.Handler
+	routes     *routeHolder
+	admin      *hookListener
+	asyncQueue *asyncQueue
+	metrics    *hookMetrics
+	translator *apiTranslator
+	inventory  *inventory
+	tracer     *trace.Tracer
+	systemd    bool
+
+	middlewares        []Middleware
+	backendMiddlewares []Middleware
+	// provided are the listeners given by WithListener
+	provided map[string][]net.Listener
+	// listenerErr is the error of adding the provided listeners, it's returned by Run
+	listenerErr error
+
+	// lock protects the hooks and the routers built from them, and the configuration applied by InitFromConfig
+	lock  sync.Mutex
+	hooks []*hookHandle
 
-type hookHandleKey struct {
-	Method     string
-	URLPattern string
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	// runDone is closed when Run returns, it's nil if Run is not called
+	runDone chan struct{}
 }
 
-type hookHandleData struct {
-	preHooks  []HookHandler
-	postHooks []HookHandler
+type hookHandle struct {
+	HookHandler
+	name          string
+	priority      int
+	failurePolicy componentconfig.FailurePolicyType
+	// sideEffectOnly hooks run concurrently, their patches are dropped
+	sideEffectOnly bool
+	// async hooks are side effect only, and they are queued without waiting
+	async  bool
+	stages componentconfig.HookStageList
+	// limiter limits the concurrent calls of the hook, it's nil if they are unlimited
+	limiter *concurrencyLimiter
+	// cache keeps the answers of the hook, it's nil if they are not cached
+	cache *hookCache
+	// sandboxAware hooks patch the pod level fields only on the sandboxes of kubelet
+	sandboxAware bool
+	// configured hooks are built from the configuration, they are replaced by InitFromConfig
+	configured bool
 }
 
-func NewHookManager() *hookManager {
-	hm := &hookManager{
-		mux: mux.NewRouter(),
+// NewManager returns a manager without hooks, the backend must be given by an option or InitFromConfig before Run
+func NewManager(opts ...Option) *Manager {
+	hm := &Manager{
+		timeout:    defaultTimeout,
+		asyncQueue: newAsyncQueue(defaultAsyncWorkers, defaultAsyncQueueSize),
+		systemd:    true,
+		provided:   make(map[string][]net.Listener),
+		routes:     &routeHolder{},
+		stopCh:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(hm)
 	}
 
+	if hm.metrics == nil {
+		hm.metrics = newHookMetrics(prometheus.NewRegistry())
+	}
+	if hm.backend != nil {
+		hm.setBackend(hm.backend)
+	}
+
+	// listeners given by options are served without configuration
+	listeners, err := hm.addProvidedListeners(hm.listeners)
+	if err != nil {
+		klog.Errorf("can't add listeners, %v", err)
+		hm.listenerErr = err
+	}
+	hm.listeners = listeners
+	hm.setHandler()
+	hm.buildRouters()
+
 	return hm
 }
 
-func (hm *hookManager) Run(stop <-chan struct{}) error {
-	proto, addr, err := util.GetProtoAndAddress(hm.listenAddress)
-	if err != nil {
-		return err
+// NewHookManager returns a manager which is configured by InitFromConfig
+func NewHookManager() *Manager {
+	return NewManager()
+}
+
+// Run serves the listeners until stop is closed, Shutdown is called, or a listener fails
+func (hm *Manager) Run(stop <-chan struct{}) error {
+	hm.lock.Lock()
+	if hm.backend == nil {
+		hm.lock.Unlock()
+		return fmt.Errorf("no backend")
 	}
+	if hm.listenerErr != nil {
+		hm.lock.Unlock()
+		return fmt.Errorf("can't add listeners, %v", hm.listenerErr)
+	}
+	// InitFromConfig is refused from now on, so the listeners and the backend are not changed while serving
+	runDone := make(chan struct{})
+	defer close(runDone)
+	hm.runDone = runDone
+	hm.lock.Unlock()
 
-	/** Abstract unix socket is not supported */
-	if proto == util.UnixProto {
-		if strings.HasPrefix(addr, "@") {
-			klog.Fatalf("can't use abstract unix socket %s", addr)
+	activated := make(map[string][]net.Listener)
+	if hm.systemd {
+		var err error
+		if activated, err = activation.ListenersWithNames(); err != nil {
+			return fmt.Errorf("can't get listeners passed by systemd, %v", err)
 		}
-		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
-			return err
+	}
+	// listeners given by options take precedence over the ones passed by systemd
+	for name, ls := range hm.provided {
+		activated[name] = append(append([]net.Listener(nil), ls...), activated[name]...)
+	}
+
+	ch := make(chan error, len(hm.listeners))
+	for _, hl := range hm.listeners {
+		l, err := hl.listen(activated)
+		if err != nil {
+			hm.closeListeners()
+			return fmt.Errorf("can't listen on %s, %v", hl.address, err)
 		}
+
+		go func(hl *hookListener) {
+			ch <- hl.serve(l)
+		}(hl)
 	}
+	// the changes of the inventory are written after the listeners are closed
+	defer hm.inventory.flush()
+	defer hm.closeListeners()
+	defer hm.tracer.Close()
+	defer hm.closeHooks()
+	// the queued async hooks run before the hooks are closed
+	defer func() {
+		hm.lock.Lock()
+		q := hm.asyncQueue
+		hm.lock.Unlock()
+		hm.closeAsyncQueue(q)
+	}()
 
-	l, err := net.Listen(proto, addr)
-	if err != nil {
-		return err
+	for name, ls := range activated {
+		for _, l := range ls {
+			klog.Warningf("Socket %s(%s) passed by systemd is not used by any listener", name, l.Addr().String())
+			l.Close()
+		}
 	}
 
-	ready := make(chan struct{})
-	ch := make(chan error)
-	go func() {
-		close(ready)
-		ch <- http.Serve(l, hm)
-	}()
+	if hm.inventory != nil {
+		if err := hm.inventory.reconcile(hm.backend); err != nil {
+			klog.Warningf("can't reconcile inventory, %v", err)
+		}
+	}
 
-	<-ready
 	klog.Infof("Hook manager is running")
 
-	sent, err := systemd.SdNotify(true, "READY=1\n")
-	if err != nil {
-		klog.Warningf("Unable to send systemd daemon successful start message: %v\n", err)
-	}
+	if hm.systemd {
+		sent, err := systemd.SdNotify(true, "READY=1\n")
+		if err != nil {
+			klog.Warningf("Unable to send systemd daemon successful start message: %v\n", err)
+		}
 
-	if !sent {
-		klog.Warningf("Unable to send systemd daemon Type=notify in systemd service file?")
+		if !sent {
+			klog.Warningf("Unable to send systemd daemon Type=notify in systemd service file?")
+		}
+
+		go hm.watchdog(stop)
 	}
 
 	select {
 	case <-stop:
+	case <-hm.stopCh:
 	case e := <-ch:
 		return e
 	}
@@ -96,176 +212,805 @@ func (hm *hookManager) Run(stop <-chan struct{}) error {
 	return nil
 }
 
-func (hm *hookManager) InitFromConfig(config *componentconfig.HookConfiguration) error {
+// Shutdown stops the listeners gracefully, the active requests are waited until ctx is done. Run returns after the
+// hooks are closed
+func (hm *Manager) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, hl := range hm.listeners {
+		if err := hl.shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("can't shutdown listener %s, %v", hl.name, err))
+		}
+	}
+	hm.stopOnce.Do(func() {
+		close(hm.stopCh)
+	})
+
+	hm.lock.Lock()
+	runDone := hm.runDone
+	hm.lock.Unlock()
+
+	if runDone != nil {
+		select {
+		case <-runDone:
+		case <-ctx.Done():
+			errs = append(errs, ctx.Err())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (hm *Manager) closeListeners() {
+	for _, hl := range hm.listeners {
+		if err := hl.close(); err != nil {
+			klog.Warningf("can't close listener %s, %v", hl.name, err)
+		}
+	}
+}
+
+func (hm *Manager) closeHooks() {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	closeHandles(hm.hooks)
+}
+
+// closeHandles closes the handlers of hooks which are io.Closer, e.g. the connections of grpc webhooks
+func closeHandles(hooks []*hookHandle) {
+	for _, h := range hooks {
+		if h == nil {
+			continue
+		}
+		if c, ok := h.HookHandler.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				klog.Warningf("can't close hook %s, %v", h.name, err)
+			}
+		}
+	}
+}
+
+// InitFromConfig builds the hooks, the listeners and the backend from config. Nothing is changed if config is
+// invalid, and the manager can't be initialized again after Run is called
+func (hm *Manager) InitFromConfig(config *componentconfig.HookConfiguration) error {
+	hm.lock.Lock()
+	running := hm.runDone != nil
+	registeredNames := make(map[string]bool, len(hm.hooks))
+	for _, h := range hm.hooks {
+		if !h.configured {
+			registeredNames[h.name] = true
+		}
+	}
+	hm.lock.Unlock()
+	if running {
+		return fmt.Errorf("can't init hook manager after it's running")
+	}
+
 	klog.Infof("Hook timeout: %d seconds", config.Timeout)
-	hm.timeout = config.Timeout * time.Second
-	hm.backend = newReverseProxy(config.RemoteEndpoint)
-	hm.listenAddress = config.ListenAddress
-
-	hooksMap := make(map[hookHandleKey]*hookHandleData)
-	for _, r := range config.WebHooks {
-		klog.Infof("Register hook %s, endpoint %s", r.Name, r.Endpoint)
-		hc := newHookConnector(r.Name, r.Endpoint, r.FailurePolicy)
-		for _, fp := range r.Stages {
-			klog.Infof("Register %s %s %s with %s", fp.Type, fp.Method, fp.URLPattern, hc.endpoint)
-			key := hookHandleKey{
-				Method:     fp.Method,
-				URLPattern: fp.URLPattern,
+	// a backend given by options takes precedence over the remote endpoint
+	backend := hm.backend
+	if backend == nil {
+		backend = newReverseProxy(config.RemoteEndpoint)
+	}
+
+	var translator *apiTranslator
+	if config.APITranslation.Enabled {
+		klog.Infof("Translate API to version %s", config.APITranslation.CanonicalAPIVersion)
+		t, err := newAPITranslator(config.APITranslation.CanonicalAPIVersion, config.APITranslation.BackendAPIVersion,
+			backend)
+		if err != nil {
+			return fmt.Errorf("invalid API translation, %v", err)
+		}
+		translator = t
+	}
+
+	var inv *inventory
+	if config.Inventory.Enabled {
+		// the state file is loaded with the changes of the current inventory
+		hm.lock.Lock()
+		current := hm.inventory
+		hm.lock.Unlock()
+		current.flush()
+
+		var err error
+		if inv, err = newInventory(&config.Inventory); err != nil {
+			return err
+		}
+	}
+
+	handles := make([]*hookHandle, len(config.WebHooks))
+	// a tracer given by options takes precedence over the tracing of the configuration
+	tracer := hm.tracer
+	// the tracer and the handlers built are closed if the configuration is not applied
+	applied := false
+	defer func() {
+		if !applied {
+			closeHandles(handles)
+			if tracer != hm.tracer {
+				tracer.Close()
 			}
+		}
+	}()
+	if tracer == nil {
+		t, err := newTracer(&config.Tracing)
+		if err != nil {
+			return fmt.Errorf("invalid tracing, %v", err)
+		}
+		tracer = t
+	}
 
-			hookData, found := hooksMap[key]
-			if !found {
-				hookData = &hookHandleData{
-					preHooks:  make([]HookHandler, 0),
-					postHooks: make([]HookHandler, 0),
+	webhookIndex := make(map[string]int)
+	for i, r := range config.WebHooks {
+		if _, found := webhookIndex[r.Name]; found {
+			return fmt.Errorf("duplicated webhook %s", r.Name)
+		}
+		if registeredNames[r.Name] {
+			return fmt.Errorf("webhook %s is already registered", r.Name)
+		}
+
+		var connector HookHandler
+		switch {
+		case r.Type == componentconfig.BuiltinWebHook:
+			klog.Infof("Register hook %s, builtin %s", r.Name, r.Builtin)
+			bh, err := newBuiltinHook(r.Builtin, &BuiltinConfig{
+				Name:    r.Name,
+				Options: r.Options.Raw,
+				Backend: backend,
+			})
+			if err != nil {
+				return fmt.Errorf("can't build builtin hook %s, %v", r.Name, err)
+			}
+			connector = bh
+		case len(r.Type) > 0 && r.Type != componentconfig.RemoteWebHook:
+			return fmt.Errorf("unknown type %s of webhook %s", r.Type, r.Name)
+		case r.Protocol == "" || r.Protocol == componentconfig.ProtocolV1 || r.Protocol == componentconfig.ProtocolV2:
+			klog.Infof("Register hook %s, endpoint %s", r.Name, r.Endpoint)
+			hc := newHookConnector(r.Name, r.Endpoint)
+			hc.healthPath = r.HealthPath
+			if len(r.Protocol) > 0 {
+				hc.protocol = r.Protocol
+			}
+			if r.PostHookHeaders.Enabled {
+				hc.maxPostHookHeader = r.PostHookHeaders.MaxSize
+				if hc.maxPostHookHeader <= 0 {
+					hc.maxPostHookHeader = defaultMaxPostHookHeader
 				}
 			}
+			connector = hc
+		case r.Protocol == componentconfig.ProtocolGRPC:
+			klog.Infof("Register hook %s, grpc endpoint %s", r.Name, r.Endpoint)
+			gc, err := newGRPCConnector(r.Name, r.Endpoint)
+			if err != nil {
+				return fmt.Errorf("can't connect to webhook %s, %v", r.Name, err)
+			}
+			connector = gc
+		default:
+			return fmt.Errorf("unknown protocol %s of webhook %s", r.Protocol, r.Name)
+		}
+		// the connector is closed if the rest of the webhook is invalid
+		handles[i] = &hookHandle{HookHandler: connector, name: r.Name}
+		if r.PostHookHeaders.Enabled && r.Protocol != componentconfig.ProtocolV2 {
+			return fmt.Errorf("post hook headers of webhook %s need protocol v2", r.Name)
+		}
+		limiter, err := newConcurrencyLimiter(r.Name, r.MaxInFlight, r.MaxQueueLength, r.QueueTimeout.Duration,
+			hm.metrics)
+		if err != nil {
+			return fmt.Errorf("invalid webhook %s, %v", r.Name, err)
+		}
+		if r.Cache.TTL.Duration > 0 && (r.SideEffectOnly || r.Async) {
+			return fmt.Errorf("side effect only webhook %s can't be cached", r.Name)
+		}
+		cache, err := newHookCache(r.Name, r.Cache, hm.metrics)
+		if err != nil {
+			return fmt.Errorf("invalid cache of webhook %s, %v", r.Name, err)
+		}
+		handles[i] = &hookHandle{
+			HookHandler:    connector,
+			name:           r.Name,
+			priority:       r.Priority,
+			failurePolicy:  r.FailurePolicy,
+			sideEffectOnly: r.SideEffectOnly || r.Async,
+			async:          r.Async,
+			stages:         r.Stages,
+			limiter:        limiter,
+			cache:          cache,
+			sandboxAware:   r.SandboxAware,
+			configured:     true,
+		}
+		webhookIndex[r.Name] = i
+	}
+
+	listenerConfigs := make(componentconfig.ListenerConfigurationList, 0, len(config.Listeners)+1)
+	if len(config.ListenAddress) > 0 {
+		listenerConfigs = append(listenerConfigs, componentconfig.ListenerConfiguration{
+			Name:        defaultListenerName,
+			Address:     config.ListenAddress,
+			SocketMode:  config.SocketMode,
+			SocketOwner: config.SocketOwner,
+		})
+	}
+	listenerConfigs = append(listenerConfigs, config.Listeners...)
+
+	listeners := make([]*hookListener, 0, len(listenerConfigs))
+	for i := range listenerConfigs {
+		lc := &listenerConfigs[i]
+		if len(lc.Name) == 0 {
+			lc.Name = fmt.Sprintf("listener-%d", i)
+		}
+
+		for _, name := range lc.WebHooks {
+			if _, found := webhookIndex[name]; !found {
+				return fmt.Errorf("listener %s refers to unknown webhook %s", lc.Name, name)
+			}
+		}
 
-			switch fp.Type {
-			case componentconfig.PreHookType:
-				hookData.preHooks = append(hookData.preHooks, hc)
-				hooksMap[key] = hookData
-			case componentconfig.PostHookType:
-				hookData.postHooks = append(hookData.postHooks, hc)
-				hooksMap[key] = hookData
+		hl, err := hm.newRouterListener(lc)
+		if err != nil {
+			return err
+		}
+
+		listeners = append(listeners, hl)
+	}
+
+	listeners, err := hm.addProvidedListeners(listeners)
+	if err != nil {
+		return err
+	}
+
+	var admin *hookListener
+	if len(config.AdminAddress) > 0 {
+		admin, err = newHookListener(&componentconfig.ListenerConfiguration{
+			Name:    adminListenerName,
+			Address: config.AdminAddress,
+		}, hm.buildAdminHandler())
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, admin)
+	}
+
+	// the configuration is applied at once, the hooks registered by RegisterHook are kept and the configured ones
+	// are replaced
+	hm.lock.Lock()
+	if hm.runDone != nil {
+		hm.lock.Unlock()
+		return fmt.Errorf("can't init hook manager after it's running")
+	}
+	var registered, replaced []*hookHandle
+	for _, h := range hm.hooks {
+		if h.configured {
+			replaced = append(replaced, h)
+			continue
+		}
+		if _, found := webhookIndex[h.name]; found {
+			hm.lock.Unlock()
+			return fmt.Errorf("webhook %s is already registered", h.name)
+		}
+		registered = append(registered, h)
+	}
+	applied = true
+
+	oldQueue := hm.asyncQueue
+	hm.timeout = config.Timeout * time.Second
+	hm.asyncQueue = newAsyncQueue(config.AsyncWorkers, config.AsyncQueueSize)
+	hm.translator = translator
+	hm.tracer = tracer
+	hm.inventory = inv
+	hm.setBackend(backend)
+	hm.listeners, hm.admin, hm.listenerErr = listeners, admin, nil
+	hm.hooks = append(handles, registered...)
+	hm.setHandler()
+	hm.buildRoutersLocked()
+	hm.lock.Unlock()
+
+	// the jobs queued before run on the hooks replaced
+	hm.closeAsyncQueue(oldQueue)
+	closeHandles(replaced)
+
+	return nil
+}
+
+// addProvidedListeners returns listeners with a listener serving all the hooks for each name given by WithListener
+// which is not configured
+func (hm *Manager) addProvidedListeners(listeners []*hookListener) ([]*hookListener, error) {
+	configured := make(map[string]bool, len(listeners))
+	for _, hl := range listeners {
+		configured[hl.name] = true
+	}
+
+	for name := range hm.provided {
+		if configured[name] {
+			continue
+		}
+
+		hl, err := hm.newRouterListener(&componentconfig.ListenerConfiguration{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, hl)
+	}
+
+	return listeners, nil
+}
+
+// buildRouters rebuilds the routers of the listeners from the hooks, requests being served keep the old routers
+func (hm *Manager) buildRouters() {
+	hm.lock.Lock()
+	defer hm.lock.Unlock()
+
+	hm.buildRoutersLocked()
+}
+
+// buildRoutersLocked is buildRouters with the lock held
+func (hm *Manager) buildRoutersLocked() {
+	build := func(name string, readOnly bool, serves func(webhook string) bool) *hookRouter {
+		router := &hookRouter{
+			serveHooks: hm.serveHooks,
+			backend:    hm.proxy,
+			readOnly:   readOnly,
+			translator: hm.translator,
+			inventory:  hm.inventory,
+		}
+
+		for _, h := range hm.hooks {
+			if !serves(h.name) {
+				continue
+			}
+
+			for _, fp := range h.stages {
+				klog.Infof("Register %s %s %s with %s on %s", fp.Type, fp.Method, fp.URLPattern, h.name, name)
+				if err := router.addRoute(fp, h); err != nil {
+					klog.Errorf("can't register %s %s %s of %s, %v", fp.Type, fp.Method, fp.URLPattern, h.name, err)
+				}
 			}
 		}
+
+		return router
+	}
+
+	hm.routes.store(build("manager", false, func(string) bool { return true }))
+	for _, hl := range hm.listeners {
+		if hl.router == nil {
+			continue
+		}
+		hl.router.store(build(hl.name, hl.readOnly, hl.serves))
+	}
+}
+
+// setHandler makes ServeHTTP serve the first listener, or all the hooks if there is no listener
+func (hm *Manager) setHandler() {
+	hm.handler = hm.traceRequests(wrap(hm.routes, hm.middlewares))
+	for _, hl := range hm.listeners {
+		if hl.router != nil {
+			hm.handler = hl.handler
+			return
+		}
+	}
+}
+
+// setBackend sets the backend, the requests are sent to it through the backend middlewares and the inventory
+func (hm *Manager) setBackend(backend http.Handler) {
+	hm.backend = backend
+	if hm.inventory != nil {
+		backend = hm.inventory.track(backend)
+	}
+	hm.proxy = wrap(hm.traceBackend(backend), hm.backendMiddlewares)
+}
+
+// newRouterListener returns a listener serving the hooks through the middlewares
+func (hm *Manager) newRouterListener(config *componentconfig.ListenerConfiguration) (*hookListener, error) {
+	hl, err := newRouterListener(config)
+	if err != nil {
+		return nil, err
+	}
+
+	hl.handler = hm.traceRequests(wrap(hl.router, hm.middlewares))
+	hl.server.Handler = hl.handler
+	return hl, nil
+}
+
+// serveHooks sends the request to the backend with hooks applied
+func (hm *Manager) serveHooks(w http.ResponseWriter, r *http.Request, chain *hookChain) {
+	if err := hm.buildPreHookHandlerFunc(chain)(w, r); err != nil {
+		return
 	}
 
-	for k, v := range hooksMap {
-		klog.V(2).Infof("Build router: %s %s", k.Method, k.URLPattern)
-		preHookChainHandler := hm.buildPreHookHandlerFunc(v.preHooks)
-		postHookChainHandler := hm.buildPostHookHandlerFunc(v.postHooks)
+	backendReq := r
+	if chain.translation != nil {
+		u := *r.URL
+		u.Path, u.RawPath = chain.translation.backendPath, ""
+		backendReq = new(http.Request)
+		*backendReq = *r
+		backendReq.URL = &u
+	}
 
-		hm.mux.Methods(k.Method).Path(k.URLPattern).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if err := preHookChainHandler(w, r); err != nil {
+	klog.V(4).Infof("Send data to backend path %s", backendReq.URL.Path)
+	var recorder *httptest.ResponseRecorder
+	if chain.maxResponseBodySize > 0 {
+		// the response larger than the limit is streamed without post hooks if they can be bypassed
+		limited := newLimitedRecorder(w, chain.maxResponseBodySize, canBypass(chain.translation, chain.postHooks))
+		hm.proxy.ServeHTTP(limited, backendReq)
+		if limited.exceeded {
+			if limited.bypass {
+				klog.Warningf("Bypass post hooks of %s %s, response body is larger than %d bytes", r.Method,
+					r.URL.Path, chain.maxResponseBodySize)
 				return
 			}
+			klog.Warningf("Reject response of %s %s, body is larger than %d bytes", r.Method, r.URL.Path,
+				chain.maxResponseBodySize)
+			bodyTooLarge(w, "response", chain.maxResponseBodySize)
+			return
+		}
+		recorder = limited.ResponseRecorder
+	} else {
+		recorder = httptest.NewRecorder()
+		hm.proxy.ServeHTTP(recorder, backendReq)
+	}
+	klog.V(4).Infof("Finish backend path %s", backendReq.URL.Path)
 
-			klog.V(4).Infof("Send data to backend path %s", r.URL.Path)
-			recorder := httptest.NewRecorder()
-			hm.backend.ServeHTTP(recorder, r)
-			klog.V(4).Infof("Finish backend path %s", r.URL.Path)
+	backendLength := recorder.Body.Len()
+	hm.buildPostHookHandlerFunc(chain)(recorder, r)
+	for k, vs := range recorder.Header() {
+		for _, v := range vs {
+			w.Header().Set(k, v)
+		}
+	}
+	// the length of the backend doesn't match the body rewritten by the post hooks or the translation
+	if recorder.Body.Len() != backendLength {
+		w.Header().Del("Content-Length")
+	}
+	w.WriteHeader(recorder.Code)
+	w.Write(recorder.Body.Bytes())
+}
 
-			postHookChainHandler(recorder, r)
-			for k, vs := range recorder.Header() {
-				for _, v := range vs {
-					w.Header().Set(k, v)
-				}
+func (hm *Manager) applyHook(ctx context.Context, handlers []*hookHandle, hookType componentconfig.HookType,
+	conflictPolicy componentconfig.ConflictPolicyType, method, path string, body *[]byte) error {
+	var wg sync.WaitGroup
+	// side effect only hooks are waited before returning
+	defer wg.Wait()
+
+	tracker := newPatchTracker(conflictPolicy, hookType, hm.metrics)
+	defer tracker.report(method, path)
+	decisions := decisionLogFrom(ctx)
+	patchedAny := false
+
+	for idx, h := range handlers {
+		if h.sideEffectOnly {
+			hm.performSideEffectHook(ctx, &wg, h, hookType, method, path, *body)
+			continue
+		}
+
+		klog.V(4).Infof("Send to %s handler %d", hookType, idx)
+		hookCtx, span := hm.startHookSpan(ctx, h, hookType)
+		patched, err := performHook(hookCtx, h, hookType, method, path, *body)
+		span.SetError(err)
+		span.Finish()
+		if err != nil {
+			// a denial is not a failure of the hook
+			var denied *DeniedError
+			if errors.As(err, &denied) {
+				decisions.add(h, hookType, DecisionDenied, err, nil)
+			} else if h.failurePolicy == componentconfig.PolicyIgnore {
+				decisions.add(h, hookType, DecisionIgnored, err, nil)
+				klog.Warningf("Ignore failure of %s %s %s %s, %v", h.name, hookType, method, path, err)
+				continue
+			} else {
+				decisions.add(h, hookType, DecisionFailed, err, nil)
 			}
-			w.WriteHeader(recorder.Code)
-			w.Write(recorder.Body.Bytes())
-		})
+
+			klog.Errorf("can't perform %s %s %s %s, %v", h.name, hookType, method, path, err)
+			return err
+		}
+
+		if patched != nil && h.sandboxAware && hookType == componentconfig.PreHookType {
+			info := RequestInfoFrom(ctx)
+			routed, skipped, err := routeSandboxFields(info.ContainerType, *body, patched)
+			if err != nil {
+				decisions.add(h, hookType, DecisionFailed, err, nil)
+				return err
+			}
+			if len(skipped) > 0 {
+				klog.V(4).Infof("Skip %v of %s for %s %s", skipped, h.name, info.ContainerType, path)
+			}
+			patched = routed
+		}
+
+		if patched == nil {
+			decisions.add(h, hookType, DecisionUnchanged, nil, nil)
+			continue
+		}
+
+		if tracker != nil {
+			if err := tracker.record(h.name, *body, patched); err != nil {
+				decisions.add(h, hookType, DecisionFailed, err, nil)
+				return err
+			}
+		}
+
+		if decisions.enabled() {
+			decision := DecisionUnchanged
+			changed, _ := changedPointers(*body, patched)
+			if len(changed) > 0 {
+				decision = DecisionPatched
+			}
+			decisions.add(h, hookType, decision, nil, changed)
+		}
+		*body = patched
+		patchedAny = true
+	}
+
+	// the escaped characters are equivalent in JSON, so the patched body is unescaped once after the chain
+	if patchedAny {
+		*body = fixUnexpectedEscape(*body)
 	}
 
 	return nil
 }
 
-func (hm *hookManager) applyHook(ctx context.Context, handlers []HookHandler, hookType componentconfig.HookType,
-	method, path string, body *[]byte) error {
-	var err error
+// performHook calls the hook and returns the patched body, nil is returned if the hook doesn't patch the body
+func performHook(ctx context.Context, h *hookHandle, hookType componentconfig.HookType, method, path string,
+	body []byte) ([]byte, error) {
+	info := RequestInfoFrom(ctx)
+	exchange := info.exchange
 
-	for idx, h := range handlers {
-		hookErr := func() error {
-			klog.V(4).Infof("Send to %s handler %d", hookType, idx)
-			patch := &PatchData{}
+	var key cacheKey
+	if h.cache != nil {
+		if hookType == componentconfig.PreHookType {
+			// the query is rewritten by pre hooks, so it's a part of the key
+			query, _, _ := exchange.request()
+			key = newCacheKey(hookType, method, path+"?"+query.Encode(), 0, nil, nil, body)
+		} else {
+			_, request := exchange.bodies()
+			key = newCacheKey(hookType, method, path, info.StatusCode, request, exchange.state(h.name), body)
+		}
+	}
+
+	patch, err, cached := h.cache.get(key)
+	if !cached {
+		patch, err = callHook(ctx, h, hookType, method, path, body)
+		h.cache.put(key, patch, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if hookType == componentconfig.PreHookType {
+		exchange.setState(h.name, patch.State)
+		exchange.rewrite(patch.Query, patch.Header)
+	}
+
+	if patch.PatchData == nil {
+		return nil, nil
+	}
+
+	return applyPatch(patch, body)
+}
+
+// callHook sends the body to the hook within its concurrency limit
+func callHook(ctx context.Context, h *hookHandle, hookType componentconfig.HookType, method, path string,
+	body []byte) (*PatchData, error) {
+	release, err := h.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	patch := &PatchData{}
+	switch hookType {
+	case componentconfig.PreHookType:
+		if err := h.PreHook(ctx, patch, method, path, body); err != nil {
+			klog.Errorf("preHook failed, %v", err)
+			return nil, err
+		}
+	case componentconfig.PostHookType:
+		patch.State = RequestInfoFrom(ctx).exchange.state(h.name)
+		if err := h.PostHook(ctx, patch, method, path, body); err != nil {
+			klog.Errorf("postHook failed, %v", err)
+			return nil, err
+		}
+	}
+
+	return patch, nil
+}
+
+// applyPatch returns the body patched by the patch of a hook, the HTML characters escaped by JSON and merge patches
+// are kept, they are unescaped once by applyHook
+func applyPatch(patch *PatchData, body []byte) ([]byte, error) {
+	switch types.PatchType(patch.PatchType) {
+	case types.JSONPatchType:
+		p, err := jsonpatch.DecodePatch(patch.PatchData)
+		if err != nil {
+			klog.Errorf("can't decode patch, %v", err)
+			return nil, err
+		}
+		patched, err := p.Apply(body)
+		if err != nil {
+			klog.Errorf("can't apply patch, %v", err)
+			return nil, err
+		}
+		return patched, nil
+	case types.MergePatchType:
+		patched, err := jsonpatch.MergePatch(body, patch.PatchData)
+		if err != nil {
+			klog.Errorf("can't merge patch, %v", err)
+			return nil, err
+		}
+		return patched, nil
+	case types.StrategicMergePatchType:
+		patched, err := strategicMergePatch(body, patch.PatchData)
+		if err != nil {
+			klog.Errorf("can't apply strategic merge patch, %v", err)
+			return nil, err
+		}
+		return patched, nil
+	default:
+		return nil, fmt.Errorf("unknown patch type: %s", patch.PatchType)
+	}
+}
+
+// performSideEffectHook runs the hook concurrently, or queues it if the hook is async. The error of the hook is only
+// logged according to its failure policy
+func (hm *Manager) performSideEffectHook(ctx context.Context, wg *sync.WaitGroup, h *hookHandle,
+	hookType componentconfig.HookType, method, path string, body []byte) {
+	decisions := decisionLogFrom(ctx)
+	// a replayed request must not notify anything
+	if decisions.replaying() {
+		decisions.add(h, hookType, DecisionSkipped, nil, nil)
+		return
+	}
 
+	perform := func(ctx context.Context) {
+		ctx, span := hm.startHookSpan(ctx, h, hookType)
+		defer span.Finish()
+
+		release, err := h.limiter.acquire(ctx)
+		if err == nil {
+			defer release()
+
+			patch := &PatchData{}
+			exchange := RequestInfoFrom(ctx).exchange
 			switch hookType {
 			case componentconfig.PreHookType:
-				if err := h.PreHook(ctx, patch, method, path, *body); err != nil {
-					klog.Errorf("preHook failed, %v", err)
-					return err
+				if err = h.PreHook(ctx, patch, method, path, body); err == nil {
+					exchange.setState(h.name, patch.State)
 				}
 			case componentconfig.PostHookType:
-				if err := h.PostHook(ctx, patch, method, path, *body); err != nil {
-					klog.Errorf("postHook failed, %v", err)
-					return err
-				}
+				patch.State = exchange.state(h.name)
+				err = h.PostHook(ctx, patch, method, path, body)
 			}
+		}
 
-			if patch.PatchData == nil {
-				return nil
-			}
+		if !h.async {
+			decisions.add(h, hookType, DecisionSideEffect, err, nil)
+		}
+		span.SetError(err)
+		if err == nil {
+			return
+		}
 
-			switch types.PatchType(patch.PatchType) {
-			case types.JSONPatchType:
-				p, err := jsonpatch.DecodePatch(patch.PatchData)
-				if err != nil {
-					klog.Errorf("can't decode patch, %v", err)
-					return err
-				}
-				*body, err = p.Apply(*body)
-				if err != nil {
-					klog.Errorf("can't apply patch, %v", err)
-					return err
-				}
-			case types.MergePatchType:
-				*body, err = jsonpatch.MergePatch(*body, patch.PatchData)
-				if err != nil {
-					klog.Errorf("can't merge patch, %v", err)
-					return err
-				}
-			default:
-				return fmt.Errorf("unknown patch type: %s", patch.PatchType)
-			}
+		if h.failurePolicy == componentconfig.PolicyIgnore {
+			klog.V(4).Infof("Ignore failure of side effect %s %s %s %s, %v", h.name, hookType, method, path, err)
+			return
+		}
+		klog.Errorf("can't perform side effect %s %s %s %s, %v", h.name, hookType, method, path, err)
+	}
 
-			return nil
-		}()
+	// body may be changed by the following hooks
+	body = append([]byte(nil), body...)
 
-		if hookErr == nil {
-			continue
+	if h.async {
+		info, sc := RequestInfoFrom(ctx), trace.SpanContextFrom(ctx)
+		if err := hm.queueAsync(func() {
+			// async hooks outlive the request, they only keep its RequestInfo and trace
+			ctx := trace.ContextWithSpanContext(WithRequestInfo(context.Background(), info), sc)
+			ctx, cancel := context.WithTimeout(ctx, hm.timeout)
+			defer cancel()
+			perform(ctx)
+		}); err != nil {
+			klog.Errorf("can't queue async %s %s %s %s, %v", h.name, hookType, method, path, err)
+			decisions.add(h, hookType, DecisionQueued, err, nil)
+			return
 		}
+		decisions.add(h, hookType, DecisionQueued, nil, nil)
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		perform(ctx)
+	}()
+}
 
-		klog.Errorf("can't perform %s %s %s, %v", hookType, method, path, hookErr)
-		return hookErr
+// queueAsync adds the job to the async queue, it's added to the new queue if the queue is replaced meanwhile
+func (hm *Manager) queueAsync(job func()) error {
+	var last *asyncQueue
+	for {
+		hm.lock.Lock()
+		q := hm.asyncQueue
+		hm.lock.Unlock()
+
+		err := q.add(job)
+		switch {
+		case err == errAsyncQueueFull:
+			hm.metrics.asyncDropped.WithLabelValues("full").Inc()
+			return err
+		case err == errAsyncQueueClosed && q != last:
+			last = q
+			continue
+		case err == errAsyncQueueClosed:
+			hm.metrics.asyncDropped.WithLabelValues("closed").Inc()
+			return err
+		}
+		return nil
 	}
+}
 
-	return nil
+// closeAsyncQueue closes q after the queued jobs run, the ones left after asyncDrainTimeout are dropped
+func (hm *Manager) closeAsyncQueue(q *asyncQueue) {
+	if dropped := q.close(asyncDrainTimeout); dropped > 0 {
+		klog.Warningf("Drop %d async hooks left in the queue after %v", dropped, asyncDrainTimeout)
+		hm.metrics.asyncDropped.WithLabelValues("closed").Add(float64(dropped))
+	}
 }
 
-func (hm *hookManager) buildPostHookHandlerFunc(handlers []HookHandler) PostHookFunc {
+func (hm *Manager) buildPostHookHandlerFunc(chain *hookChain) PostHookFunc {
 	return func(w *httptest.ResponseRecorder, r *http.Request) {
 		ctx, cancel := context.WithTimeout(context.Background(), hm.timeout)
 		defer cancel()
+		// hooks get the status code of the backend response
+		info := *RequestInfoFrom(r.Context())
+		info.StatusCode = w.Code
+		info.OriginalRequestBody, info.RequestBody = info.exchange.bodies()
+		ctx = hookContext(ctx, r, &info)
 
-		data := &PostHookData{
-			StatusCode: w.Code,
-			Body:       w.Body.Bytes(),
-		}
-
+		bodyBytes := w.Body.Bytes()
 		w.Body.Reset()
 
-		bodyBytes, err := json.Marshal(data)
-		if err != nil {
-			klog.Errorf("can't marshal post hook data, %v", err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
-			return
+		translated := chain.translation != nil && w.Code >= http.StatusOK && w.Code < http.StatusMultipleChoices
+		if translated {
+			body, err := chain.translation.toCanonical(bodyBytes, false)
+			if err != nil {
+				klog.Errorf("can't translate response of %s to version %s, %v", r.URL.Path,
+					chain.translation.canonicalVersion, err)
+				translated = false
+			} else {
+				bodyBytes = body
+			}
 		}
 
-		klog.V(4).Infof("PostHook request %s, body: %s", r.URL.Path, string(bodyBytes))
-		if err := hm.applyHook(ctx, handlers, componentconfig.PostHookType, r.Method, r.URL.Path, &bodyBytes); err != nil {
+		klog.V(4).Infof("PostHook request %s, status code: %d, body: %s", r.URL.Path, w.Code, string(bodyBytes))
+		if err := hm.applyHook(ctx, chain.postHooks, componentconfig.PostHookType, chain.postConflictPolicy,
+			r.Method, r.URL.Path, &bodyBytes); err != nil {
 			klog.Errorf("can't perform postHook, %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(hookErrorStatusCode(err))
 			w.Write([]byte(err.Error()))
 			return
 		}
 
-		bodyBytes = fixUnexpectedEscape(bodyBytes)
-		if err := json.Unmarshal(bodyBytes, data); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
+		if translated {
+			body, err := chain.translation.fromCanonical(bodyBytes, true)
+			if err != nil {
+				klog.Errorf("can't translate response of %s to version %s, %v", r.URL.Path,
+					chain.translation.clientVersion, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			bodyBytes = body
 		}
 
-		w.Write(data.Body)
+		w.Write(bodyBytes)
 	}
 }
 
-func (hm *hookManager) buildPreHookHandlerFunc(handlers []HookHandler) PreHookFunc {
+func (hm *Manager) buildPreHookHandlerFunc(chain *hookChain) PreHookFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		ctx, cancel := context.WithTimeout(context.Background(), hm.timeout)
 		defer cancel()
+		ctx = hookContext(ctx, r, RequestInfoFrom(r.Context()))
 
 		bodyBytes, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -274,15 +1019,49 @@ func (hm *hookManager) buildPreHookHandlerFunc(handlers []HookHandler) PreHookFu
 			return err
 		}
 
+		if chain.translation != nil {
+			if bodyBytes, err = chain.translation.toCanonical(bodyBytes, true); err != nil {
+				klog.Errorf("can't translate request %s to version %s, %v", r.URL.Path,
+					chain.translation.canonicalVersion, err)
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return err
+			}
+		}
+
 		klog.V(4).Infof("PreHook request %s, body: %s", r.URL.Path, string(bodyBytes))
-		if err := hm.applyHook(ctx, handlers, componentconfig.PreHookType, r.Method, r.URL.Path, &bodyBytes); err != nil {
+		originalBody := bodyBytes
+		info := RequestInfoFrom(ctx)
+		exchange := info.exchange
+		exchange.setRequest(r.URL.Query(), r.Header.Clone())
+		if _, path := splitVersionedPath(r.URL.Path); r.Method == http.MethodPost && path == "/containers/create" {
+			hm.describeCreate(info, bodyBytes)
+		}
+		if err := hm.applyHook(ctx, chain.preHooks, componentconfig.PreHookType, chain.preConflictPolicy,
+			r.Method, r.URL.Path, &bodyBytes); err != nil {
 			klog.Errorf("can't perform preHook, %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(hookErrorStatusCode(err))
 			w.Write([]byte(err.Error()))
 			return err
 		}
+		// post hooks get the request bodies in the canonical version as the pre hooks
+		exchange.setBodies(originalBody, bodyBytes)
+		if query, header, rewritten := exchange.request(); rewritten {
+			klog.V(4).Infof("Rewrite request %s, query: %s", r.URL.Path, query.Encode())
+			u := *r.URL
+			u.RawQuery = query.Encode()
+			r.URL, r.Header = &u, header
+		}
 
-		bodyBytes = fixUnexpectedEscape(bodyBytes)
+		if chain.translation != nil {
+			if bodyBytes, err = chain.translation.fromCanonical(bodyBytes, false); err != nil {
+				klog.Errorf("can't translate request %s to version %s, %v", r.URL.Path,
+					chain.translation.backendVersion, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(err.Error()))
+				return err
+			}
+		}
 		newBody := bytes.NewBuffer(bodyBytes)
 		r.Body = ioutil.NopCloser(newBody)
 		r.ContentLength = int64(newBody.Len())
@@ -290,13 +1069,27 @@ func (hm *hookManager) buildPreHookHandlerFunc(handlers []HookHandler) PreHookFu
 	}
 }
 
-func (hm *hookManager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var match mux.RouteMatch
-	if hm.mux.Match(req, &match) {
-		klog.V(5).Infof("Handle request %s %s", req.Method, req.URL.Path)
-		hm.mux.ServeHTTP(w, req)
-		return
+// hookContext returns a copy of ctx carrying info, and the decision log and the trace of the request r
+func hookContext(ctx context.Context, r *http.Request, info *RequestInfo) context.Context {
+	ctx = trace.ContextWithSpanContext(WithRequestInfo(ctx, info), trace.SpanContextFrom(r.Context()))
+	return withDecisionLog(ctx, decisionLogFrom(r.Context()))
+}
+
+// hookErrorStatusCode returns 403 if the request is denied by a hook, 503 if a hook is overloaded, otherwise 500
+func hookErrorStatusCode(err error) int {
+	var (
+		denied     *DeniedError
+		overloaded *OverloadedError
+	)
+	if errors.As(err, &denied) {
+		return http.StatusForbidden
+	}
+	if errors.As(err, &overloaded) {
+		return http.StatusServiceUnavailable
 	}
-	klog.V(5).Infof("Unhandled request %s %s", req.Method, req.URL.Path)
-	hm.backend.ServeHTTP(w, req)
+	return http.StatusInternalServerError
+}
+
+func (hm *Manager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	hm.handler.ServeHTTP(w, req)
 }
@@ -2,6 +2,7 @@ package hook
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -344,3 +345,134 @@ type testHookManagerUnit struct {
 	expected string
 	patches  []*PatchData
 }
+
+func TestHookManagerSideEffectHook(t *testing.T) {
+	asyncDone := make(chan string, 1)
+	replace := &PatchData{
+		PatchType: string(types.JSONPatchType),
+		PatchData: []byte(`[{"op":"replace","path":"/foo","value":"1"}]`),
+	}
+
+	handlers := []*hookHandle{
+		{
+			name: "mutating",
+			HookHandler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					*patch = *replace
+					return nil
+				},
+			},
+		},
+		{
+			name:           "observer",
+			sideEffectOnly: true,
+			failurePolicy:  componentconfig.PolicyFail,
+			HookHandler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					*patch = *replace
+					return fmt.Errorf("failure of side effect should be ignored")
+				},
+			},
+		},
+		{
+			name:           "async",
+			sideEffectOnly: true,
+			async:          true,
+			HookHandler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					asyncDone <- string(body)
+					return nil
+				},
+			},
+		},
+	}
+
+	hm := NewHookManager()
+	hm.timeout = 10 * time.Second
+	hm.asyncQueue = newAsyncQueue(1, 1)
+	defer hm.asyncQueue.close(time.Second)
+
+	body := []byte(`{"foo":"bar"}`)
+	if err := hm.applyHook(context.Background(), handlers, componentconfig.PreHookType, "", http.MethodPost,
+		"/foo", &body); err != nil {
+		t.Fatalf("can't apply hooks: %v", err)
+	}
+
+	if string(body) != `{"foo":"1"}` {
+		t.Errorf("expect body %s to be %s", string(body), `{"foo":"1"}`)
+	}
+
+	select {
+	case b := <-asyncDone:
+		if b != `{"foo":"1"}` {
+			t.Errorf("expect async hook body %s to be %s", b, `{"foo":"1"}`)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("async hook is not performed")
+	}
+}
+
+func TestHookManagerUnescapeChain(t *testing.T) {
+	var seen string
+	handlers := []*hookHandle{
+		{
+			name: "json",
+			HookHandler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					patch.PatchType = string(types.JSONPatchType)
+					patch.PatchData = []byte(`[{"op":"add","path":"/cmd","value":"a > b"}]`)
+					return nil
+				},
+			},
+		},
+		{
+			name: "merge",
+			HookHandler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					seen = string(body)
+					patch.PatchType = string(types.MergePatchType)
+					patch.PatchData = []byte(`{"env":"<none>"}`)
+					return nil
+				},
+			},
+		},
+	}
+
+	hm := NewHookManager()
+	hm.timeout = 10 * time.Second
+
+	body := []byte(`{"html":"\\u003c"}`)
+	if err := hm.applyHook(context.Background(), handlers, componentconfig.PreHookType, "", http.MethodPost,
+		"/foo", &body); err != nil {
+		t.Fatalf("can't apply hooks: %v", err)
+	}
+
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(seen), &decoded); err != nil || decoded["cmd"] != "a > b" {
+		t.Errorf("expect the body of the next hook %s to be valid", seen)
+	}
+
+	expected := `{"cmd":"a > b","env":"<none>","html":"\\u003c"}`
+	if string(body) != expected {
+		t.Errorf("expect body %s to be %s", string(body), expected)
+	}
+}
+
+type fakeHookHandler struct {
+	preHook  func(patch *PatchData, body []byte) error
+	postHook func(patch *PatchData, body []byte) error
+}
+
+func (f *fakeHookHandler) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	if f.preHook == nil {
+		return nil
+	}
+	return f.preHook(patch, body)
+}
+
+func (f *fakeHookHandler) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	if f.postHook == nil {
+		return nil
+	}
+	return f.postHook(patch, body)
+}
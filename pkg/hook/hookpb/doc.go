@@ -0,0 +1,4 @@
+// Package hookpb is the gRPC protocol between lighthouse and hook servers
+package hookpb
+
+//go:generate protoc --go_out=plugins=grpc:. hook.proto
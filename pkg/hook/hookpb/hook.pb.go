@@ -0,0 +1,561 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: hook.proto
+
+package hookpb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type HookRequest struct {
+	// method is the HTTP method of the Docker request
+	Method string `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	// path is the path of the Docker request
+	Path string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	// body is the raw request body for pre hooks, or the raw response body for post hooks
+	Body []byte `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	// api_version is the Docker API version of the request, it's empty if the path is not versioned
+	ApiVersion string `protobuf:"bytes,4,opt,name=api_version,json=apiVersion,proto3" json:"api_version,omitempty"`
+	// client_api_version is the Docker API version requested by the client
+	ClientApiVersion string `protobuf:"bytes,5,opt,name=client_api_version,json=clientApiVersion,proto3" json:"client_api_version,omitempty"`
+	// status_code is the status code of the backend response, it's only set for post hooks
+	StatusCode int32 `protobuf:"varint,6,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	// container is the container in the path of the request, it's only set if the inventory knows the container
+	Container *Container `protobuf:"bytes,7,opt,name=container,proto3" json:"container,omitempty"`
+	// uid identifies the request, it's shared by the pre and post hooks of the request
+	Uid string `protobuf:"bytes,8,opt,name=uid,proto3" json:"uid,omitempty"`
+	// original_request_body is the request body sent by the client, it's only set for post hooks
+	OriginalRequestBody []byte `protobuf:"bytes,9,opt,name=original_request_body,json=originalRequestBody,proto3" json:"original_request_body,omitempty"`
+	// request_body is the request body patched by the pre hooks, it's only set for post hooks
+	RequestBody []byte `protobuf:"bytes,10,opt,name=request_body,json=requestBody,proto3" json:"request_body,omitempty"`
+	// state is the state attached by the pre hook of the same webhook, it's only set for post hooks
+	State []byte `protobuf:"bytes,11,opt,name=state,proto3" json:"state,omitempty"`
+	// container_type is podsandbox or container for the creates of kubelet, it's empty for other requests
+	ContainerType string `protobuf:"bytes,12,opt,name=container_type,json=containerType,proto3" json:"container_type,omitempty"`
+	// sandbox is the pod sandbox of the app container created by kubelet
+	Sandbox              *Container `protobuf:"bytes,13,opt,name=sandbox,proto3" json:"sandbox,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *HookRequest) Reset()         { *m = HookRequest{} }
+func (m *HookRequest) String() string { return proto.CompactTextString(m) }
+func (*HookRequest) ProtoMessage()    {}
+func (*HookRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3eef30da1c11ee1b, []int{0}
+}
+
+func (m *HookRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HookRequest.Unmarshal(m, b)
+}
+func (m *HookRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HookRequest.Marshal(b, m, deterministic)
+}
+func (m *HookRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HookRequest.Merge(m, src)
+}
+func (m *HookRequest) XXX_Size() int {
+	return xxx_messageInfo_HookRequest.Size(m)
+}
+func (m *HookRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HookRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HookRequest proto.InternalMessageInfo
+
+func (m *HookRequest) GetMethod() string {
+	if m != nil {
+		return m.Method
+	}
+	return ""
+}
+
+func (m *HookRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *HookRequest) GetBody() []byte {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (m *HookRequest) GetApiVersion() string {
+	if m != nil {
+		return m.ApiVersion
+	}
+	return ""
+}
+
+func (m *HookRequest) GetClientApiVersion() string {
+	if m != nil {
+		return m.ClientApiVersion
+	}
+	return ""
+}
+
+func (m *HookRequest) GetStatusCode() int32 {
+	if m != nil {
+		return m.StatusCode
+	}
+	return 0
+}
+
+func (m *HookRequest) GetContainer() *Container {
+	if m != nil {
+		return m.Container
+	}
+	return nil
+}
+
+func (m *HookRequest) GetUid() string {
+	if m != nil {
+		return m.Uid
+	}
+	return ""
+}
+
+func (m *HookRequest) GetOriginalRequestBody() []byte {
+	if m != nil {
+		return m.OriginalRequestBody
+	}
+	return nil
+}
+
+func (m *HookRequest) GetRequestBody() []byte {
+	if m != nil {
+		return m.RequestBody
+	}
+	return nil
+}
+
+func (m *HookRequest) GetState() []byte {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func (m *HookRequest) GetContainerType() string {
+	if m != nil {
+		return m.ContainerType
+	}
+	return ""
+}
+
+func (m *HookRequest) GetSandbox() *Container {
+	if m != nil {
+		return m.Sandbox
+	}
+	return nil
+}
+
+// Container is a container tracked by the inventory of lighthouse
+type Container struct {
+	Id   string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// labels are the labels of the container at creation
+	Labels map[string]string `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// state is created, running or exited
+	State string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	// patches are the patches of the hooks applied to the create request
+	Patches []*AppliedPatch `protobuf:"bytes,5,rep,name=patches,proto3" json:"patches,omitempty"`
+	// type is podsandbox or container if the container is created by kubelet
+	Type string `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	// sandbox_id is the ID of the pod sandbox of an app container
+	SandboxId            string   `protobuf:"bytes,7,opt,name=sandbox_id,json=sandboxId,proto3" json:"sandbox_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Container) Reset()         { *m = Container{} }
+func (m *Container) String() string { return proto.CompactTextString(m) }
+func (*Container) ProtoMessage()    {}
+func (*Container) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3eef30da1c11ee1b, []int{1}
+}
+
+func (m *Container) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Container.Unmarshal(m, b)
+}
+func (m *Container) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Container.Marshal(b, m, deterministic)
+}
+func (m *Container) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Container.Merge(m, src)
+}
+func (m *Container) XXX_Size() int {
+	return xxx_messageInfo_Container.Size(m)
+}
+func (m *Container) XXX_DiscardUnknown() {
+	xxx_messageInfo_Container.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Container proto.InternalMessageInfo
+
+func (m *Container) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Container) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Container) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *Container) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Container) GetPatches() []*AppliedPatch {
+	if m != nil {
+		return m.Patches
+	}
+	return nil
+}
+
+func (m *Container) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Container) GetSandboxId() string {
+	if m != nil {
+		return m.SandboxId
+	}
+	return ""
+}
+
+// AppliedPatch is a patch of a hook applied to a request
+type AppliedPatch struct {
+	Hook string `protobuf:"bytes,1,opt,name=hook,proto3" json:"hook,omitempty"`
+	// changed are the JSON pointers changed by the patch
+	Changed              []string `protobuf:"bytes,2,rep,name=changed,proto3" json:"changed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AppliedPatch) Reset()         { *m = AppliedPatch{} }
+func (m *AppliedPatch) String() string { return proto.CompactTextString(m) }
+func (*AppliedPatch) ProtoMessage()    {}
+func (*AppliedPatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3eef30da1c11ee1b, []int{2}
+}
+
+func (m *AppliedPatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AppliedPatch.Unmarshal(m, b)
+}
+func (m *AppliedPatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AppliedPatch.Marshal(b, m, deterministic)
+}
+func (m *AppliedPatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AppliedPatch.Merge(m, src)
+}
+func (m *AppliedPatch) XXX_Size() int {
+	return xxx_messageInfo_AppliedPatch.Size(m)
+}
+func (m *AppliedPatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_AppliedPatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AppliedPatch proto.InternalMessageInfo
+
+func (m *AppliedPatch) GetHook() string {
+	if m != nil {
+		return m.Hook
+	}
+	return ""
+}
+
+func (m *AppliedPatch) GetChanged() []string {
+	if m != nil {
+		return m.Changed
+	}
+	return nil
+}
+
+type HookResponse struct {
+	// patch_type is the type of the patch, e.g. application/json-patch+json
+	PatchType string `protobuf:"bytes,1,opt,name=patch_type,json=patchType,proto3" json:"patch_type,omitempty"`
+	// patch is the raw JSON patch, the body is not changed if it's empty
+	Patch []byte `protobuf:"bytes,2,opt,name=patch,proto3" json:"patch,omitempty"`
+	// denied rejects the request with message
+	Denied  bool   `protobuf:"varint,3,opt,name=denied,proto3" json:"denied,omitempty"`
+	Message string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	// state is handed back to the post hook of the same webhook, it's only used for pre hooks
+	State                []byte   `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HookResponse) Reset()         { *m = HookResponse{} }
+func (m *HookResponse) String() string { return proto.CompactTextString(m) }
+func (*HookResponse) ProtoMessage()    {}
+func (*HookResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3eef30da1c11ee1b, []int{3}
+}
+
+func (m *HookResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HookResponse.Unmarshal(m, b)
+}
+func (m *HookResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HookResponse.Marshal(b, m, deterministic)
+}
+func (m *HookResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HookResponse.Merge(m, src)
+}
+func (m *HookResponse) XXX_Size() int {
+	return xxx_messageInfo_HookResponse.Size(m)
+}
+func (m *HookResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HookResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HookResponse proto.InternalMessageInfo
+
+func (m *HookResponse) GetPatchType() string {
+	if m != nil {
+		return m.PatchType
+	}
+	return ""
+}
+
+func (m *HookResponse) GetPatch() []byte {
+	if m != nil {
+		return m.Patch
+	}
+	return nil
+}
+
+func (m *HookResponse) GetDenied() bool {
+	if m != nil {
+		return m.Denied
+	}
+	return false
+}
+
+func (m *HookResponse) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *HookResponse) GetState() []byte {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*HookRequest)(nil), "lighthouse.hook.v1.HookRequest")
+	proto.RegisterType((*Container)(nil), "lighthouse.hook.v1.Container")
+	proto.RegisterMapType((map[string]string)(nil), "lighthouse.hook.v1.Container.LabelsEntry")
+	proto.RegisterType((*AppliedPatch)(nil), "lighthouse.hook.v1.AppliedPatch")
+	proto.RegisterType((*HookResponse)(nil), "lighthouse.hook.v1.HookResponse")
+}
+
+func init() { proto.RegisterFile("hook.proto", fileDescriptor_3eef30da1c11ee1b) }
+
+var fileDescriptor_3eef30da1c11ee1b = []byte{
+	// 581 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x54, 0x51, 0x6b, 0xd4, 0x4c,
+	0x14, 0xfd, 0xb2, 0x69, 0xb2, 0x9b, 0x9b, 0xb4, 0x94, 0xf9, 0xaa, 0x0c, 0x85, 0xd2, 0xb8, 0x20,
+	0x44, 0x90, 0x05, 0xd7, 0x07, 0xb5, 0xfa, 0xd2, 0x16, 0x41, 0x41, 0xb4, 0x04, 0xf1, 0xc1, 0x97,
+	0x30, 0xbb, 0x33, 0x6c, 0x86, 0xa6, 0x99, 0x98, 0x99, 0x2d, 0xee, 0x6f, 0xf0, 0x87, 0xf8, 0xee,
+	0xbf, 0xf1, 0xdf, 0xc8, 0xdc, 0x49, 0xba, 0x11, 0xab, 0xf8, 0xe0, 0xdb, 0xbd, 0x67, 0xce, 0xcc,
+	0x9c, 0x73, 0x4f, 0x26, 0x00, 0xa5, 0x52, 0x97, 0xb3, 0xa6, 0x55, 0x46, 0x11, 0x52, 0xc9, 0x55,
+	0x69, 0x4a, 0xb5, 0xd6, 0x62, 0x86, 0xf0, 0xf5, 0xa3, 0xe9, 0x77, 0x1f, 0xe2, 0x57, 0x4a, 0x5d,
+	0xe6, 0xe2, 0xd3, 0x5a, 0x68, 0x43, 0xee, 0x42, 0x78, 0x25, 0x4c, 0xa9, 0x38, 0xf5, 0x52, 0x2f,
+	0x8b, 0xf2, 0xae, 0x23, 0x04, 0x76, 0x1a, 0x66, 0x4a, 0x3a, 0x42, 0x14, 0x6b, 0x8b, 0x2d, 0x14,
+	0xdf, 0x50, 0x3f, 0xf5, 0xb2, 0x24, 0xc7, 0x9a, 0x1c, 0x43, 0xcc, 0x1a, 0x59, 0x5c, 0x8b, 0x56,
+	0x4b, 0x55, 0xd3, 0x1d, 0xa4, 0x03, 0x6b, 0xe4, 0x07, 0x87, 0x90, 0x87, 0x40, 0x96, 0x95, 0x14,
+	0xb5, 0x29, 0x86, 0xbc, 0x00, 0x79, 0xfb, 0x6e, 0xe5, 0x74, 0xcb, 0x3e, 0x86, 0x58, 0x1b, 0x66,
+	0xd6, 0xba, 0x58, 0x2a, 0x2e, 0x68, 0x98, 0x7a, 0x59, 0x90, 0x83, 0x83, 0xce, 0x15, 0x17, 0xe4,
+	0x39, 0x44, 0x4b, 0x55, 0x1b, 0x26, 0x6b, 0xd1, 0xd2, 0x71, 0xea, 0x65, 0xf1, 0xfc, 0x68, 0xf6,
+	0xab, 0xcf, 0xd9, 0x79, 0x4f, 0xca, 0xb7, 0x7c, 0xb2, 0x0f, 0xfe, 0x5a, 0x72, 0x3a, 0xc1, 0xcb,
+	0x6d, 0x49, 0xe6, 0x70, 0x47, 0xb5, 0x72, 0x25, 0x6b, 0x56, 0x15, 0xad, 0x1b, 0x49, 0x81, 0x1e,
+	0x23, 0xf4, 0xf8, 0x7f, 0xbf, 0xd8, 0x8d, 0xeb, 0xcc, 0x5a, 0xbe, 0x07, 0xc9, 0x4f, 0x54, 0x40,
+	0x6a, 0xdc, 0x0e, 0x28, 0x07, 0x10, 0x58, 0xcd, 0x82, 0xc6, 0xb8, 0xe6, 0x1a, 0x72, 0x1f, 0xf6,
+	0x6e, 0xb4, 0x14, 0x66, 0xd3, 0x08, 0x9a, 0xa0, 0x92, 0xdd, 0x1b, 0xf4, 0xfd, 0xa6, 0x11, 0xe4,
+	0x09, 0x8c, 0x35, 0xab, 0xf9, 0x42, 0x7d, 0xa6, 0xbb, 0x7f, 0x63, 0xb0, 0x67, 0x4f, 0xbf, 0x8d,
+	0x20, 0xba, 0x81, 0xc9, 0x1e, 0x8c, 0x64, 0x9f, 0xea, 0x48, 0x62, 0xa2, 0x35, 0xbb, 0x12, 0x7d,
+	0xa2, 0xb6, 0x26, 0xa7, 0x10, 0x56, 0x6c, 0x21, 0x2a, 0x4d, 0xfd, 0xd4, 0xcf, 0xe2, 0xf9, 0x83,
+	0x3f, 0xde, 0x34, 0x7b, 0x83, 0xdc, 0x97, 0xb5, 0x69, 0x37, 0x79, 0xb7, 0x71, 0x6b, 0xd5, 0x45,
+	0xdf, 0x59, 0x3d, 0x81, 0x71, 0xc3, 0xcc, 0xb2, 0x14, 0x9a, 0x06, 0x78, 0x72, 0x7a, 0xdb, 0xc9,
+	0xa7, 0x4d, 0x53, 0x49, 0xc1, 0x2f, 0x2c, 0x33, 0xef, 0x37, 0x58, 0xa1, 0x38, 0x9c, 0xd0, 0x09,
+	0xb5, 0x35, 0x39, 0x02, 0xe8, 0x5c, 0x16, 0x92, 0x63, 0xee, 0x51, 0x1e, 0x75, 0xc8, 0x6b, 0x7e,
+	0xf8, 0x0c, 0xe2, 0x81, 0x36, 0x9b, 0xf3, 0xa5, 0xd8, 0x74, 0xde, 0x6d, 0x69, 0x55, 0x5e, 0xb3,
+	0x6a, 0xdd, 0xbb, 0x77, 0xcd, 0xc9, 0xe8, 0xa9, 0x37, 0x7d, 0x01, 0xc9, 0x50, 0x86, 0xbd, 0xdd,
+	0xca, 0xeb, 0x36, 0x63, 0x4d, 0x28, 0x8c, 0x97, 0x25, 0xab, 0x57, 0x82, 0xd3, 0x51, 0xea, 0x67,
+	0x51, 0xde, 0xb7, 0xd3, 0x2f, 0x1e, 0x24, 0xee, 0x39, 0xe9, 0x46, 0xd5, 0x1a, 0x85, 0xa2, 0x0f,
+	0x97, 0xaf, 0x3b, 0x24, 0x42, 0x04, 0xb3, 0x3d, 0x80, 0x00, 0x1b, 0xd4, 0x91, 0xe4, 0xae, 0xb1,
+	0x8f, 0x90, 0x8b, 0x5a, 0x0a, 0x8e, 0x4f, 0x6b, 0x92, 0x77, 0x9d, 0xbd, 0xf7, 0x4a, 0x68, 0xcd,
+	0x56, 0xfd, 0x74, 0xfb, 0x76, 0x3b, 0xf5, 0x60, 0xf0, 0x81, 0xcd, 0xbf, 0x7a, 0xb0, 0x63, 0xd5,
+	0x90, 0xb7, 0x30, 0xbe, 0x68, 0x05, 0x96, 0xc7, 0xb7, 0x0d, 0x7e, 0xf0, 0x07, 0x38, 0x4c, 0x7f,
+	0x4f, 0x70, 0x9e, 0xa6, 0xff, 0x91, 0x77, 0x30, 0xb9, 0x50, 0xda, 0xfc, 0xb3, 0x03, 0xcf, 0x26,
+	0x1f, 0x43, 0xbb, 0xd2, 0x2c, 0x16, 0x21, 0xfe, 0xab, 0x1e, 0xff, 0x18, 0x00, 0x1a, 0x62, 0xf9,
+	0x1a, 0xb9, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// HookClient is the client API for Hook service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type HookClient interface {
+	// PreHook is called before the request is sent to the backend
+	PreHook(ctx context.Context, in *HookRequest, opts ...grpc.CallOption) (*HookResponse, error)
+	// PostHook is called before the response is sent to the client
+	PostHook(ctx context.Context, in *HookRequest, opts ...grpc.CallOption) (*HookResponse, error)
+}
+
+type hookClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewHookClient(cc *grpc.ClientConn) HookClient {
+	return &hookClient{cc}
+}
+
+func (c *hookClient) PreHook(ctx context.Context, in *HookRequest, opts ...grpc.CallOption) (*HookResponse, error) {
+	out := new(HookResponse)
+	err := c.cc.Invoke(ctx, "/lighthouse.hook.v1.Hook/PreHook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hookClient) PostHook(ctx context.Context, in *HookRequest, opts ...grpc.CallOption) (*HookResponse, error) {
+	out := new(HookResponse)
+	err := c.cc.Invoke(ctx, "/lighthouse.hook.v1.Hook/PostHook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HookServer is the server API for Hook service.
+type HookServer interface {
+	// PreHook is called before the request is sent to the backend
+	PreHook(context.Context, *HookRequest) (*HookResponse, error)
+	// PostHook is called before the response is sent to the client
+	PostHook(context.Context, *HookRequest) (*HookResponse, error)
+}
+
+// UnimplementedHookServer can be embedded to have forward compatible implementations.
+type UnimplementedHookServer struct {
+}
+
+func (*UnimplementedHookServer) PreHook(ctx context.Context, req *HookRequest) (*HookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PreHook not implemented")
+}
+func (*UnimplementedHookServer) PostHook(ctx context.Context, req *HookRequest) (*HookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PostHook not implemented")
+}
+
+func RegisterHookServer(s *grpc.Server, srv HookServer) {
+	s.RegisterService(&_Hook_serviceDesc, srv)
+}
+
+func _Hook_PreHook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HookServer).PreHook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lighthouse.hook.v1.Hook/PreHook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HookServer).PreHook(ctx, req.(*HookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Hook_PostHook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HookServer).PostHook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lighthouse.hook.v1.Hook/PostHook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HookServer).PostHook(ctx, req.(*HookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Hook_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "lighthouse.hook.v1.Hook",
+	HandlerType: (*HookServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PreHook",
+			Handler:    _Hook_PreHook_Handler,
+		},
+		{
+			MethodName: "PostHook",
+			Handler:    _Hook_PostHook_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "hook.proto",
+}
@@ -0,0 +1,454 @@
+package hook
+
+import (
+	"bufio"
+	"bytes"
+	gjson "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+// States of a container in the inventory
+const (
+	ContainerCreated = "created"
+	ContainerRunning = "running"
+	ContainerExited  = "exited"
+)
+
+var (
+	containerPathRegexp   = regexp.MustCompile(`^/containers/([^/]+)(/.*)?$`)
+	containerActionRegexp = regexp.MustCompile(`^/containers/([^/]+)/(start|restart|stop|kill)$`)
+	// containerCollectionPaths are the paths under /containers which don't refer to a container
+	containerCollectionPaths = map[string]bool{"create": true, "json": true, "prune": true}
+)
+
+// inventorySaveDelay is the delay of writing the state file after a change, the changes in the delay are written at
+// once
+const inventorySaveDelay = time.Second
+
+// ContainerInfo is a container tracked by the inventory
+type ContainerInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Labels are the labels of the container at creation, after the pre hooks
+	Labels map[string]string `json:"labels,omitempty"`
+	State  string            `json:"state"`
+	// Patches are the patches of the pre hooks applied to the create request
+	Patches []AppliedPatch `json:"patches,omitempty"`
+	// Type is podsandbox or container if the container is created by kubelet
+	Type string `json:"type,omitempty"`
+	// SandboxID is the ID of the pod sandbox of an app container
+	SandboxID string `json:"sandboxID,omitempty"`
+}
+
+// AppliedPatch is a patch of a hook applied to a request
+type AppliedPatch struct {
+	Hook string `json:"hook"`
+	// Changed are the JSON pointers changed by the patch
+	Changed []string `json:"changed,omitempty"`
+}
+
+func (c *ContainerInfo) deepCopy() *ContainerInfo {
+	out := *c
+	if c.Labels != nil {
+		out.Labels = make(map[string]string, len(c.Labels))
+		for k, v := range c.Labels {
+			out.Labels[k] = v
+		}
+	}
+	out.Patches = append([]AppliedPatch(nil), c.Patches...)
+	return &out
+}
+
+// inventory maps the containers created through lighthouse to their labels and patches. It's updated by the
+// responses of the backend, and reconciled with the containers of the backend at startup
+type inventory struct {
+	lock       sync.RWMutex
+	containers map[string]*ContainerInfo
+	// stateFile persists the containers, they are only kept in memory if it's empty
+	stateFile string
+	// saveTimer is the pending write of the state file, it's guarded by lock
+	saveTimer *time.Timer
+	// saveLock keeps the state file written in the order of the snapshots
+	saveLock sync.Mutex
+}
+
+func newInventory(config *componentconfig.InventoryConfiguration) (*inventory, error) {
+	inv := &inventory{
+		containers: make(map[string]*ContainerInfo),
+		stateFile:  config.StateFile,
+	}
+
+	if len(inv.stateFile) == 0 {
+		return inv, nil
+	}
+
+	data, err := ioutil.ReadFile(inv.stateFile)
+	if os.IsNotExist(err) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read inventory state %s, %v", inv.stateFile, err)
+	}
+
+	var containers []*ContainerInfo
+	if err := gjson.Unmarshal(data, &containers); err != nil {
+		return nil, fmt.Errorf("can't decode inventory state %s, %v", inv.stateFile, err)
+	}
+
+	for _, c := range containers {
+		inv.containers[c.ID] = c
+	}
+	klog.Infof("Load %d containers of inventory from %s", len(containers), inv.stateFile)
+
+	return inv, nil
+}
+
+// lookup returns a copy of the container whose ID, name or ID prefix is idOrName, nil is returned if it's not found
+// or the prefix is ambiguous
+func (inv *inventory) lookup(idOrName string) *ContainerInfo {
+	if inv == nil {
+		return nil
+	}
+
+	inv.lock.RLock()
+	defer inv.lock.RUnlock()
+
+	if c := inv.find(idOrName); c != nil {
+		return c.deepCopy()
+	}
+	return nil
+}
+
+// find resolves idOrName like the backend, the full ID is matched first, then the name, then a unique ID prefix
+func (inv *inventory) find(idOrName string) *ContainerInfo {
+	// an empty key is a prefix of all the IDs
+	if len(idOrName) == 0 {
+		return nil
+	}
+
+	if c, found := inv.containers[idOrName]; found {
+		return c
+	}
+
+	name := strings.TrimPrefix(idOrName, "/")
+	for _, c := range inv.containers {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	var matched *ContainerInfo
+	for id, c := range inv.containers {
+		if strings.HasPrefix(id, idOrName) {
+			if matched != nil {
+				return nil
+			}
+			matched = c
+		}
+	}
+
+	return matched
+}
+
+// lookupPath returns the container in the unversioned path of a request
+func (inv *inventory) lookupPath(path string) *ContainerInfo {
+	if inv == nil {
+		return nil
+	}
+
+	m := containerPathRegexp.FindStringSubmatch(path)
+	if m == nil || containerCollectionPaths[m[1]] {
+		return nil
+	}
+
+	return inv.lookup(m[1])
+}
+
+// track returns a handler which updates the inventory by the requests sent to the backend and its responses
+func (inv *inventory) track(backend http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, path := splitVersionedPath(r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodPost && path == "/containers/create":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				klog.Errorf("can't read create body, %v", err)
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			cw := &capturingWriter{ResponseWriter: w, statusCode: http.StatusOK, capture: true}
+			backend.ServeHTTP(cw, r)
+			if cw.statusCode == http.StatusCreated {
+				inv.created(r, body, cw.body.Bytes())
+			}
+		case r.Method == http.MethodPost && containerActionRegexp.MatchString(path):
+			m := containerActionRegexp.FindStringSubmatch(path)
+			cw := &capturingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			backend.ServeHTTP(cw, r)
+			if cw.statusCode == http.StatusNoContent || cw.statusCode == http.StatusNotModified {
+				state := ContainerRunning
+				if m[2] == "stop" || m[2] == "kill" {
+					state = ContainerExited
+				}
+				inv.update(m[1], state)
+			}
+		case r.Method == http.MethodDelete && containerPathRegexp.MatchString(path):
+			m := containerPathRegexp.FindStringSubmatch(path)
+			cw := &capturingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			backend.ServeHTTP(cw, r)
+			if len(m[2]) == 0 && (cw.statusCode == http.StatusNoContent || cw.statusCode == http.StatusNotFound) {
+				inv.remove(m[1])
+			}
+		default:
+			backend.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (inv *inventory) created(r *http.Request, body, resp []byte) {
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	if err := gjson.Unmarshal(resp, &created); err != nil || len(created.ID) == 0 {
+		klog.Warningf("can't get the container ID of create response, %v", err)
+		return
+	}
+
+	config := createConfig{}
+	if err := gjson.Unmarshal(body, &config); err != nil {
+		klog.Warningf("can't get the labels of container %s, %v", created.ID, err)
+	}
+
+	c := &ContainerInfo{
+		ID:     created.ID,
+		Name:   strings.TrimPrefix(r.URL.Query().Get("name"), "/"),
+		Labels: config.Labels,
+		State:  ContainerCreated,
+	}
+	c.Type, c.SandboxID = classifyContainer(config.Labels, config.HostConfig.NetworkMode)
+
+	if log := decisionLogFrom(r.Context()); log != nil {
+		log.lock.Lock()
+		for _, d := range log.decisions {
+			if d.HookType == componentconfig.PreHookType && d.Decision == DecisionPatched {
+				c.Patches = append(c.Patches, AppliedPatch{Hook: d.Hook, Changed: d.Changed})
+			}
+		}
+		log.lock.Unlock()
+	}
+
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	// the sandbox may be referred by its name or ID prefix in the network mode
+	if len(c.SandboxID) > 0 {
+		if sandbox := inv.find(c.SandboxID); sandbox != nil {
+			c.SandboxID = sandbox.ID
+		}
+	}
+	klog.V(4).Infof("Add container %s(%s) to inventory", c.ID, c.Name)
+	inv.containers[c.ID] = c
+	inv.scheduleSave()
+}
+
+func (inv *inventory) update(idOrName, state string) {
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	c := inv.find(idOrName)
+	if c == nil || c.State == state {
+		return
+	}
+
+	klog.V(4).Infof("Container %s of inventory is %s", c.ID, state)
+	c.State = state
+	inv.scheduleSave()
+}
+
+func (inv *inventory) remove(idOrName string) {
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	c := inv.find(idOrName)
+	if c == nil {
+		return
+	}
+
+	klog.V(4).Infof("Remove container %s from inventory", c.ID)
+	delete(inv.containers, c.ID)
+	inv.scheduleSave()
+}
+
+// reconcile removes the containers which don't exist in the backend, adds the ones unknown to the inventory without
+// patches, and updates their states
+func (inv *inventory) reconcile(backend http.Handler) error {
+	recorder := httptest.NewRecorder()
+	backend.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/containers/json?all=1", nil))
+	if recorder.Code != http.StatusOK {
+		return fmt.Errorf("list status code is %d", recorder.Code)
+	}
+
+	var listed []struct {
+		ID         string            `json:"Id"`
+		Names      []string          `json:"Names"`
+		Labels     map[string]string `json:"Labels"`
+		State      string            `json:"State"`
+		HostConfig struct {
+			NetworkMode string `json:"NetworkMode"`
+		} `json:"HostConfig"`
+	}
+	if err := gjson.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		return err
+	}
+
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	containers := make(map[string]*ContainerInfo, len(listed))
+	for _, l := range listed {
+		c, found := inv.containers[l.ID]
+		if !found {
+			c = &ContainerInfo{ID: l.ID, Labels: l.Labels}
+			if len(l.Names) > 0 {
+				c.Name = strings.TrimPrefix(l.Names[0], "/")
+			}
+			c.Type, c.SandboxID = classifyContainer(l.Labels, l.HostConfig.NetworkMode)
+		}
+
+		switch l.State {
+		case ContainerCreated, ContainerRunning:
+			c.State = l.State
+		default:
+			c.State = ContainerExited
+		}
+		containers[l.ID] = c
+	}
+
+	klog.Infof("Reconcile inventory, %d containers before, %d containers after", len(inv.containers), len(containers))
+	inv.containers = containers
+	inv.scheduleSave()
+
+	return nil
+}
+
+// scheduleSave writes the state file after inventorySaveDelay if it's not scheduled, it's called with the lock held
+func (inv *inventory) scheduleSave() {
+	if len(inv.stateFile) == 0 || inv.saveTimer != nil {
+		return
+	}
+
+	inv.saveTimer = time.AfterFunc(inventorySaveDelay, inv.save)
+}
+
+// flush writes the state file at once, the pending write is canceled
+func (inv *inventory) flush() {
+	if inv == nil || len(inv.stateFile) == 0 {
+		return
+	}
+
+	inv.lock.Lock()
+	if inv.saveTimer != nil {
+		inv.saveTimer.Stop()
+	}
+	inv.lock.Unlock()
+
+	// a write which has started is ordered by saveLock, the state file ends up with the latest snapshot
+	inv.save()
+}
+
+// save writes a snapshot of the containers to the state file, the file is written without the lock held
+func (inv *inventory) save() {
+	inv.saveLock.Lock()
+	defer inv.saveLock.Unlock()
+
+	// the state of a container is changed in place, so the containers are copied
+	inv.lock.Lock()
+	inv.saveTimer = nil
+	containers := make([]ContainerInfo, 0, len(inv.containers))
+	for _, c := range inv.containers {
+		containers = append(containers, *c)
+	}
+	inv.lock.Unlock()
+
+	data, err := encodeJSON(containers)
+	if err != nil {
+		klog.Errorf("can't encode inventory, %v", err)
+		return
+	}
+
+	// the state is replaced by renaming, so it's never partially written
+	tmp, err := ioutil.TempFile(filepath.Dir(inv.stateFile), filepath.Base(inv.stateFile)+".tmp")
+	if err != nil {
+		klog.Errorf("can't save inventory, %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		klog.Errorf("can't save inventory, %v", err)
+		return
+	}
+
+	if err := tmp.Close(); err != nil {
+		klog.Errorf("can't save inventory, %v", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), inv.stateFile); err != nil {
+		klog.Errorf("can't save inventory, %v", err)
+	}
+}
+
+// capturingWriter records the status code of a response, and its body if capture is set
+type capturingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	capture     bool
+	body        bytes.Buffer
+}
+
+func (cw *capturingWriter) WriteHeader(statusCode int) {
+	if !cw.wroteHeader {
+		cw.statusCode, cw.wroteHeader = statusCode, true
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *capturingWriter) Write(data []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.capture {
+		cw.body.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+func (cw *capturingWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *capturingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer can't be hijacked")
+	}
+	return h.Hijack()
+}
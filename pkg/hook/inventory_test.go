@@ -0,0 +1,192 @@
+package hook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+type containerHook struct {
+	containers chan *ContainerInfo
+}
+
+func (h *containerHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	h.containers <- RequestInfoFrom(ctx).Container
+	return nil
+}
+
+func (h *containerHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return nil
+}
+
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "inventory.json")
+
+	fakeDocker := test.NewFakeDocker()
+	newManager := func() *Manager {
+		hm := NewManager(WithBackend(fakeDocker), WithSystemd(false))
+		if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+			Timeout:   1,
+			Inventory: componentconfig.InventoryConfiguration{Enabled: true, StateFile: stateFile},
+		}); err != nil {
+			t.Fatalf("can't init hook manager: %v", err)
+		}
+		return hm
+	}
+
+	send := func(h http.Handler, method, path, body string, code int) {
+		ans := httptest.NewRecorder()
+		h.ServeHTTP(ans, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if ans.Code != code {
+			t.Fatalf("expect status code %d of %s %s to be %d, body %s", ans.Code, method, path, code, ans.Body)
+		}
+	}
+
+	hm := newManager()
+	hook := &containerHook{containers: make(chan *ContainerInfo, 1)}
+	if err := hm.RegisterHook(HookRegistration{
+		Name: "label",
+		Handler: &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.StrategicMergePatchType)
+				patch.PatchData = []byte(`{"Labels":{"lighthouse":"true"}}`)
+				return nil
+			},
+		},
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+	if err := hm.RegisterHook(HookRegistration{
+		Name:    "container",
+		Handler: hook,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/{id}/start", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	send(hm, http.MethodPost, "/v1.40/containers/create?name=foo", `{"Image":"busybox","Labels":{"app":"foo"}}`,
+		http.StatusCreated)
+	send(hm, http.MethodPost, "/v1.40/containers/foo/start", "", http.StatusNoContent)
+
+	c := <-hook.containers
+	if c == nil {
+		t.Fatalf("expect container of start request")
+	}
+	if c.Name != "foo" || c.State != ContainerCreated || c.Labels["app"] != "foo" || c.Labels["lighthouse"] != "true" {
+		t.Errorf("unexpected container %+v", c)
+	}
+	if len(c.Patches) != 1 || c.Patches[0].Hook != "label" || len(c.Patches[0].Changed) == 0 {
+		t.Errorf("unexpected patches %+v", c.Patches)
+	}
+	if c := hm.inventory.lookup(c.ID[:12]); c == nil || c.State != ContainerRunning {
+		t.Errorf("expect container to be running, %+v", c)
+	}
+
+	// a container created without lighthouse is added by reconciliation, and the persisted one keeps its patches
+	send(fakeDocker, http.MethodPost, "/containers/create?name=bar", `{"Image":"busybox"}`, http.StatusCreated)
+	hm.inventory.flush()
+	restarted := newManager()
+	if err := restarted.inventory.reconcile(fakeDocker); err != nil {
+		t.Fatalf("can't reconcile: %v", err)
+	}
+	if c := restarted.inventory.lookup("foo"); c == nil || c.State != ContainerRunning || len(c.Patches) != 1 {
+		t.Errorf("unexpected reconciled container %+v", c)
+	}
+	if c := restarted.inventory.lookup("bar"); c == nil || c.State != ContainerCreated || len(c.Patches) != 0 {
+		t.Errorf("unexpected reconciled container %+v", c)
+	}
+
+	send(restarted, http.MethodPost, "/v1.40/containers/foo/stop", "", http.StatusNoContent)
+	if c := restarted.inventory.lookup("foo"); c == nil || c.State != ContainerExited {
+		t.Errorf("expect container to be exited, %+v", c)
+	}
+	send(restarted, http.MethodDelete, "/v1.40/containers/foo", "", http.StatusNoContent)
+	if c := restarted.inventory.lookup("foo"); c != nil {
+		t.Errorf("expect container to be removed, %+v", c)
+	}
+}
+
+func TestInventoryFind(t *testing.T) {
+	inv := &inventory{containers: map[string]*ContainerInfo{
+		"abc123": {ID: "abc123", Name: "foo"},
+		"abd456": {ID: "abd456", Name: "abc"},
+		"def789": {ID: "def789", Name: "abd456"},
+		"fed012": {ID: "fed012", Name: "ab"},
+	}}
+
+	for key, expected := range map[string]string{
+		// the full ID takes precedence over the name
+		"abd456": "abd456",
+		// the name takes precedence over the ID prefix
+		"abc":  "abd456",
+		"/abc": "abd456",
+		"ab":   "fed012",
+		"foo":  "abc123",
+		"abc1": "abc123",
+		"de":   "def789",
+		// ambiguous prefix
+		"a": "",
+		"":  "",
+	} {
+		c, id := inv.find(key), ""
+		if c != nil {
+			id = c.ID
+		}
+		if id != expected {
+			t.Errorf("expect %q to be resolved to %q, got %q", key, expected, id)
+		}
+	}
+}
+
+func TestInventorySave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "inventory.json")
+
+	inv, err := newInventory(&componentconfig.InventoryConfiguration{Enabled: true, StateFile: stateFile})
+	if err != nil {
+		t.Fatalf("can't create inventory: %v", err)
+	}
+	inv.lock.Lock()
+	inv.containers["abc"] = &ContainerInfo{ID: "abc", State: ContainerCreated}
+	inv.scheduleSave()
+	inv.lock.Unlock()
+	inv.update("abc", ContainerRunning)
+
+	// the changes are written later at once
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expect the state file not to be written at once, %v", err)
+	}
+
+	inv.flush()
+	loaded, err := newInventory(&componentconfig.InventoryConfiguration{Enabled: true, StateFile: stateFile})
+	if err != nil {
+		t.Fatalf("can't load inventory: %v", err)
+	}
+	if c := loaded.lookup("abc"); c == nil || c.State != ContainerRunning {
+		t.Errorf("expect the flushed container to be running, %+v", c)
+	}
+}
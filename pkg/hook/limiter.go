@@ -0,0 +1,111 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reasons of the calls rejected by a limiter
+const (
+	rejectQueueFull    = "queue_full"
+	rejectQueueTimeout = "queue_timeout"
+)
+
+// OverloadedError is returned if a call of a hook is shed by its concurrency limit, the request fails with 503 if the
+// failure policy of the hook is Fail
+type OverloadedError struct {
+	Hook   string
+	Reason string
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("hook %s is overloaded, %s", e.Hook, e.Reason)
+}
+
+// concurrencyLimiter limits the concurrent calls of a hook, the calls exceeding maxInFlight wait in a bounded queue
+type concurrencyLimiter struct {
+	name         string
+	slots        chan struct{}
+	maxQueue     int
+	queueTimeout time.Duration
+	metrics      *hookMetrics
+
+	lock   sync.Mutex
+	queued int
+}
+
+// newConcurrencyLimiter returns nil if maxInFlight is 0, so the calls are not limited
+func newConcurrencyLimiter(name string, maxInFlight, maxQueue int, queueTimeout time.Duration,
+	metrics *hookMetrics) (*concurrencyLimiter, error) {
+	if maxInFlight < 0 || maxQueue < 0 || queueTimeout < 0 {
+		return nil, fmt.Errorf("negative concurrency limit")
+	}
+
+	if maxInFlight == 0 {
+		return nil, nil
+	}
+
+	return &concurrencyLimiter{
+		name:         name,
+		slots:        make(chan struct{}, maxInFlight),
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		metrics:      metrics,
+	}, nil
+}
+
+// acquire waits for a slot until the queue timeout or ctx is done, the returned function releases the slot
+func (l *concurrencyLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	l.lock.Lock()
+	if l.queued >= l.maxQueue {
+		l.lock.Unlock()
+		return nil, l.reject(rejectQueueFull)
+	}
+	l.queued++
+	l.metrics.hookQueueLength.WithLabelValues(l.name).Inc()
+	l.lock.Unlock()
+
+	defer func() {
+		l.lock.Lock()
+		l.queued--
+		l.metrics.hookQueueLength.WithLabelValues(l.name).Dec()
+		l.lock.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-timeout:
+		return nil, l.reject(rejectQueueTimeout)
+	case <-ctx.Done():
+		return nil, l.reject(rejectQueueTimeout)
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	<-l.slots
+}
+
+func (l *concurrencyLimiter) reject(reason string) error {
+	l.metrics.hookRejections.WithLabelValues(l.name, reason).Inc()
+	return &OverloadedError{Hook: l.name, Reason: reason}
+}
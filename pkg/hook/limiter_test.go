@@ -0,0 +1,87 @@
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	for _, policy := range []componentconfig.FailurePolicyType{componentconfig.PolicyFail,
+		componentconfig.PolicyIgnore} {
+		started, unblock := make(chan struct{}, 3), make(chan struct{})
+		hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{}`))
+		})), WithSystemd(false))
+
+		if err := hm.RegisterHook(HookRegistration{
+			Name: "slow",
+			Handler: &fakeHookHandler{
+				preHook: func(patch *PatchData, body []byte) error {
+					started <- struct{}{}
+					<-unblock
+					return nil
+				},
+			},
+			FailurePolicy:  policy,
+			MaxInFlight:    1,
+			MaxQueueLength: 1,
+			QueueTimeout:   100 * time.Millisecond,
+			Stages: componentconfig.HookStageList{
+				{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+			},
+		}); err != nil {
+			t.Fatalf("can't register hook: %v", err)
+		}
+		limiter := hm.hooks[0].limiter
+
+		codes := make(chan int, 3)
+		send := func() {
+			ans := httptest.NewRecorder()
+			hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(`{}`)))
+			codes <- ans.Code
+		}
+
+		go send()
+		<-started
+		go send()
+		for queued := 0; queued == 0; {
+			time.Sleep(time.Millisecond)
+			limiter.lock.Lock()
+			queued = limiter.queued
+			limiter.lock.Unlock()
+		}
+
+		// the queue is full, and the queued call times out
+		expected := http.StatusServiceUnavailable
+		if policy == componentconfig.PolicyIgnore {
+			expected = http.StatusOK
+		}
+		send()
+		for i := 0; i < 2; i++ {
+			if code := <-codes; code != expected {
+				t.Errorf("%s: expect status code %d to be %d", policy, code, expected)
+			}
+		}
+
+		close(unblock)
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("%s: expect status code %d of in-flight call to be 200", policy, code)
+		}
+
+		for _, reason := range []string{rejectQueueFull, rejectQueueTimeout} {
+			if n := testutil.ToFloat64(hm.metrics.hookRejections.WithLabelValues("slow", reason)); n != 1 {
+				t.Errorf("%s: expect %v rejections of %s to be 1", policy, n, reason)
+			}
+		}
+		if n := testutil.ToFloat64(hm.metrics.hookQueueLength.WithLabelValues("slow")); n != 0 {
+			t.Errorf("%s: expect queue length %v to be 0", policy, n)
+		}
+	}
+}
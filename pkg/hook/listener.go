@@ -0,0 +1,266 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/util"
+)
+
+const defaultListenerName = "default"
+
+type hookListener struct {
+	name    string
+	address string
+	mode    os.FileMode
+	uid     int
+	gid     int
+	handler http.Handler
+	server  *http.Server
+	// serving is set to 1 while the server is accepting connections
+	serving int32
+	// router serves the hooks of the listener, it's nil for the admin listener
+	router   *routeHolder
+	readOnly bool
+	// webhooks are the names of the webhooks served by the listener, all the webhooks are served if it's empty
+	webhooks map[string]bool
+}
+
+// newRouterListener returns a listener serving the hooks with a router which can be rebuilt while serving
+func newRouterListener(config *componentconfig.ListenerConfiguration) (*hookListener, error) {
+	holder := &routeHolder{}
+	hl, err := newHookListener(config, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	hl.router = holder
+	hl.readOnly = config.ReadOnly
+	if len(config.WebHooks) > 0 {
+		hl.webhooks = make(map[string]bool, len(config.WebHooks))
+		for _, name := range config.WebHooks {
+			hl.webhooks[name] = true
+		}
+	}
+
+	return hl, nil
+}
+
+// serves returns whether the webhook is served by the listener
+func (hl *hookListener) serves(webhook string) bool {
+	return len(hl.webhooks) == 0 || hl.webhooks[webhook]
+}
+
+func newHookListener(config *componentconfig.ListenerConfiguration, handler http.Handler) (*hookListener, error) {
+	hl := &hookListener{
+		name:    config.Name,
+		address: config.Address,
+		uid:     -1,
+		gid:     -1,
+		handler: handler,
+		server:  &http.Server{Handler: handler},
+	}
+
+	if len(config.SocketMode) > 0 {
+		mode, err := strconv.ParseUint(config.SocketMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket mode %q of listener %s, %v", config.SocketMode, config.Name, err)
+		}
+		hl.mode = os.FileMode(mode)
+	}
+
+	if len(config.SocketOwner) > 0 {
+		uid, gid, err := lookupOwner(config.SocketOwner)
+		if err != nil {
+			return nil, fmt.Errorf("invalid socket owner %q of listener %s, %v", config.SocketOwner, config.Name, err)
+		}
+		hl.uid, hl.gid = uid, gid
+	}
+
+	return hl, nil
+}
+
+// listen returns the listener passed by systemd socket activation if there is a matched one, otherwise a new
+// listener is created
+func (hl *hookListener) listen(activated map[string][]net.Listener) (net.Listener, error) {
+	// a listener without address only serves the listener given by its name
+	if len(hl.address) == 0 {
+		if ls := activated[hl.name]; len(ls) > 0 {
+			activated[hl.name] = ls[1:]
+			return ls[0], nil
+		}
+		return nil, fmt.Errorf("listener %s has no address", hl.name)
+	}
+
+	proto, addr, err := util.GetProtoAndAddress(hl.address)
+	if err != nil {
+		return nil, err
+	}
+
+	if l := takeActivatedListener(activated, hl.name, proto, addr); l != nil {
+		klog.Infof("Listener %s uses socket %s passed by systemd", hl.name, l.Addr().String())
+		return l, nil
+	}
+
+	/** Abstract unix socket is not supported */
+	if proto == util.UnixProto {
+		if strings.HasPrefix(addr, "@") {
+			return nil, fmt.Errorf("can't use abstract unix socket %s", addr)
+		}
+		return hl.listenUnix(addr)
+	}
+
+	return net.Listen(proto, addr)
+}
+
+// listenUnix creates the socket in a private directory next to path, and renames it to path after its owner and mode
+// are set, so the socket is never reachable with the permission given by the umask
+func (hl *hookListener) listenUnix(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".lighthouse")
+	if err != nil {
+		return nil, fmt.Errorf("can't create directory for socket %s, %v", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.ListenUnix(util.UnixProto, &net.UnixAddr{Name: tmp, Net: util.UnixProto})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is unlinked by its final path
+	l.SetUnlinkOnClose(false)
+
+	if err := hl.setSocketPermission(tmp); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	// a stale socket is replaced atomically
+	if err := os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("can't move socket to %s, %v", path, err)
+	}
+
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// unixListener is a unix socket listener which is renamed to path after it's created
+type unixListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: util.UnixProto}
+}
+
+// Close closes the listener and removes its socket
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() {
+		os.Remove(l.path)
+	})
+	return err
+}
+
+func (hl *hookListener) setSocketPermission(path string) error {
+	if hl.uid >= 0 || hl.gid >= 0 {
+		if err := os.Chown(path, hl.uid, hl.gid); err != nil {
+			return fmt.Errorf("can't change owner of %s, %v", path, err)
+		}
+	}
+
+	if hl.mode != 0 {
+		if err := os.Chmod(path, hl.mode); err != nil {
+			return fmt.Errorf("can't change mode of %s, %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (hl *hookListener) serve(l net.Listener) error {
+	klog.Infof("Listener %s is serving on %s", hl.name, l.Addr().String())
+	atomic.StoreInt32(&hl.serving, 1)
+	err := hl.server.Serve(l)
+	atomic.StoreInt32(&hl.serving, 0)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+func (hl *hookListener) close() error {
+	return hl.server.Close()
+}
+
+// shutdown stops accepting connections and waits for the active requests until ctx is done
+func (hl *hookListener) shutdown(ctx context.Context) error {
+	return hl.server.Shutdown(ctx)
+}
+
+// takeActivatedListener removes and returns the listener whose name or address is matched
+func takeActivatedListener(activated map[string][]net.Listener, name, proto, addr string) net.Listener {
+	if ls := activated[name]; len(ls) > 0 {
+		activated[name] = ls[1:]
+		return ls[0]
+	}
+
+	for n, ls := range activated {
+		for i, l := range ls {
+			if l.Addr().Network() == proto && l.Addr().String() == addr {
+				activated[n] = append(ls[:i], ls[i+1:]...)
+				return l
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupOwner resolves "user[:group]" to uid and gid, -1 is returned for the omitted part
+func lookupOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	seps := strings.SplitN(owner, ":", 2)
+
+	if len(seps[0]) > 0 {
+		id, err := strconv.Atoi(seps[0])
+		if err != nil {
+			u, err := user.Lookup(seps[0])
+			if err != nil {
+				return -1, -1, err
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+
+	if len(seps) == 2 && len(seps[1]) > 0 {
+		id, err := strconv.Atoi(seps[1])
+		if err != nil {
+			g, err := user.LookupGroup(seps[1])
+			if err != nil {
+				return -1, -1, err
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
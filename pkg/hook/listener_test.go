@@ -0,0 +1,191 @@
+package hook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+func TestHookListenerSocketPermission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lighthouse")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "lighthouse.sock")
+	// a stale socket is replaced
+	if err := ioutil.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatalf("can't create stale socket: %v", err)
+	}
+	hl, err := newHookListener(&componentconfig.ListenerConfiguration{
+		Name:        "test",
+		Address:     fmt.Sprintf("unix://%s", socketPath),
+		SocketMode:  "0660",
+		SocketOwner: fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("can't create listener: %v", err)
+	}
+
+	l, err := hl.listen(nil)
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	defer l.Close()
+
+	fi, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("can't stat socket: %v", err)
+	}
+
+	if fi.Mode().Perm() != 0660 {
+		t.Errorf("expect socket mode %o to be %o", fi.Mode().Perm(), 0660)
+	}
+
+	st := fi.Sys().(*syscall.Stat_t)
+	if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+		t.Errorf("expect socket owner %d:%d to be %d:%d", st.Uid, st.Gid, os.Getuid(), os.Getgid())
+	}
+
+	if l.Addr().String() != socketPath {
+		t.Errorf("expect listener address %s to be %s", l.Addr().String(), socketPath)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expect only the socket in %s, got %d files", dir, len(files))
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("can't connect to socket: %v", err)
+	}
+	conn.Close()
+
+	l.Close()
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("expect socket to be removed on close, got %v", err)
+	}
+}
+
+func TestHookListenerInvalidConfig(t *testing.T) {
+	for _, lc := range []componentconfig.ListenerConfiguration{
+		{Name: "mode", Address: "unix:///tmp/a.sock", SocketMode: "0999"},
+		{Name: "owner", Address: "unix:///tmp/a.sock", SocketOwner: "lighthouse-no-such-user"},
+	} {
+		if _, err := newHookListener(&lc, http.NotFoundHandler()); err == nil {
+			t.Errorf("expect listener %s to be invalid", lc.Name)
+		}
+	}
+
+	hm := NewHookManager()
+	err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        10,
+		RemoteEndpoint: "unix:///var/run/docker.sock",
+		Listeners: componentconfig.ListenerConfigurationList{
+			{Address: "unix:///tmp/a.sock", WebHooks: []string{"unknown"}},
+		},
+	})
+	if err == nil {
+		t.Errorf("expect unknown webhook to be rejected")
+	}
+}
+
+func TestHookManagerReadOnlyListener(t *testing.T) {
+	backendServer := test.NewUnixSocketServer()
+	backendServer.RegisterHandler("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ready := make(chan struct{})
+	go func() {
+		close(ready)
+		backendServer.Start()
+	}()
+	defer backendServer.Stop()
+	<-ready
+
+	hm := NewHookManager()
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        10,
+		ListenAddress:  "unix:///tmp/lighthouse-default.sock",
+		RemoteEndpoint: backendServer.GetAddress(),
+		Listeners: componentconfig.ListenerConfigurationList{
+			{Name: "human", Address: "unix:///tmp/lighthouse-human.sock", ReadOnly: true},
+		},
+	}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+
+	if len(hm.listeners) != 2 {
+		t.Fatalf("expect %d listeners to be 2", len(hm.listeners))
+	}
+
+	for _, u := range []struct {
+		listener int
+		method   string
+		path     string
+		code     int
+	}{
+		{0, http.MethodPost, "/containers/create", http.StatusOK},
+		{1, http.MethodPost, "/containers/create", http.StatusForbidden},
+		{1, http.MethodGet, "/v1.40/containers/json", http.StatusOK},
+		{1, http.MethodGet, "/containers/abc/json", http.StatusOK},
+		{1, http.MethodHead, "/_ping", http.StatusOK},
+		{1, http.MethodGet, "/images/quay.io/coreos/etcd:v3.4/json", http.StatusOK},
+		{0, http.MethodGet, "/containers/abc/export", http.StatusOK},
+		{1, http.MethodGet, "/containers/abc/export", http.StatusForbidden},
+		{1, http.MethodGet, "/v1.40/containers/abc/attach/ws", http.StatusForbidden},
+		{1, http.MethodGet, "/containers/abc/archive", http.StatusForbidden},
+		{1, http.MethodHead, "/containers/abc/archive", http.StatusForbidden},
+		{1, http.MethodGet, "/images/busybox/get", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(u.method, u.path, strings.NewReader("{}"))
+		ans := httptest.NewRecorder()
+		hm.listeners[u.listener].handler.ServeHTTP(ans, req)
+		if ans.Code != u.code {
+			t.Errorf("expect %s %s on listener %d to be %d, got %d", u.method, u.path, u.listener, u.code, ans.Code)
+		}
+	}
+}
+
+func TestTakeActivatedListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lighthouse")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	activated := make(map[string][]net.Listener)
+	for _, name := range []string{"default", "lighthouse.socket"} {
+		l, err := net.Listen("unix", filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("can't listen: %v", err)
+		}
+		defer l.Close()
+		activated[name] = []net.Listener{l}
+	}
+
+	if l := takeActivatedListener(activated, "default", "unix", "/not/matched"); l == nil ||
+		l.Addr().String() != filepath.Join(dir, "default") {
+		t.Errorf("expect listener to be matched by name")
+	}
+
+	addr := filepath.Join(dir, "lighthouse.socket")
+	if l := takeActivatedListener(activated, "human", "unix", addr); l == nil || l.Addr().String() != addr {
+		t.Errorf("expect listener to be matched by address")
+	}
+
+	if l := takeActivatedListener(activated, "default", "unix", addr); l != nil {
+		t.Errorf("expect no listener left, got %s", l.Addr().String())
+	}
+}
@@ -0,0 +1,217 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestManagerEmbedded(t *testing.T) {
+	bodies := make(chan string, 1)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+		w.Write([]byte(`{}`))
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+
+	hm := NewManager(WithListener("embedded", l), WithBackend(backend), WithSystemd(false),
+		WithMetricsRegistry(prometheus.NewRegistry()), WithTimeout(time.Second))
+
+	patchWith := func(data string) HookHandler {
+		return &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.MergePatchType)
+				patch.PatchData = []byte(data)
+				return nil
+			},
+		}
+	}
+
+	if err := hm.RegisterHook(HookRegistration{
+		Name:    "label",
+		Handler: patchWith(`{"Labels":{"a":"b"}}`),
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	if err := hm.RegisterHook(HookRegistration{Name: "label", Handler: patchWith(`{}`)}); err == nil {
+		t.Errorf("expect duplicated hook to be rejected")
+	}
+
+	if err := hm.AddRoute("label", componentconfig.HookStage{Method: http.MethodPost, URLPattern: "/containers/create",
+		Type: "unknown"}); err == nil {
+		t.Errorf("expect invalid stage to be rejected")
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- hm.Run(make(chan struct{}))
+	}()
+
+	send := func(path string) string {
+		resp, err := http.Post("http://"+l.Addr().String()+path, "application/json",
+			bytes.NewBufferString(`{"Image":"busybox"}`))
+		if err != nil {
+			t.Fatalf("can't send request: %v", err)
+		}
+		resp.Body.Close()
+		return <-bodies
+	}
+
+	if body := send("/containers/create"); body != `{"Image":"busybox","Labels":{"a":"b"}}` {
+		t.Errorf("unexpected body of create %s", body)
+	}
+
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{Timeout: 1}); err == nil {
+		t.Errorf("expect init of a running manager to be rejected")
+	}
+
+	if body := send("/networks/create"); body != `{"Image":"busybox"}` {
+		t.Errorf("unexpected body of network create before AddRoute %s", body)
+	}
+
+	if err := hm.AddRoute("label", componentconfig.HookStage{Method: http.MethodPost,
+		URLPattern: "/networks/create", Type: componentconfig.PreHookType}); err != nil {
+		t.Fatalf("can't add route: %v", err)
+	}
+
+	if body := send("/networks/create"); body != `{"Image":"busybox","Labels":{"a":"b"}}` {
+		t.Errorf("unexpected body of network create after AddRoute %s", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hm.Shutdown(ctx); err != nil {
+		t.Fatalf("can't shutdown: %v", err)
+	}
+
+	if err := <-runErr; err != nil {
+		t.Errorf("unexpected error of Run %v", err)
+	}
+}
+
+type closingHook struct {
+	fakeHookHandler
+	name   string
+	closed chan string
+}
+
+func (c *closingHook) Close() error {
+	c.closed <- c.name
+	return nil
+}
+
+var closedHooks = make(chan string, 2)
+
+func init() {
+	RegisterBuiltin("test-closing", func(cfg *BuiltinConfig) (HookHandler, error) {
+		return &closingHook{name: cfg.Name, closed: closedHooks}, nil
+	})
+}
+
+func TestInitFromConfigKeepsRegisteredHooks(t *testing.T) {
+	closed := closedHooks
+
+	hm := NewManager(WithBackend(http.NotFoundHandler()), WithSystemd(false))
+	if err := hm.RegisterHook(HookRegistration{Name: "registered", Handler: &fakeHookHandler{}}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	configWith := func(name string) *componentconfig.HookConfiguration {
+		return &componentconfig.HookConfiguration{
+			Timeout: 1,
+			WebHooks: componentconfig.HookConfigurationList{
+				{Name: name, Type: componentconfig.BuiltinWebHook, Builtin: "test-closing"},
+			},
+		}
+	}
+
+	if err := hm.InitFromConfig(configWith("configured")); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+	if err := hm.InitFromConfig(configWith("registered")); err == nil {
+		t.Errorf("expect an error of a webhook with the name of a registered hook")
+	}
+	if err := hm.InitFromConfig(configWith("configured")); err != nil {
+		t.Fatalf("can't init hook manager again: %v", err)
+	}
+
+	select {
+	case name := <-closed:
+		if name != "configured" {
+			t.Errorf("expect replaced hook to be closed, got %s", name)
+		}
+	default:
+		t.Errorf("expect replaced hook to be closed")
+	}
+	if len(closed) > 0 {
+		t.Errorf("expect only the replaced hook to be closed, got %s", <-closed)
+	}
+
+	var names []string
+	for _, h := range hm.hooks {
+		names = append(names, h.name)
+	}
+	if len(names) != 2 || names[0] != "configured" || names[1] != "registered" {
+		t.Errorf("expect configured and registered hooks, got %v", names)
+	}
+}
+
+func TestInitFromConfigAtomic(t *testing.T) {
+	closed := closedHooks
+
+	hm := NewManager(WithBackend(http.NotFoundHandler()), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:  1,
+		WebHooks: componentconfig.HookConfigurationList{{Name: "applied", Type: componentconfig.BuiltinWebHook}},
+	}); err == nil {
+		t.Fatalf("expect an error of a builtin webhook without builtin")
+	}
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{Timeout: 1}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        7,
+		APITranslation: componentconfig.APITranslationConfiguration{Enabled: true, CanonicalAPIVersion: "1.44"},
+		Inventory:      componentconfig.InventoryConfiguration{Enabled: true},
+		AdminAddress:   "tcp://127.0.0.1:0",
+		WebHooks: componentconfig.HookConfigurationList{
+			{Name: "invalid", Type: componentconfig.BuiltinWebHook, Builtin: "test-closing"},
+		},
+		Listeners: componentconfig.ListenerConfigurationList{{Name: "docker", WebHooks: []string{"missing"}}},
+	}); err == nil {
+		t.Fatalf("expect an error of a listener referring to an unknown webhook")
+	}
+
+	if hm.timeout != time.Second || hm.translator != nil || hm.inventory != nil || hm.admin != nil ||
+		len(hm.listeners) > 0 || len(hm.hooks) > 0 {
+		t.Errorf("expect the manager not to be changed by an invalid configuration")
+	}
+
+	select {
+	case name := <-closed:
+		if name != "invalid" {
+			t.Errorf("expect the hook of the invalid configuration to be closed, got %s", name)
+		}
+	default:
+		t.Errorf("expect the hook of the invalid configuration to be closed")
+	}
+}
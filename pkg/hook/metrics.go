@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "lighthouse"
+
+// hookMetrics are registered to the registry of a hook manager, and served on the admin listener
+type hookMetrics struct {
+	registry        *prometheus.Registry
+	patchConflicts  *prometheus.CounterVec
+	hookQueueLength *prometheus.GaugeVec
+	hookRejections  *prometheus.CounterVec
+	hookCacheHits   *prometheus.CounterVec
+	hookCacheMisses *prometheus.CounterVec
+	asyncDropped    *prometheus.CounterVec
+}
+
+func newHookMetrics(registry *prometheus.Registry) *hookMetrics {
+	m := &hookMetrics{
+		registry: registry,
+		patchConflicts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "patch_conflicts_total",
+			Help:      "Number of fields changed by a hook which are set by an earlier hook of the same chain.",
+		}, []string{"type", "hook", "previous_hook", "policy"}),
+		hookQueueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "hook_queue_length",
+			Help:      "Number of calls of a hook waiting for its max in-flight calls.",
+		}, []string{"hook"}),
+		hookRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "hook_rejections_total",
+			Help:      "Number of calls of a hook shed by its concurrency limit.",
+		}, []string{"hook", "reason"}),
+		hookCacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "hook_cache_hits_total",
+			Help:      "Number of calls of a hook answered by its cache.",
+		}, []string{"hook"}),
+		hookCacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "hook_cache_misses_total",
+			Help:      "Number of calls of a hook not found in its cache.",
+		}, []string{"hook"}),
+		asyncDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "async_jobs_dropped_total",
+			Help:      "Number of calls of async hooks dropped because the queue is full or closed.",
+		}, []string{"reason"}),
+	}
+
+	registry.MustRegister(m.patchConflicts, m.hookQueueLength, m.hookRejections, m.hookCacheHits, m.hookCacheMisses,
+		m.asyncDropped)
+
+	return m
+}
+
+func (m *hookMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,106 @@
+package hook
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mYmNeo/lighthouse/pkg/trace"
+)
+
+const (
+	defaultTimeout        = 5 * time.Second
+	defaultAsyncWorkers   = 4
+	defaultAsyncQueueSize = 1024
+	// asyncDrainTimeout is how long the queued async hooks are waited when the queue is closed
+	asyncDrainTimeout = 10 * time.Second
+	// transportBackendHost is the host of the requests sent to a backend given by WithBackendTransport
+	transportBackendHost = "docker"
+)
+
+// Option configures a Manager built by NewManager
+type Option func(m *Manager)
+
+// Middleware wraps a handler, e.g. to record or to authorize the requests
+type Middleware func(next http.Handler) http.Handler
+
+// WithListener serves the hooks on l. If a listener of the configuration has the same name, e.g. "default" for
+// ListenAddress, l is used instead of listening on its address, otherwise a listener serving all the hooks is added.
+// The manager closes l when it stops
+func WithListener(name string, l net.Listener) Option {
+	return func(m *Manager) {
+		m.provided[name] = append(m.provided[name], l)
+	}
+}
+
+// WithBackend sends the requests to h after the pre hooks, the RemoteEndpoint of the configuration is not used. h is
+// checked by /readyz if it has a HealthCheck(ctx context.Context) error method
+func WithBackend(h http.Handler) Option {
+	return func(m *Manager) {
+		m.backend = h
+	}
+}
+
+// WithBackendTransport proxies the requests to the Docker daemon reached by tr, e.g. a transport dialing a socket
+// which is not known by the configuration
+func WithBackendTransport(tr http.RoundTripper) Option {
+	return func(m *Manager) {
+		m.backend = newTransportProxy(transportBackendHost, tr)
+	}
+}
+
+// WithTracer exports the spans of the requests and the hooks by t, the tracing of the configuration is not used.
+// The manager closes t when it stops
+func WithTracer(t *trace.Tracer) Option {
+	return func(m *Manager) {
+		m.tracer = t
+	}
+}
+
+// WithMetricsRegistry registers the metrics of the manager to registry instead of a private one, it's served on
+// /metrics of the admin listener
+func WithMetricsRegistry(registry *prometheus.Registry) Option {
+	return func(m *Manager) {
+		m.metrics = newHookMetrics(registry)
+	}
+}
+
+// WithTimeout sets the timeout of the hooks of a request, it's overridden by InitFromConfig
+func WithTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.timeout = timeout
+	}
+}
+
+// WithSystemd sets whether Run takes the sockets passed by systemd, and notifies systemd of readiness and the
+// watchdog. It's enabled by default, an embedding program which talks to systemd itself should disable it
+func WithSystemd(enabled bool) Option {
+	return func(m *Manager) {
+		m.systemd = enabled
+	}
+}
+
+// WithMiddleware wraps the handlers serving the clients, the middleware given first is the outermost one
+func WithMiddleware(mw Middleware) Option {
+	return func(m *Manager) {
+		m.middlewares = append(m.middlewares, mw)
+	}
+}
+
+// WithBackendMiddleware wraps the backend, the requests it gets are patched by the pre hooks, and the responses it
+// returns are patched by the post hooks afterwards
+func WithBackendMiddleware(mw Middleware) Option {
+	return func(m *Manager) {
+		m.backendMiddlewares = append(m.backendMiddlewares, mw)
+	}
+}
+
+// wrap applies the middlewares to h, the first middleware is the outermost one
+func wrap(h http.Handler, middlewares []Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
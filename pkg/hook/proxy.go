@@ -1,6 +1,8 @@
 package hook
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httputil"
 
@@ -11,7 +13,9 @@ import (
 )
 
 type reverseProxy struct {
-	proxy *httputil.ReverseProxy
+	proxy  *httputil.ReverseProxy
+	client *http.Client
+	addr   string
 }
 
 func newReverseProxy(remoteEndpoint string) *reverseProxy {
@@ -23,6 +27,11 @@ func newReverseProxy(remoteEndpoint string) *reverseProxy {
 	tr := new(http.Transport)
 	sockets.ConfigureTransport(tr, proto, addr)
 
+	return newTransportProxy(addr, tr)
+}
+
+// newTransportProxy returns a proxy which sends the requests to addr through tr
+func newTransportProxy(addr string, tr http.RoundTripper) *reverseProxy {
 	rp := &reverseProxy{
 		proxy: &httputil.ReverseProxy{
 			Director: func(req *http.Request) {
@@ -35,6 +44,8 @@ func newReverseProxy(remoteEndpoint string) *reverseProxy {
 			},
 			Transport: tr,
 		},
+		client: &http.Client{Transport: tr},
+		addr:   addr,
 	}
 
 	return rp
@@ -44,3 +55,23 @@ func (rp *reverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	klog.V(8).Infof("Serve request %s", req.URL.String())
 	rp.proxy.ServeHTTP(w, req)
 }
+
+// HealthCheck pings the backend
+func (rp *reverseProxy) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/_ping", rp.addr), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping status code is %d", resp.StatusCode)
+	}
+
+	return nil
+}
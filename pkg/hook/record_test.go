@@ -0,0 +1,110 @@
+package hook
+
+import (
+	"bytes"
+	gjson "encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/record"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+func TestRecordAndReplayWithFakeDocker(t *testing.T) {
+	fakeDocker := test.NewFakeDocker()
+	go fakeDocker.Start()
+	defer fakeDocker.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	label := HookRegistration{
+		Name: "label",
+		Handler: &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.StrategicMergePatchType)
+				patch.PatchData = []byte(`{"Labels":{"lighthouse":"true"}}`)
+				return nil
+			},
+		},
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}
+
+	fixture := &bytes.Buffer{}
+	recorder := record.NewRecorder(fixture)
+	hm := NewManager(WithMiddleware(recorder.Client), WithBackendMiddleware(recorder.Backend), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        1,
+		RemoteEndpoint: fakeDocker.GetAddress(),
+	}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+	if err := hm.RegisterHook(label); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	send := func(method, path, body string, code int) string {
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if ans.Code != code {
+			t.Fatalf("expect status code %d of %s %s to be %d, body %s", ans.Code, method, path, code, ans.Body)
+		}
+		return ans.Body.String()
+	}
+
+	created := struct{ Id string }{}
+	gjson.Unmarshal([]byte(send(http.MethodPost, "/v1.40/containers/create?name=foo", `{"Image":"busybox"}`,
+		http.StatusCreated)), &created)
+	send(http.MethodPost, "/v1.40/containers/foo/start", "", http.StatusNoContent)
+
+	inspected := struct {
+		Config struct{ Labels map[string]string }
+		State  struct{ Running bool }
+	}{}
+	gjson.Unmarshal([]byte(send(http.MethodGet, "/v1.40/containers/"+created.Id[:12]+"/json", "", http.StatusOK)),
+		&inspected)
+	if !inspected.State.Running || inspected.Config.Labels["lighthouse"] != "true" {
+		t.Errorf("unexpected inspect %+v", inspected)
+	}
+
+	if list := send(http.MethodGet, `/v1.40/containers/json?filters={"label":{"lighthouse=true":true}}`, "",
+		http.StatusOK); !strings.Contains(list, created.Id) {
+		t.Errorf("expect container to be listed, %s", list)
+	}
+
+	send(http.MethodDelete, "/v1.40/containers/foo", "", http.StatusConflict)
+	send(http.MethodPost, "/v1.40/containers/foo/stop", "", http.StatusNoContent)
+	send(http.MethodDelete, "/v1.40/containers/foo", "", http.StatusNoContent)
+	if containers := fakeDocker.Containers(); len(containers) != 0 {
+		t.Errorf("expect containers to be removed, %+v", containers)
+	}
+
+	exchanges, err := record.LoadFixture(fixture)
+	if err != nil {
+		t.Fatalf("can't load fixture: %v", err)
+	}
+	if len(exchanges) != 7 {
+		t.Fatalf("expect %d exchanges to be 7", len(exchanges))
+	}
+	if exchanges[0].Body != `{"Image":"busybox"}` || exchanges[0].BackendStatusCode != http.StatusCreated {
+		t.Errorf("unexpected exchange of create %+v", exchanges[0])
+	}
+
+	replayed := NewManager(WithBackend(record.NewReplayer(exchanges)), WithSystemd(false))
+	if err := replayed.RegisterHook(label); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	for i, ex := range record.Replay(replayed, exchanges) {
+		if ex.StatusCode != exchanges[i].StatusCode || ex.ResponseBody != exchanges[i].ResponseBody {
+			t.Errorf("expect replayed %s %s %d %s to be %d %s", ex.Method, ex.URI, ex.StatusCode, ex.ResponseBody,
+				exchanges[i].StatusCode, exchanges[i].ResponseBody)
+		}
+	}
+}
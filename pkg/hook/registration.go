@@ -0,0 +1,135 @@
+package hook
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+// HookRegistration describes a hook registered by RegisterHook, the fields have the same meaning as the ones of a
+// webhook in the configuration
+type HookRegistration struct {
+	Name    string
+	Handler HookHandler
+	// FailurePolicy is Fail if not set
+	FailurePolicy  componentconfig.FailurePolicyType
+	Priority       int
+	SideEffectOnly bool
+	Async          bool
+	SandboxAware   bool
+	// MaxInFlight, MaxQueueLength and QueueTimeout limit the concurrent calls of the hook, they are unlimited if
+	// MaxInFlight is 0
+	MaxInFlight    int
+	MaxQueueLength int
+	QueueTimeout   time.Duration
+	// CacheTTL and CacheMaxEntries keep the answers of the hook in memory, they are not cached if CacheTTL is 0
+	CacheTTL        time.Duration
+	CacheMaxEntries int
+	Stages          componentconfig.HookStageList
+}
+
+// RegisterHook adds a hook to the manager, it's served by the listeners which don't limit their webhooks. It can be
+// called while the manager is running, the requests being served are not affected
+func (hm *Manager) RegisterHook(reg HookRegistration) error {
+	if len(reg.Name) == 0 {
+		return fmt.Errorf("hook has no name")
+	}
+
+	if reg.Handler == nil {
+		return fmt.Errorf("hook %s has no handler", reg.Name)
+	}
+
+	policy := reg.FailurePolicy
+	if len(policy) == 0 {
+		policy = componentconfig.PolicyFail
+	}
+	if policy != componentconfig.PolicyFail && policy != componentconfig.PolicyIgnore {
+		return fmt.Errorf("unknown failure policy %s of hook %s", policy, reg.Name)
+	}
+
+	for _, stage := range reg.Stages {
+		if err := validateStage(stage); err != nil {
+			return fmt.Errorf("invalid stage %s %s %s of hook %s, %v", stage.Type, stage.Method, stage.URLPattern,
+				reg.Name, err)
+		}
+	}
+
+	limiter, err := newConcurrencyLimiter(reg.Name, reg.MaxInFlight, reg.MaxQueueLength, reg.QueueTimeout, hm.metrics)
+	if err != nil {
+		return fmt.Errorf("invalid hook %s, %v", reg.Name, err)
+	}
+
+	if reg.CacheTTL > 0 && (reg.SideEffectOnly || reg.Async) {
+		return fmt.Errorf("side effect only hook %s can't be cached", reg.Name)
+	}
+	cache, err := newHookCache(reg.Name, componentconfig.HookCacheConfiguration{
+		TTL:        metav1.Duration{Duration: reg.CacheTTL},
+		MaxEntries: reg.CacheMaxEntries,
+	}, hm.metrics)
+	if err != nil {
+		return fmt.Errorf("invalid cache of hook %s, %v", reg.Name, err)
+	}
+
+	hm.lock.Lock()
+	for _, h := range hm.hooks {
+		if h.name == reg.Name {
+			hm.lock.Unlock()
+			return fmt.Errorf("hook %s is already registered", reg.Name)
+		}
+	}
+
+	klog.Infof("Register hook %s", reg.Name)
+	hm.hooks = append(hm.hooks, &hookHandle{
+		HookHandler:    reg.Handler,
+		name:           reg.Name,
+		priority:       reg.Priority,
+		failurePolicy:  policy,
+		sideEffectOnly: reg.SideEffectOnly || reg.Async,
+		async:          reg.Async,
+		stages:         append(componentconfig.HookStageList(nil), reg.Stages...),
+		limiter:        limiter,
+		cache:          cache,
+		sandboxAware:   reg.SandboxAware,
+	})
+	hm.lock.Unlock()
+
+	hm.buildRouters()
+	return nil
+}
+
+// AddRoute adds a stage to a registered hook, so the hook is applied to the requests matching the stage
+func (hm *Manager) AddRoute(hookName string, stage componentconfig.HookStage) error {
+	if err := validateStage(stage); err != nil {
+		return fmt.Errorf("invalid stage %s %s %s of hook %s, %v", stage.Type, stage.Method, stage.URLPattern,
+			hookName, err)
+	}
+
+	hm.lock.Lock()
+	var hook *hookHandle
+	for _, h := range hm.hooks {
+		if h.name == hookName {
+			hook = h
+			break
+		}
+	}
+
+	if hook == nil {
+		hm.lock.Unlock()
+		return fmt.Errorf("unknown hook %s", hookName)
+	}
+
+	hook.stages = append(hook.stages, stage)
+	hm.lock.Unlock()
+
+	hm.buildRouters()
+	return nil
+}
+
+// validateStage returns the error of a stage which can't be routed
+func validateStage(stage componentconfig.HookStage) error {
+	return (&hookRouter{}).addRoute(stage, nil)
+}
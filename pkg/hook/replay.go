@@ -0,0 +1,152 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+// Decisions of a hook about a request
+const (
+	// DecisionPatched is set if the hook changed the body
+	DecisionPatched = "patched"
+	// DecisionUnchanged is set if the hook returned no patch, or a patch which doesn't change the body
+	DecisionUnchanged = "unchanged"
+	// DecisionDenied is set if the hook denied the request
+	DecisionDenied = "denied"
+	// DecisionFailed is set if the hook failed and the request is rejected
+	DecisionFailed = "failed"
+	// DecisionIgnored is set if the hook failed and the failure is ignored by its failure policy
+	DecisionIgnored = "ignored"
+	// DecisionSideEffect is set for a side effect only hook, its patch is dropped
+	DecisionSideEffect = "side-effect"
+	// DecisionQueued is set for an async hook, it runs after the request
+	DecisionQueued = "queued"
+	// DecisionSkipped is set for a side effect only or async hook in a replay, it's not called
+	DecisionSkipped = "skipped"
+)
+
+// HookDecision is what a hook did to a request
+type HookDecision struct {
+	Hook     string
+	HookType componentconfig.HookType
+	Decision string
+	// Message is the error of the hook
+	Message string
+	// Changed are the JSON pointers changed by the patch of the hook
+	Changed []string
+}
+
+// decisionLog collects the decisions of the hooks applied to a request, it's carried by the context of the request
+type decisionLog struct {
+	lock      sync.Mutex
+	decisions []HookDecision
+	// replay is set if the request is replayed, so the hooks with side effects are not called
+	replay bool
+}
+
+type decisionLogKey struct{}
+
+func withDecisionLog(ctx context.Context, log *decisionLog) context.Context {
+	if log == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, decisionLogKey{}, log)
+}
+
+// decisionLogFrom returns nil if the decisions are not collected
+func decisionLogFrom(ctx context.Context) *decisionLog {
+	log, _ := ctx.Value(decisionLogKey{}).(*decisionLog)
+	return log
+}
+
+func (l *decisionLog) add(h *hookHandle, hookType componentconfig.HookType, decision string, err error,
+	changed []string) {
+	if l == nil {
+		return
+	}
+
+	d := HookDecision{Hook: h.name, HookType: hookType, Decision: decision, Changed: changed}
+	if err != nil {
+		d.Message = err.Error()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.decisions = append(l.decisions, d)
+}
+
+// enabled returns whether the decisions are collected, so the changes are only computed if needed
+func (l *decisionLog) enabled() bool {
+	return l != nil
+}
+
+// replaying returns whether the request is replayed
+func (l *decisionLog) replaying() bool {
+	return l != nil && l.replay
+}
+
+// ReplayRequest is a captured request replayed by Manager.Replay
+type ReplayRequest struct {
+	Method string
+	// URI is the path and the query of the request
+	URI  string
+	Body []byte
+	// BackendStatusCode and BackendBody are the canned response of the backend, post hooks run only if
+	// BackendStatusCode is set
+	BackendStatusCode int
+	BackendBody       []byte
+}
+
+// ReplayResult is the outcome of a replayed request
+type ReplayResult struct {
+	// Body is the request body which would be sent to the backend
+	Body []byte
+	// Rejected is set if the request is rejected by the pre hooks, so it's not sent to the backend
+	Rejected bool
+	// StatusCode and ResponseBody are the response sent to the client, StatusCode is 0 if the request passes the pre
+	// hooks and post hooks are not run
+	StatusCode   int
+	ResponseBody []byte
+	// Decisions are the decisions of the hooks in the order they are applied
+	Decisions []HookDecision
+}
+
+// Replay applies the hooks to a captured request without the listeners and the backend. The request is routed as
+// if it's received by a listener serving all the hooks, and the post hooks get the canned response of the backend.
+// The side effect only and async hooks are skipped
+func (hm *Manager) Replay(rr *ReplayRequest) *ReplayResult {
+	log := &decisionLog{replay: true}
+	req := httptest.NewRequest(rr.Method, rr.URI, bytes.NewReader(rr.Body))
+	req = req.WithContext(withDecisionLog(req.Context(), log))
+
+	result := &ReplayResult{Body: rr.Body}
+	hookReq, chain := hm.routes.load().resolve(req)
+	if !chain.empty() {
+		w := httptest.NewRecorder()
+		if err := hm.buildPreHookHandlerFunc(chain)(w, hookReq); err != nil {
+			result.Rejected = true
+			result.StatusCode, result.ResponseBody = w.Code, w.Body.Bytes()
+			result.Decisions = log.decisions
+			return result
+		}
+		result.Body, _ = ioutil.ReadAll(hookReq.Body)
+	}
+
+	if rr.BackendStatusCode != 0 {
+		w := httptest.NewRecorder()
+		w.WriteHeader(rr.BackendStatusCode)
+		w.Write(rr.BackendBody)
+		if !chain.empty() {
+			hm.buildPostHookHandlerFunc(chain)(w, hookReq)
+		}
+		result.StatusCode, result.ResponseBody = w.Code, w.Body.Bytes()
+	}
+
+	result.Decisions = log.decisions
+	return result
+}
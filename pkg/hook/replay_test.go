@@ -0,0 +1,142 @@
+package hook
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestManagerReplay(t *testing.T) {
+	hm := NewManager(WithBackend(http.NotFoundHandler()), WithSystemd(false))
+
+	register := func(name string, policy componentconfig.FailurePolicyType, hookType componentconfig.HookType,
+		fn func(patch *PatchData, body []byte) error) {
+		handler := &fakeHookHandler{preHook: fn}
+		if hookType == componentconfig.PostHookType {
+			handler = &fakeHookHandler{postHook: fn}
+		}
+
+		if err := hm.RegisterHook(HookRegistration{
+			Name:          name,
+			Handler:       handler,
+			FailurePolicy: policy,
+			Stages: componentconfig.HookStageList{
+				{Method: http.MethodPost, URLPattern: "/containers/create", Type: hookType},
+			},
+		}); err != nil {
+			t.Fatalf("can't register hook %s: %v", name, err)
+		}
+	}
+
+	register("label", componentconfig.PolicyFail, componentconfig.PreHookType,
+		func(patch *PatchData, body []byte) error {
+			patch.PatchType = string(types.MergePatchType)
+			patch.PatchData = []byte(`{"Labels":{"a":"b"}}`)
+			return nil
+		})
+	register("broken", componentconfig.PolicyIgnore, componentconfig.PreHookType,
+		func(patch *PatchData, body []byte) error {
+			return fmt.Errorf("broken")
+		})
+	register("noop", componentconfig.PolicyFail, componentconfig.PreHookType,
+		func(patch *PatchData, body []byte) error {
+			return nil
+		})
+	register("warning", componentconfig.PolicyFail, componentconfig.PostHookType,
+		func(patch *PatchData, body []byte) error {
+			patch.PatchType = string(types.MergePatchType)
+			patch.PatchData = []byte(`{"Warnings":["labeled"]}`)
+			return nil
+		})
+
+	result := hm.Replay(&ReplayRequest{
+		Method:            http.MethodPost,
+		URI:               "/v1.40/containers/create",
+		Body:              []byte(`{"Image":"busybox"}`),
+		BackendStatusCode: http.StatusCreated,
+		BackendBody:       []byte(`{"Id":"abc","Warnings":[]}`),
+	})
+
+	if string(result.Body) != `{"Image":"busybox","Labels":{"a":"b"}}` {
+		t.Errorf("unexpected request body %s", result.Body)
+	}
+
+	if result.Rejected || result.StatusCode != http.StatusCreated ||
+		string(result.ResponseBody) != `{"Id":"abc","Warnings":["labeled"]}` {
+		t.Errorf("unexpected response %d %s", result.StatusCode, result.ResponseBody)
+	}
+
+	expected := []HookDecision{
+		{Hook: "label", HookType: componentconfig.PreHookType, Decision: DecisionPatched, Changed: []string{"/Labels/a"}},
+		{Hook: "broken", HookType: componentconfig.PreHookType, Decision: DecisionIgnored, Message: "broken"},
+		{Hook: "noop", HookType: componentconfig.PreHookType, Decision: DecisionUnchanged},
+		{Hook: "warning", HookType: componentconfig.PostHookType, Decision: DecisionPatched,
+			Changed: []string{"/Warnings/0"}},
+	}
+	if !reflect.DeepEqual(result.Decisions, expected) {
+		t.Errorf("expect decisions %+v to be %+v", result.Decisions, expected)
+	}
+
+	register("deny", componentconfig.PolicyFail, componentconfig.PreHookType,
+		func(patch *PatchData, body []byte) error {
+			return &DeniedError{Hook: "deny", Message: "not allowed"}
+		})
+
+	result = hm.Replay(&ReplayRequest{Method: http.MethodPost, URI: "/containers/create", Body: []byte(`{}`)})
+	if !result.Rejected || result.StatusCode != http.StatusForbidden {
+		t.Errorf("expect request to be rejected, %+v", result)
+	}
+
+	if last := result.Decisions[len(result.Decisions)-1]; last.Hook != "deny" || last.Decision != DecisionDenied {
+		t.Errorf("unexpected decision %+v", last)
+	}
+
+	result = hm.Replay(&ReplayRequest{Method: http.MethodGet, URI: "/containers/json"})
+	if len(result.Decisions) != 0 || result.StatusCode != 0 {
+		t.Errorf("expect unmatched request to be untouched, %+v", result)
+	}
+}
+
+func TestManagerReplaySkipsSideEffects(t *testing.T) {
+	hm := NewManager(WithBackend(http.NotFoundHandler()), WithSystemd(false))
+
+	called := make(chan string, 2)
+	for _, reg := range []HookRegistration{
+		{Name: "notify", SideEffectOnly: true},
+		{Name: "audit", Async: true},
+	} {
+		name := reg.Name
+		reg.Handler = &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				called <- name
+				return nil
+			},
+		}
+		reg.Stages = componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		}
+		if err := hm.RegisterHook(reg); err != nil {
+			t.Fatalf("can't register hook %s: %v", name, err)
+		}
+	}
+
+	result := hm.Replay(&ReplayRequest{Method: http.MethodPost, URI: "/containers/create", Body: []byte(`{}`)})
+
+	expected := []HookDecision{
+		{Hook: "notify", HookType: componentconfig.PreHookType, Decision: DecisionSkipped},
+		{Hook: "audit", HookType: componentconfig.PreHookType, Decision: DecisionSkipped},
+	}
+	if !reflect.DeepEqual(result.Decisions, expected) {
+		t.Errorf("expect decisions %+v to be %+v", result.Decisions, expected)
+	}
+
+	hm.closeAsyncQueue(hm.asyncQueue)
+	if len(called) > 0 {
+		t.Errorf("expect hook %s not to be called", <-called)
+	}
+}
@@ -0,0 +1,200 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	// HeaderAPIVersion is the Docker API version of the hooked request
+	HeaderAPIVersion = "X-Lighthouse-Api-Version"
+	// HeaderProtocol is the wire protocol of the hook request
+	HeaderProtocol = "X-Lighthouse-Protocol"
+	// HeaderStatusCode is the status code of the backend response, it's sent to post hooks of protocol v2
+	HeaderStatusCode = "X-Lighthouse-Status-Code"
+	// HeaderContainer is the JSON of the container in the inventory which the request refers to
+	HeaderContainer = "X-Lighthouse-Container"
+	// HeaderContainerType is podsandbox or container for the creates of kubelet
+	HeaderContainerType = "X-Lighthouse-Container-Type"
+	// HeaderSandbox is the JSON of the pod sandbox of the app container created by kubelet
+	HeaderSandbox = "X-Lighthouse-Sandbox"
+	// HeaderRequestUID is the UID of the request, it's the same for the pre and post hooks of a request
+	HeaderRequestUID = "X-Lighthouse-Request-Uid"
+	// HeaderOriginalRequest is the base64 of the request body sent by the client, it's sent to post hooks of
+	// protocol v2 with post hook headers enabled
+	HeaderOriginalRequest = "X-Lighthouse-Original-Request"
+	// HeaderRequest is the base64 of the request body patched by the pre hooks, it's sent to post hooks of protocol v2
+	// with post hook headers enabled
+	HeaderRequest = "X-Lighthouse-Request"
+	// HeaderHookState is the base64 of the state attached by the pre hook of the webhook, it's sent to post hooks of
+	// protocol v2 with post hook headers enabled
+	HeaderHookState = "X-Lighthouse-Hook-State"
+)
+
+// RequestInfo is the information of a hooked request which is passed to hooks
+type RequestInfo struct {
+	// APIVersion is the Docker API version of the request, it's empty if the request path is not versioned. It's the
+	// canonical version if the request is translated
+	APIVersion string
+	// ClientAPIVersion is the Docker API version requested by the client
+	ClientAPIVersion string
+	// StatusCode is the status code of the backend response, it's only set for post hooks
+	StatusCode int
+	// Container is the container in the inventory which the request refers to by its path, it's nil if the
+	// inventory is disabled or the container is not found
+	Container *ContainerInfo
+	// ContainerType is podsandbox or container for the creates of kubelet, it's empty for other requests
+	ContainerType string
+	// Sandbox is the pod sandbox of the app container created by kubelet, only its ID is set if it's not in the
+	// inventory
+	Sandbox *ContainerInfo
+	// UID identifies the request, it's shared by the pre and post hooks of the request
+	UID string
+	// OriginalRequestBody is the request body sent by the client, and RequestBody is the one patched by the pre
+	// hooks. They are only set for post hooks
+	OriginalRequestBody []byte
+	RequestBody         []byte
+
+	// exchange is shared by the pre and post hooks of the request
+	exchange *hookExchange
+}
+
+// hookExchange keeps what the pre hooks of a request hand to its post hooks
+type hookExchange struct {
+	lock         sync.Mutex
+	originalBody []byte
+	body         []byte
+	// states are the states attached by the pre hooks, keyed by the webhook name
+	states map[string][]byte
+	// query and header are the ones of the request sent to the backend, they are rewritten by the pre hooks
+	query     url.Values
+	header    http.Header
+	rewritten bool
+}
+
+func newHookExchange() *hookExchange {
+	return &hookExchange{states: make(map[string][]byte)}
+}
+
+func (e *hookExchange) setBodies(originalBody, body []byte) {
+	if e == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.originalBody, e.body = originalBody, body
+}
+
+func (e *hookExchange) bodies() ([]byte, []byte) {
+	if e == nil {
+		return nil, nil
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.originalBody, e.body
+}
+
+func (e *hookExchange) setState(hook string, state []byte) {
+	if e == nil || state == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.states[hook] = state
+}
+
+func (e *hookExchange) state(hook string) []byte {
+	if e == nil {
+		return nil
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.states[hook]
+}
+
+func (e *hookExchange) setRequest(query url.Values, header http.Header) {
+	if e == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.query, e.header = query, header
+}
+
+// rewrite replaces the query if query is not nil, and sets the headers of header, a header without values is deleted
+func (e *hookExchange) rewrite(query url.Values, header http.Header) {
+	if e == nil || (query == nil && header == nil) {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.rewritten = true
+	if query != nil {
+		e.query = cloneValues(query)
+	}
+	if header != nil && e.header == nil {
+		e.header = make(http.Header)
+	}
+	for k, vs := range header {
+		if len(vs) == 0 {
+			e.header.Del(k)
+			continue
+		}
+		e.header[http.CanonicalHeaderKey(k)] = append([]string(nil), vs...)
+	}
+}
+
+// request returns copies of the query and the headers, and whether they are rewritten
+func (e *hookExchange) request() (url.Values, http.Header, bool) {
+	if e == nil {
+		return nil, nil, false
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return cloneValues(e.query), e.header.Clone(), e.rewritten
+}
+
+func cloneValues(values url.Values) url.Values {
+	if values == nil {
+		return nil
+	}
+	return url.Values(http.Header(values).Clone())
+}
+
+// Query returns a copy of the query of the request rewritten by the earlier pre hooks, it's only set for the hooks
+// running in-process
+func (info *RequestInfo) Query() url.Values {
+	query, _, _ := info.exchange.request()
+	return query
+}
+
+// Header returns a copy of the headers of the request rewritten by the earlier pre hooks, it's only set for the hooks
+// running in-process
+func (info *RequestInfo) Header() http.Header {
+	_, header, _ := info.exchange.request()
+	return header
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns a copy of ctx carrying info
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the RequestInfo carried by ctx, an empty RequestInfo is returned if there is none
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo); ok && info != nil {
+		return info
+	}
+	return &RequestInfo{}
+}
@@ -0,0 +1,285 @@
+package hook
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+// hookRouter builds the hook chains of a request from all the stages matching it
+type hookRouter struct {
+	routes     []*hookRoute
+	serveHooks func(w http.ResponseWriter, r *http.Request, chain *hookChain)
+	backend    http.Handler
+	readOnly   bool
+	translator *apiTranslator
+	inventory  *inventory
+}
+
+// routeHolder serves the requests with the latest router, so the hooks can be registered while serving
+type routeHolder struct {
+	router atomic.Value
+}
+
+func (rh *routeHolder) store(router *hookRouter) {
+	rh.router.Store(router)
+}
+
+func (rh *routeHolder) load() *hookRouter {
+	return rh.router.Load().(*hookRouter)
+}
+
+func (rh *routeHolder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rh.load().ServeHTTP(w, req)
+}
+
+// hookChain is the hooks applied to a request
+type hookChain struct {
+	preHooks  []*hookHandle
+	postHooks []*hookHandle
+	// preConflictPolicy and postConflictPolicy are the strictest policies of the matched stages
+	preConflictPolicy  componentconfig.ConflictPolicyType
+	postConflictPolicy componentconfig.ConflictPolicyType
+	// translation converts the bodies between the client, the hooks and the backend, it's nil if not needed
+	translation *apiTranslation
+	// maxRequestBodySize and maxResponseBodySize are the smallest limits of the matched stages, 0 is unlimited
+	maxRequestBodySize  int64
+	maxResponseBodySize int64
+}
+
+func (c *hookChain) empty() bool {
+	return len(c.preHooks)+len(c.postHooks) == 0
+}
+
+type hookRoute struct {
+	route          *mux.Route
+	hookType       componentconfig.HookType
+	hook           *hookHandle
+	minAPIVersion  string
+	maxAPIVersion  string
+	conflictPolicy componentconfig.ConflictPolicyType
+
+	maxRequestBodySize  int64
+	maxResponseBodySize int64
+}
+
+func (hr *hookRouter) addRoute(stage componentconfig.HookStage, hook *hookHandle) error {
+	if stage.Type != componentconfig.PreHookType && stage.Type != componentconfig.PostHookType {
+		return fmt.Errorf("unknown hook type %s", stage.Type)
+	}
+
+	if !validConflictPolicy(stage.ConflictPolicy) {
+		return fmt.Errorf("unknown conflict policy %s", stage.ConflictPolicy)
+	}
+
+	for _, v := range []string{stage.MinAPIVersion, stage.MaxAPIVersion} {
+		if len(v) == 0 {
+			continue
+		}
+		if _, _, err := parseAPIVersion(v); err != nil {
+			return err
+		}
+	}
+
+	if stage.MaxRequestBodySize < 0 || stage.MaxResponseBodySize < 0 {
+		return fmt.Errorf("negative body size limit")
+	}
+
+	route := mux.NewRouter().Methods(stage.Method).Path(stage.URLPattern)
+	if err := route.GetError(); err != nil {
+		return err
+	}
+
+	hr.routes = append(hr.routes, &hookRoute{
+		route:          route,
+		hookType:       stage.Type,
+		hook:           hook,
+		minAPIVersion:  stage.MinAPIVersion,
+		maxAPIVersion:  stage.MaxAPIVersion,
+		conflictPolicy: stage.ConflictPolicy,
+
+		maxRequestBodySize:  stage.MaxRequestBodySize,
+		maxResponseBodySize: stage.MaxResponseBodySize,
+	})
+
+	return nil
+}
+
+// acceptAPIVersion checks the API version of the request against the constraints of the stage. The request without
+// version is always accepted, since it's the latest version of the backend
+func (r *hookRoute) acceptAPIVersion(apiVersion string) bool {
+	if len(apiVersion) == 0 {
+		return true
+	}
+
+	if len(r.minAPIVersion) > 0 && compareAPIVersion(apiVersion, r.minAPIVersion) < 0 {
+		return false
+	}
+
+	if len(r.maxAPIVersion) > 0 && compareAPIVersion(apiVersion, r.maxAPIVersion) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// match returns the hooks of all matched stages ordered by priority, a hook is included at most once for each hook
+// type. A versioned request matches the pattern of either the versioned path or the path without version prefix
+func (hr *hookRouter) match(req *http.Request, apiVersion, unversionedPath string) *hookChain {
+	chain := &hookChain{}
+
+	unversioned := req
+	if len(apiVersion) > 0 {
+		u := *req.URL
+		u.Path, u.RawPath = unversionedPath, ""
+		unversioned = new(http.Request)
+		*unversioned = *req
+		unversioned.URL = &u
+	}
+
+	contains := func(hooks []*hookHandle, h *hookHandle) bool {
+		for _, e := range hooks {
+			if e == h {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range hr.routes {
+		if !r.acceptAPIVersion(apiVersion) {
+			continue
+		}
+
+		if !r.route.Match(req, &mux.RouteMatch{}) && (unversioned == req ||
+			!r.route.Match(unversioned, &mux.RouteMatch{})) {
+			continue
+		}
+
+		switch r.hookType {
+		case componentconfig.PreHookType:
+			if !contains(chain.preHooks, r.hook) {
+				chain.preHooks = append(chain.preHooks, r.hook)
+			}
+			chain.preConflictPolicy = stricterConflictPolicy(chain.preConflictPolicy, r.conflictPolicy)
+		case componentconfig.PostHookType:
+			if !contains(chain.postHooks, r.hook) {
+				chain.postHooks = append(chain.postHooks, r.hook)
+			}
+			chain.postConflictPolicy = stricterConflictPolicy(chain.postConflictPolicy, r.conflictPolicy)
+		}
+		chain.maxRequestBodySize = minBodyLimit(chain.maxRequestBodySize, r.maxRequestBodySize)
+		chain.maxResponseBodySize = minBodyLimit(chain.maxResponseBodySize, r.maxResponseBodySize)
+	}
+
+	sortHooks(chain.preHooks)
+	sortHooks(chain.postHooks)
+
+	return chain
+}
+
+// sortHooks orders the hooks with a higher priority first, and keeps the order of configuration for the same priority
+func sortHooks(hooks []*hookHandle) {
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].priority > hooks[j].priority
+	})
+}
+
+func (hr *hookRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if hr.readOnly && !isReadOnlyRequest(req.Method, req.URL.Path) {
+		klog.V(4).Infof("Reject request %s %s on read-only listener", req.Method, req.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(fmt.Sprintf("%s %s is not allowed on a read-only listener", req.Method, req.URL.Path)))
+		return
+	}
+
+	hookReq, chain := hr.resolve(req)
+	if !chain.empty() {
+		// the body is checked before the hooks buffer it
+		within, err := limitRequestBody(req, chain.maxRequestBodySize)
+		if err != nil {
+			klog.Errorf("can't read request body: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hookReq.Body = req.Body
+
+		if within {
+			klog.V(5).Infof("Handle request %s %s", req.Method, req.URL.Path)
+			hr.serveHooks(w, hookReq, chain)
+			return
+		}
+
+		if !canBypass(chain.translation, chain.preHooks, chain.postHooks) {
+			klog.Warningf("Reject request %s %s, body is larger than %d bytes", req.Method, req.URL.Path,
+				chain.maxRequestBodySize)
+			bodyTooLarge(w, "request", chain.maxRequestBodySize)
+			return
+		}
+		klog.Warningf("Bypass hooks of request %s %s, body is larger than %d bytes", req.Method, req.URL.Path,
+			chain.maxRequestBodySize)
+	}
+
+	klog.V(5).Infof("Unhandled request %s %s", req.Method, req.URL.Path)
+	hr.backend.ServeHTTP(w, req)
+}
+
+// resolve returns the hook chain of the request, and the request passed to the hooks which carries the RequestInfo
+func (hr *hookRouter) resolve(req *http.Request) (*http.Request, *hookChain) {
+	apiVersion, unversionedPath := splitVersionedPath(req.URL.Path)
+	info := &RequestInfo{
+		APIVersion:       apiVersion,
+		ClientAPIVersion: apiVersion,
+		UID:              uuid.New().String(),
+		exchange:         newHookExchange(),
+	}
+
+	// hooks of a translated request are matched with the canonical version
+	hookReq := req
+	translation := hr.translator.translate(req.Context(), req.Method, apiVersion, unversionedPath)
+	if translation != nil {
+		info.APIVersion = translation.canonicalVersion
+		u := *req.URL
+		u.Path, u.RawPath = fmt.Sprintf("/v%s%s", translation.canonicalVersion, unversionedPath), ""
+		hookReq = new(http.Request)
+		*hookReq = *req
+		hookReq.URL = &u
+	}
+
+	chain := hr.match(hookReq, info.APIVersion, unversionedPath)
+	chain.translation = translation
+
+	ctx := WithRequestInfo(req.Context(), info)
+	if hr.inventory != nil {
+		info.Container = hr.inventory.lookupPath(unversionedPath)
+		// the patches of the pre hooks are recorded to the inventory from the decisions of the create request
+		if req.Method == http.MethodPost && unversionedPath == "/containers/create" && decisionLogFrom(ctx) == nil {
+			ctx = withDecisionLog(ctx, &decisionLog{})
+		}
+	}
+	return hookReq.WithContext(ctx), chain
+}
+
+// readOnlyPathRegexp matches the unversioned paths which only read the state of the daemon by GET or HEAD. The ones
+// which stream out the filesystem of a container or an image, or attach to a container, are not matched
+var readOnlyPathRegexp = regexp.MustCompile(`^/(_ping|version|info|events|system/df|swarm|` +
+	`containers/json|containers/[^/]+/(json|top|logs|changes|stats)|` +
+	`images/json|images/search|images/.+/(json|history)|exec/[^/]+/json|distribution/.+/json|` +
+	`(networks|volumes|nodes|services|tasks|secrets|configs|plugins)(/[^/]+)?|` +
+	`(services|tasks)/[^/]+/logs|plugins/.+/json)$`)
+
+// isReadOnlyRequest returns whether the request is allowed on a read-only listener
+func isReadOnlyRequest(method, path string) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	return readOnlyPathRegexp.MatchString(UnversionedPath(path))
+}
@@ -0,0 +1,81 @@
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestHookRouterMatch(t *testing.T) {
+	hooks := []*hookHandle{
+		{name: "low", priority: -1, HookHandler: &fakeHookHandler{}},
+		{name: "first", HookHandler: &fakeHookHandler{}},
+		{name: "second", HookHandler: &fakeHookHandler{}},
+		{name: "high", priority: 10, HookHandler: &fakeHookHandler{}},
+	}
+
+	stages := []struct {
+		hook  int
+		stage componentconfig.HookStage
+	}{
+		{0, componentconfig.HookStage{Method: "post", URLPattern: "/containers/create", Type: componentconfig.PreHookType}},
+		{1, componentconfig.HookStage{Method: "post", URLPattern: "/{version:v[.0-9]+}/containers/create",
+			Type: componentconfig.PreHookType}},
+		{1, componentconfig.HookStage{Method: "post", URLPattern: "/{version:v[.0-9]+}/containers/{action}",
+			Type: componentconfig.PreHookType}},
+		{2, componentconfig.HookStage{Method: "post", URLPattern: "/containers/create",
+			Type: componentconfig.PostHookType, MinAPIVersion: "1.41"}},
+		{3, componentconfig.HookStage{Method: "post", URLPattern: "/{version:v[.0-9]+}/containers/{action}",
+			Type: componentconfig.PreHookType}},
+		{3, componentconfig.HookStage{Method: "get", URLPattern: "/{version:v[.0-9]+}/containers/create",
+			Type: componentconfig.PreHookType}},
+	}
+
+	hr := &hookRouter{}
+	for _, s := range stages {
+		if err := hr.addRoute(s.stage, hooks[s.hook]); err != nil {
+			t.Fatalf("can't add route %+v: %v", s.stage, err)
+		}
+	}
+
+	for _, stage := range []componentconfig.HookStage{
+		{Method: "post", URLPattern: "/{id", Type: componentconfig.PreHookType},
+		{Method: "post", URLPattern: "/containers/create", Type: componentconfig.PreHookType, MaxAPIVersion: "latest"},
+	} {
+		if err := hr.addRoute(stage, hooks[0]); err == nil {
+			t.Errorf("expect invalid stage %+v to be rejected", stage)
+		}
+	}
+
+	names := func(hooks []*hookHandle) []string {
+		ret := make([]string, 0, len(hooks))
+		for _, h := range hooks {
+			ret = append(ret, h.name)
+		}
+		return ret
+	}
+
+	for _, u := range []struct {
+		path      string
+		preHooks  []string
+		postHooks []string
+	}{
+		{"/v1.40/containers/create", []string{"high", "first", "low"}, []string{}},
+		{"/v1.41/containers/create", []string{"high", "first", "low"}, []string{"second"}},
+		{"/containers/create", []string{"low"}, []string{"second"}},
+		{"/v1.40/containers/start", []string{"high", "first"}, []string{}},
+		{"/v1.40/images/create", []string{}, []string{}},
+	} {
+		apiVersion, unversionedPath := splitVersionedPath(u.path)
+		chain := hr.match(httptest.NewRequest(http.MethodPost, u.path, nil), apiVersion, unversionedPath)
+		if !reflect.DeepEqual(names(chain.preHooks), u.preHooks) {
+			t.Errorf("expect preHooks %v of %s to be %v", names(chain.preHooks), u.path, u.preHooks)
+		}
+		if !reflect.DeepEqual(names(chain.postHooks), u.postHooks) {
+			t.Errorf("expect postHooks %v of %s to be %v", names(chain.postHooks), u.path, u.postHooks)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package hook
+
+import (
+	"bytes"
+	gjson "encoding/json"
+	"sort"
+	"strings"
+)
+
+// Types of the containers created by kubelet through dockershim
+const (
+	ContainerTypeSandbox   = "podsandbox"
+	ContainerTypeContainer = "container"
+)
+
+const (
+	labelContainerType = "io.kubernetes.docker.type"
+	labelSandboxID     = "io.kubernetes.sandbox.id"
+	// containerModePrefix is the prefix of the namespace modes joining another container
+	containerModePrefix = "container:"
+)
+
+var (
+	// podFields are the fields of a create body which belong to the namespaces of the pod sandbox, the app
+	// containers join them so they can't set them
+	podFields = map[string]bool{
+		"Hostname":         true,
+		"Domainname":       true,
+		"ExposedPorts":     true,
+		"MacAddress":       true,
+		"NetworkingConfig": true,
+	}
+	podHostConfigFields = map[string]bool{
+		"Sysctls":         true,
+		"Dns":             true,
+		"DnsOptions":      true,
+		"DnsSearch":       true,
+		"ExtraHosts":      true,
+		"PortBindings":    true,
+		"PublishAllPorts": true,
+		"ShmSize":         true,
+		"NetworkMode":     true,
+		"IpcMode":         true,
+		"PidMode":         true,
+		"UTSMode":         true,
+	}
+	// sharedFields are applied to both the sandbox and the app containers
+	sharedFields = map[string]bool{
+		"Labels": true,
+	}
+)
+
+// createConfig is the part of a create body telling the type of the container and its sandbox
+type createConfig struct {
+	Labels     map[string]string `json:"Labels"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	} `json:"HostConfig"`
+}
+
+// classifyCreate returns the type of the container created by kubelet and the sandbox of an app container, they are
+// empty for the containers not created by kubelet
+func classifyCreate(body []byte) (string, string) {
+	config := createConfig{}
+	if err := gjson.Unmarshal(body, &config); err != nil {
+		return "", ""
+	}
+	return classifyContainer(config.Labels, config.HostConfig.NetworkMode)
+}
+
+func classifyContainer(labels map[string]string, networkMode string) (string, string) {
+	switch labels[labelContainerType] {
+	case ContainerTypeSandbox:
+		return ContainerTypeSandbox, ""
+	case ContainerTypeContainer:
+		sandbox := labels[labelSandboxID]
+		if len(sandbox) == 0 && strings.HasPrefix(networkMode, containerModePrefix) {
+			sandbox = strings.TrimPrefix(networkMode, containerModePrefix)
+		}
+		return ContainerTypeContainer, sandbox
+	}
+	return "", ""
+}
+
+// describeCreate sets the type of the container created by the request, and the sandbox of an app container which is
+// looked up in the inventory. Only the ID of the sandbox is known if it's not in the inventory
+func (hm *Manager) describeCreate(info *RequestInfo, body []byte) {
+	containerType, sandbox := classifyCreate(body)
+	info.ContainerType = containerType
+	if len(sandbox) == 0 {
+		return
+	}
+
+	if info.Sandbox = hm.inventory.lookup(sandbox); info.Sandbox == nil {
+		info.Sandbox = &ContainerInfo{ID: sandbox, Type: ContainerTypeSandbox}
+	}
+}
+
+// routeSandboxFields reverts the fields of patched which don't belong to the type of the container, so a sandbox
+// aware hook applies the pod level fields only to the sandbox, and the others only to the app containers
+func routeSandboxFields(containerType string, original, patched []byte) ([]byte, []string, error) {
+	if len(containerType) == 0 {
+		return patched, nil, nil
+	}
+
+	var before, after map[string]interface{}
+	for _, v := range []struct {
+		data []byte
+		out  *map[string]interface{}
+	}{{original, &before}, {patched, &after}} {
+		decoder := gjson.NewDecoder(bytes.NewReader(v.data))
+		// numbers are kept as they are, e.g. the memory limits
+		decoder.UseNumber()
+		if err := decoder.Decode(v.out); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sandbox := containerType == ContainerTypeSandbox
+	var reverted []string
+	revert := func(dst, src map[string]interface{}, key, pointer string) {
+		v, found := src[key]
+		if jsonEqual(v, dst[key]) {
+			return
+		}
+		if found {
+			dst[key] = v
+		} else {
+			delete(dst, key)
+		}
+		reverted = append(reverted, pointer)
+	}
+
+	beforeHost, _ := before["HostConfig"].(map[string]interface{})
+	afterHost, _ := after["HostConfig"].(map[string]interface{})
+	for _, key := range unionKeys(before, after) {
+		if key == "HostConfig" || sharedFields[key] || podFields[key] == sandbox {
+			continue
+		}
+		revert(after, before, key, "/"+key)
+	}
+	if afterHost != nil {
+		for _, key := range unionKeys(beforeHost, afterHost) {
+			if podHostConfigFields[key] != sandbox {
+				revert(afterHost, beforeHost, key, "/HostConfig/"+key)
+			}
+		}
+	}
+
+	if len(reverted) == 0 {
+		return patched, nil, nil
+	}
+
+	routed, err := encodeJSON(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	return routed, reverted, nil
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, found := a[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ja, errA := encodeJSON(a)
+	jb, errB := encodeJSON(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
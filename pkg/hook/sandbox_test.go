@@ -0,0 +1,163 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/test"
+)
+
+type sandboxHook struct {
+	infos chan RequestInfo
+}
+
+func (h *sandboxHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	h.infos <- *RequestInfoFrom(ctx)
+	patch.PatchType = string(types.StrategicMergePatchType)
+	patch.PatchData = []byte(`{"Env":["ZONE=a"],"Labels":{"lighthouse":"true"},` +
+		`"HostConfig":{"Sysctls":{"net.core.somaxconn":"1024"},"Dns":["10.0.0.10"],"NetworkMode":"host"}}`)
+	return nil
+}
+
+func (h *sandboxHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return nil
+}
+
+func TestSandboxAwareHook(t *testing.T) {
+	fakeDocker := test.NewFakeDocker()
+	hm := NewManager(WithBackend(fakeDocker), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:   1,
+		Inventory: componentconfig.InventoryConfiguration{Enabled: true},
+	}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+
+	hook := &sandboxHook{infos: make(chan RequestInfo, 1)}
+	if err := hm.RegisterHook(HookRegistration{
+		Name:         "pod",
+		Handler:      hook,
+		SandboxAware: true,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	create := func(name, body string) test.FakeContainer {
+		ans := httptest.NewRecorder()
+		hm.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/v1.40/containers/create?name="+name,
+			strings.NewReader(body)))
+		if ans.Code != http.StatusCreated {
+			t.Fatalf("expect status code %d of %s to be 201, %s", ans.Code, name, ans.Body.String())
+		}
+		containers := fakeDocker.Containers()
+		return containers[len(containers)-1]
+	}
+
+	sandbox := create("k8s_POD_foo", `{"Image":"pause","Labels":{"io.kubernetes.docker.type":"podsandbox"}}`)
+	if info := <-hook.infos; info.ContainerType != ContainerTypeSandbox || info.Sandbox != nil {
+		t.Errorf("unexpected request info of sandbox %+v", info)
+	}
+	if _, found := sandbox.Config["Env"]; found {
+		t.Errorf("expect env not to be set on sandbox, got %v", sandbox.Config["Env"])
+	}
+	if sandbox.HostConfig["NetworkMode"] != "host" || sandbox.HostConfig["Sysctls"] == nil ||
+		sandbox.HostConfig["Dns"] == nil {
+		t.Errorf("expect pod level fields to be set on sandbox, got %v", sandbox.HostConfig)
+	}
+	if labels, _ := sandbox.Config["Labels"].(map[string]interface{}); labels["lighthouse"] != "true" {
+		t.Errorf("expect labels to be set on sandbox, got %v", sandbox.Config["Labels"])
+	}
+
+	// a sandbox has no sandbox, it must not be linked to another container
+	create("k8s_POD_bar", `{"Image":"pause","Labels":{"io.kubernetes.docker.type":"podsandbox"}}`)
+	<-hook.infos
+	if c := hm.inventory.lookup("k8s_POD_bar"); c == nil || c.Type != ContainerTypeSandbox || len(c.SandboxID) > 0 {
+		t.Errorf("expect second sandbox not to be linked to a sandbox in inventory, got %+v", c)
+	}
+
+	app := create("k8s_app_foo", `{"Image":"busybox","Env":["PATH=/bin"],"Labels":{"io.kubernetes.docker.type":`+
+		`"container"},"HostConfig":{"NetworkMode":"container:`+sandbox.ID[:12]+`","Memory":9007199254740993}}`)
+	info := <-hook.infos
+	if info.ContainerType != ContainerTypeContainer || info.Sandbox == nil || info.Sandbox.ID != sandbox.ID ||
+		info.Sandbox.Name != "k8s_POD_foo" || info.Sandbox.Type != ContainerTypeSandbox {
+		t.Errorf("unexpected request info of app container %+v, sandbox %+v", info, info.Sandbox)
+	}
+	if !reflect.DeepEqual(app.Config["Env"], []interface{}{"PATH=/bin", "ZONE=a"}) {
+		t.Errorf("expect env to be set on app container, got %v", app.Config["Env"])
+	}
+	if app.HostConfig["NetworkMode"] != "container:"+sandbox.ID[:12] || app.HostConfig["Sysctls"] != nil ||
+		app.HostConfig["Dns"] != nil {
+		t.Errorf("expect pod level fields not to be set on app container, got %v", app.HostConfig)
+	}
+
+	c := hm.inventory.lookup("k8s_app_foo")
+	if c == nil || c.Type != ContainerTypeContainer || c.SandboxID != sandbox.ID {
+		t.Errorf("expect app container to be linked to its sandbox in inventory, got %+v", c)
+	}
+}
+
+func TestRouteSandboxFields(t *testing.T) {
+	original := []byte(`{"Image":"busybox","HostConfig":{"Memory":9007199254740993}}`)
+	patched := []byte(`{"Image":"busybox","Env":["A=b"],"HostConfig":{"Memory":9007199254740993,"Dns":["1.1.1.1"]}}`)
+
+	for _, c := range []struct {
+		containerType string
+		expected      string
+		skipped       []string
+	}{
+		{containerType: "", expected: string(patched)},
+		{
+			containerType: ContainerTypeContainer,
+			expected:      `{"Env":["A=b"],"HostConfig":{"Memory":9007199254740993},"Image":"busybox"}`,
+			skipped:       []string{"/HostConfig/Dns"},
+		},
+		{
+			containerType: ContainerTypeSandbox,
+			expected:      `{"HostConfig":{"Dns":["1.1.1.1"],"Memory":9007199254740993},"Image":"busybox"}`,
+			skipped:       []string{"/Env"},
+		},
+	} {
+		routed, skipped, err := routeSandboxFields(c.containerType, original, patched)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.containerType, err)
+			continue
+		}
+		if string(routed) != c.expected {
+			t.Errorf("%q: expect %s to be %s", c.containerType, routed, c.expected)
+		}
+		if !reflect.DeepEqual(skipped, c.skipped) {
+			t.Errorf("%q: expect skipped %v to be %v", c.containerType, skipped, c.skipped)
+		}
+	}
+
+	if _, _, err := routeSandboxFields(ContainerTypeSandbox, original, []byte(`[]`)); err == nil {
+		t.Errorf("expect an error of a body which is not an object")
+	}
+}
+
+func TestClassifyCreate(t *testing.T) {
+	for body, expected := range map[string][2]string{
+		`{"Labels":{"io.kubernetes.docker.type":"podsandbox"}}`: {ContainerTypeSandbox, ""},
+		`{"Labels":{"io.kubernetes.docker.type":"container","io.kubernetes.sandbox.id":"abc"},` +
+			`"HostConfig":{"NetworkMode":"container:def"}}`: {ContainerTypeContainer, "abc"},
+		`{"Labels":{"io.kubernetes.docker.type":"container"},"HostConfig":{"NetworkMode":"container:def"}}`: {
+			ContainerTypeContainer, "def"},
+		`{"Labels":{"app":"foo"}}`: {"", ""},
+		`not json`:                 {"", ""},
+	} {
+		containerType, sandbox := classifyCreate([]byte(body))
+		if [2]string{containerType, sandbox} != expected {
+			t.Errorf("%s: expect %s %s to be %v", body, containerType, sandbox, expected)
+		}
+	}
+}
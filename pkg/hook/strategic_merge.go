@@ -0,0 +1,288 @@
+package hook
+
+import (
+	"bytes"
+	gjson "encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// patchDirective is the key of the directive in an object of a strategic merge patch
+	patchDirective = "$patch"
+	// patchDirectiveKey is the merge key of the list item deleted by a directive
+	patchDirectiveKey = "$key"
+
+	patchDirectiveReplace = "replace"
+	patchDirectiveDelete  = "delete"
+)
+
+// mergeKeyFunc returns the merge key of a list item
+type mergeKeyFunc func(item interface{}) (string, bool)
+
+// dockerMergeKeys are the merge keys of the lists in the Docker create and inspect payloads, lists not listed here are
+// replaced as a whole
+var dockerMergeKeys = map[string]mergeKeyFunc{
+	"/Env":                envName,
+	"/Config/Env":         envName,
+	"/HostConfig/Binds":   bindDestination,
+	"/HostConfig/Mounts":  fieldMergeKey("Target"),
+	"/HostConfig/Devices": fieldMergeKey("PathInContainer"),
+	"/HostConfig/Ulimits": fieldMergeKey("Name"),
+}
+
+// topLevelMergeKey is the merge key of the list responses, e.g. /containers/json, /images/json and /networks
+var topLevelMergeKey = fieldMergeKey("Id")
+
+// envName returns the name of "NAME=value"
+func envName(item interface{}) (string, bool) {
+	s, ok := item.(string)
+	if !ok {
+		return "", false
+	}
+	return strings.SplitN(s, "=", 2)[0], true
+}
+
+// bindDestination returns the destination of "source:destination[:options]"
+func bindDestination(item interface{}) (string, bool) {
+	s, ok := item.(string)
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 {
+		return s, true
+	}
+	return fields[1], true
+}
+
+func fieldMergeKey(field string) mergeKeyFunc {
+	return func(item interface{}) (string, bool) {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		key, ok := obj[field].(string)
+		return key, ok
+	}
+}
+
+// strategicMergePatch merges patch into original like a JSON merge patch, except the lists with merge keys whose
+// items are merged by their keys. The directive {"$patch": "replace"} replaces an object or a list, and
+// {"$patch": "delete"} deletes an object, or a list item together with its merge key, e.g.
+// {"$patch": "delete", "$key": "FOO"} deletes FOO from Env. A top level list, e.g. the response of /containers/json,
+// is patched by a list whose items are merged by Id
+func strategicMergePatch(original, patch []byte) ([]byte, error) {
+	src, err := decodeValue(original)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode original, %v", err)
+	}
+
+	p, err := decodeValue(patch)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode strategic merge patch, %v", err)
+	}
+
+	var merged interface{}
+	switch v := src.(type) {
+	case map[string]interface{}:
+		obj, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("strategic merge patch of an object must be an object")
+		}
+		merged, err = mergeObject(v, obj, "")
+	case []interface{}:
+		list, ok := p.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("strategic merge patch of a list must be a list")
+		}
+		merged, err = mergeList(v, list, "", topLevelMergeKey)
+	default:
+		return nil, fmt.Errorf("strategic merge patch only applies to an object or a list")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeJSON(merged)
+}
+
+// decodeValue decodes an object or a list, an empty body is an empty object
+func decodeValue(data []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return make(map[string]interface{}), nil
+	}
+
+	var v interface{}
+	decoder := gjson.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func mergeObject(original, patch map[string]interface{}, path string) (map[string]interface{}, error) {
+	directive, err := takeDirective(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	switch directive {
+	case "":
+	case patchDirectiveReplace:
+		// directives in the children are still applied
+		original = nil
+	default:
+		return nil, fmt.Errorf("unexpected directive %s of object %s", directive, path)
+	}
+
+	if original == nil {
+		original = make(map[string]interface{})
+	}
+
+	for k, pv := range patch {
+		childPath := path + "/" + escapePointer(k)
+
+		if pv == nil {
+			delete(original, k)
+			continue
+		}
+
+		switch v := pv.(type) {
+		case map[string]interface{}:
+			if d, _ := v[patchDirective].(string); d == patchDirectiveDelete {
+				delete(original, k)
+				continue
+			}
+
+			ov, _ := original[k].(map[string]interface{})
+			merged, err := mergeObject(ov, v, childPath)
+			if err != nil {
+				return nil, err
+			}
+			original[k] = merged
+		case []interface{}:
+			mergeKey, found := dockerMergeKeys[childPath]
+			if !found {
+				original[k] = v
+				continue
+			}
+
+			ov, _ := original[k].([]interface{})
+			merged, err := mergeList(ov, v, childPath, mergeKey)
+			if err != nil {
+				return nil, err
+			}
+			original[k] = merged
+		default:
+			original[k] = v
+		}
+	}
+
+	return original, nil
+}
+
+func mergeList(original, patch []interface{}, path string, mergeKey mergeKeyFunc) ([]interface{}, error) {
+	merged := make([]interface{}, 0, len(original)+len(patch))
+
+	items := make([]interface{}, 0, len(patch))
+	for _, item := range patch {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			items = append(items, item)
+			continue
+		}
+
+		if d, _ := obj[patchDirective].(string); d == patchDirectiveReplace {
+			original = nil
+			continue
+		}
+		items = append(items, item)
+	}
+	merged = append(merged, original...)
+
+	index := make(map[string]int)
+	for i, item := range merged {
+		if key, ok := mergeKey(item); ok {
+			index[key] = i
+		}
+	}
+
+	deleted := make(map[int]bool)
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			if d, _ := obj[patchDirective].(string); d == patchDirectiveDelete {
+				key, ok := obj[patchDirectiveKey].(string)
+				if !ok {
+					key, ok = mergeKey(obj)
+				}
+				if !ok {
+					return nil, fmt.Errorf("delete directive without merge key in list %s", path)
+				}
+
+				if i, found := index[key]; found {
+					deleted[i] = true
+					delete(index, key)
+				}
+				continue
+			}
+		}
+
+		key, ok := mergeKey(item)
+		if !ok {
+			return nil, fmt.Errorf("item %v of list %s has no merge key", item, path)
+		}
+
+		i, found := index[key]
+		if !found {
+			index[key] = len(merged)
+			merged = append(merged, item)
+			continue
+		}
+
+		pv, isObject := item.(map[string]interface{})
+		ov, wasObject := merged[i].(map[string]interface{})
+		if !isObject || !wasObject {
+			merged[i] = item
+			continue
+		}
+
+		m, err := mergeObject(ov, pv, path)
+		if err != nil {
+			return nil, err
+		}
+		merged[i] = m
+	}
+
+	ret := make([]interface{}, 0, len(merged))
+	for i, item := range merged {
+		if !deleted[i] {
+			ret = append(ret, item)
+		}
+	}
+
+	return ret, nil
+}
+
+// takeDirective removes the directive from the object and returns it
+func takeDirective(obj map[string]interface{}) (string, error) {
+	v, found := obj[patchDirective]
+	if !found {
+		return "", nil
+	}
+	delete(obj, patchDirective)
+
+	directive, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid directive %v", v)
+	}
+	return directive, nil
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,125 @@
+package hook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestStrategicMergePatch(t *testing.T) {
+	original := `{"Env":["A=1","B=2"],"Image":"busybox","HostConfig":{"Binds":["/data:/data:ro"],` +
+		`"Mounts":[{"Type":"bind","Source":"/a","Target":"/a"}],"Ulimits":[{"Name":"nofile","Soft":1024,"Hard":1024}],` +
+		`"Dns":["8.8.8.8"]}}`
+
+	for _, u := range []struct {
+		name     string
+		original string
+		patch    string
+		expected string
+	}{
+		{
+			name:     "merge lists by keys",
+			original: original,
+			patch: `{"Env":["B=3","C=4"],"HostConfig":{"Binds":["/host:/data","/log:/log"],` +
+				`"Mounts":[{"Type":"volume","Source":"v","Target":"/b"}],"Ulimits":[{"Name":"nofile","Soft":2048}],` +
+				`"Dns":["1.1.1.1"]}}`,
+			expected: `{"Env":["A=1","B=3","C=4"],"HostConfig":{"Binds":["/host:/data","/log:/log"],"Dns":["1.1.1.1"],` +
+				`"Mounts":[{"Source":"/a","Target":"/a","Type":"bind"},{"Source":"v","Target":"/b","Type":"volume"}],` +
+				`"Ulimits":[{"Hard":1024,"Name":"nofile","Soft":2048}]},"Image":"busybox"}`,
+		},
+		{
+			name:     "directives",
+			original: original,
+			patch: `{"Env":[{"$patch":"delete","$key":"A"}],"Image":null,"HostConfig":{"$patch":"replace",` +
+				`"Mounts":[{"$patch":"replace"},{"Target":"/c"}]}}`,
+			expected: `{"Env":["B=2"],"HostConfig":{"Mounts":[{"Target":"/c"}]}}`,
+		},
+		{
+			name:     "delete by merge key",
+			original: original,
+			patch:    `{"HostConfig":{"Ulimits":[{"Name":"nofile","$patch":"delete"}],"Binds":[{"$patch":"delete"}]}}`,
+		},
+		{
+			name:     "merge list response by Id",
+			original: `[{"Id":"a","Labels":{"x":"1"}},{"Id":"b"},{"Id":"c"}]`,
+			patch:    `[{"Id":"a","Labels":{"y":"2"}},{"Id":"b","$patch":"delete"},{"Id":"d"}]`,
+			expected: `[{"Id":"a","Labels":{"x":"1","y":"2"}},{"Id":"c"},{"Id":"d"}]`,
+		},
+		{
+			name:     "replace list response",
+			original: `[{"Id":"a"},{"Id":"b"}]`,
+			patch:    `[{"$patch":"replace"},{"Id":"c"}]`,
+			expected: `[{"Id":"c"}]`,
+		},
+		{
+			name:     "object patch of list response",
+			original: `[{"Id":"a"}]`,
+			patch:    `{"Id":"b"}`,
+		},
+		{
+			name:     "list patch of object",
+			original: original,
+			patch:    `[{"Id":"b"}]`,
+		},
+	} {
+		merged, err := strategicMergePatch([]byte(u.original), []byte(u.patch))
+		if len(u.expected) == 0 {
+			if err == nil {
+				t.Errorf("%s: expect patch %s to fail, got %s", u.name, u.patch, string(merged))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: can't apply patch %s: %v", u.name, u.patch, err)
+			continue
+		}
+
+		if string(merged) != u.expected {
+			t.Errorf("%s: expect %s to be %s", u.name, string(merged), u.expected)
+		}
+	}
+}
+
+func TestHookManagerStrategicMergeList(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Id":"a","Labels":{"x":"1"}},{"Id":"b","Labels":{}}]`))
+	})
+
+	hm := NewManager(WithBackend(backend), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{Timeout: 1}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+	for _, name := range []string{"hide", "label"} {
+		patch := `[{"Id":"b","$patch":"delete"}]`
+		if name == "label" {
+			patch = `[{"Id":"a","Labels":{"y":"2"}}]`
+		}
+		if err := hm.RegisterHook(HookRegistration{
+			Name: name,
+			Handler: &fakeHookHandler{
+				postHook: func(p *PatchData, body []byte) error {
+					p.PatchType = string(types.StrategicMergePatchType)
+					p.PatchData = []byte(patch)
+					return nil
+				},
+			},
+			Stages: componentconfig.HookStageList{
+				{Method: http.MethodGet, URLPattern: "/containers/json", Type: componentconfig.PostHookType},
+			},
+		}); err != nil {
+			t.Fatalf("can't register hook: %v", err)
+		}
+	}
+
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, httptest.NewRequest(http.MethodGet, "/v1.40/containers/json", nil))
+	expected := `[{"Id":"a","Labels":{"x":"1","y":"2"}}]`
+	if ans.Code != http.StatusOK || ans.Body.String() != expected {
+		t.Errorf("expect response %d %s to be %s", ans.Code, ans.Body.String(), expected)
+	}
+}
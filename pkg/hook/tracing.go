@@ -0,0 +1,107 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/trace"
+)
+
+// newTracer returns the tracer of the exporter in the configuration, nil is returned if tracing is disabled
+func newTracer(config *componentconfig.TracingConfiguration) (*trace.Tracer, error) {
+	var exporter trace.Exporter
+	switch config.Exporter {
+	case componentconfig.TracingExporterNone:
+		return nil, nil
+	case componentconfig.TracingExporterStdout:
+		exporter = trace.NewWriterExporter(config.ServiceName, os.Stdout)
+	case componentconfig.TracingExporterFile:
+		if len(config.Path) == 0 {
+			return nil, fmt.Errorf("path of file exporter is empty")
+		}
+		e, err := trace.NewFileExporter(config.ServiceName, config.Path)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case componentconfig.TracingExporterOTLP:
+		e, err := trace.NewOTLPExporter(config.ServiceName, config.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("unknown exporter %s", config.Exporter)
+	}
+
+	return trace.NewTracer(exporter), nil
+}
+
+// traceRequests starts the span of each request from the traceparent of the client, and writes the audit log of the
+// request with its trace ID
+func (hm *Manager) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := hm.tracer.Extract(r.Context(), r.Header)
+		ctx, span := hm.tracer.Start(ctx, "HTTP "+r.Method, trace.SpanKindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+
+		cw := &capturingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(cw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", strconv.Itoa(cw.statusCode))
+		if cw.statusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("status code is %d", cw.statusCode))
+		}
+		span.Finish()
+
+		traceID := "-"
+		if sc := trace.SpanContextFrom(ctx); sc.IsValid() {
+			traceID = sc.TraceID.String()
+		}
+		klog.V(2).Infof("Audit %s %s, status code %d, duration %s, trace %s", r.Method, r.URL.Path, cw.statusCode,
+			time.Since(start), traceID)
+	})
+}
+
+// traceBackend starts the span of the round trip to the backend, and propagates the trace context to the backend
+func (hm *Manager) traceBackend(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hm.tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, span := hm.tracer.Start(r.Context(), "backend "+r.Method, trace.SpanKindClient)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		defer span.Finish()
+
+		r = r.Clone(ctx)
+		trace.Inject(ctx, r.Header)
+
+		cw := &capturingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		span.SetAttribute("http.status_code", strconv.Itoa(cw.statusCode))
+		if cw.statusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("status code is %d", cw.statusCode))
+		}
+	})
+}
+
+// startHookSpan starts the span of a hook call, the hook servers get the trace context of it
+func (hm *Manager) startHookSpan(ctx context.Context, h *hookHandle,
+	hookType componentconfig.HookType) (context.Context, *trace.Span) {
+	ctx, span := hm.tracer.Start(ctx, fmt.Sprintf("%s %s", hookType, h.name), trace.SpanKindClient)
+	span.SetAttribute("hook.name", h.name)
+	span.SetAttribute("hook.type", string(hookType))
+	return ctx, span
+}
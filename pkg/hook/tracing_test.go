@@ -0,0 +1,94 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+	"github.com/mYmNeo/lighthouse/pkg/trace"
+)
+
+type fakeExporter struct {
+	lock  sync.Mutex
+	spans []*trace.Span
+}
+
+func (e *fakeExporter) Export(span *trace.Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *fakeExporter) Close() error {
+	return nil
+}
+
+type traceHook struct {
+	parent trace.SpanContext
+}
+
+func (h *traceHook) PreHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	h.parent = trace.SpanContextFrom(ctx)
+	return nil
+}
+
+func (h *traceHook) PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error {
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	var backendParent string
+	exporter := &fakeExporter{}
+	hm := NewManager(WithBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendParent = r.Header.Get(trace.HeaderTraceParent)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})), WithTracer(trace.NewTracer(exporter)), WithSystemd(false))
+
+	hook := &traceHook{}
+	if err := hm.RegisterHook(HookRegistration{
+		Name:    "trace",
+		Handler: hook,
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	clientParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(`{}`))
+	req.Header.Set(trace.HeaderTraceParent, clientParent)
+	ans := httptest.NewRecorder()
+	hm.ServeHTTP(ans, req)
+	if ans.Code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be %d", ans.Code, http.StatusCreated)
+	}
+
+	spans := make(map[string]*trace.Span)
+	for _, s := range exporter.spans {
+		if s.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expect span %s to be in the trace of the client", s.Name)
+		}
+		spans[s.Name] = s
+	}
+
+	request, hookSpan, backend := spans["HTTP POST"], spans["PreHook trace"], spans["backend POST"]
+	if len(spans) != 3 || request == nil || hookSpan == nil || backend == nil {
+		t.Fatalf("unexpected spans %+v", spans)
+	}
+	if request.ParentSpanID.String() != "00f067aa0ba902b7" || request.Attributes()["http.status_code"] != "201" {
+		t.Errorf("unexpected request span %+v", request)
+	}
+	if hookSpan.ParentSpanID != request.SpanContext.SpanID || hook.parent != hookSpan.SpanContext {
+		t.Errorf("expect hook to get the span context of its span")
+	}
+	if backend.ParentSpanID != request.SpanContext.SpanID || backendParent != backend.SpanContext.TraceParent() {
+		t.Errorf("expect backend to get the traceparent %s of its span, got %s", backend.SpanContext.TraceParent(),
+			backendParent)
+	}
+}
@@ -0,0 +1,444 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	gjson "encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// minVersionBackoff and maxVersionBackoff bound the time a failed query of the backend version is kept
+	minVersionBackoff = time.Second
+	maxVersionBackoff = time.Minute
+)
+
+// translationRule converts the body between the API version before rule.version and rule.version, upgrade and
+// downgrade return whether the body is changed
+type translationRule struct {
+	version   string
+	upgrade   func(obj map[string]interface{}) bool
+	downgrade func(obj map[string]interface{}) bool
+}
+
+// translationRoute has the rules of the request body and the response body, the body is kept as it is if there is
+// no rule
+type translationRoute struct {
+	method        string
+	pattern       *regexp.Regexp
+	requestRules  []translationRule
+	responseRules []translationRule
+}
+
+var (
+	createTranslationRules = []translationRule{
+		{version: "1.40", downgrade: downgradeDeviceRequests},
+		{version: "1.41", upgrade: upgradeCgroupnsMode, downgrade: downgradeCgroupnsMode},
+		{version: "1.44", upgrade: upgradeMacAddress, downgrade: downgradeMacAddress},
+	}
+
+	inspectTranslationRules = []translationRule{
+		{version: "1.40", downgrade: downgradeDeviceRequests},
+		{version: "1.41", downgrade: downgradeCgroupnsMode},
+	}
+
+	translationRoutes = []translationRoute{
+		// the response of a create is the ID and the warnings, which are the same in all the versions
+		{
+			method:       http.MethodPost,
+			pattern:      regexp.MustCompile(`^/containers/create$`),
+			requestRules: createTranslationRules,
+		},
+		{
+			method:        http.MethodGet,
+			pattern:       regexp.MustCompile(`^/containers/[^/]+/json$`),
+			responseRules: inspectTranslationRules,
+		},
+	}
+)
+
+// apiTranslator rewrites the bodies of create and inspect requests, so hooks always see the canonical API version
+// whichever versions the client and the backend use
+type apiTranslator struct {
+	canonicalVersion string
+	backend          http.Handler
+
+	lock           sync.Mutex
+	backendVersion string
+	// fetching is the running query of the backend version, the concurrent requests wait for it
+	fetching *versionCall
+	// lastErr is the error of the last query, it's returned until retryAt, which backs off on each failure
+	lastErr error
+	retryAt time.Time
+	backoff time.Duration
+}
+
+type versionCall struct {
+	done    chan struct{}
+	version string
+	err     error
+}
+
+// apiTranslation is the translation of a request
+type apiTranslation struct {
+	clientVersion    string
+	canonicalVersion string
+	backendVersion   string
+	backendPath      string
+	requestRules     []translationRule
+	responseRules    []translationRule
+}
+
+func newAPITranslator(canonicalVersion, backendVersion string, backend http.Handler) (*apiTranslator, error) {
+	for _, v := range []string{canonicalVersion, backendVersion} {
+		if len(v) == 0 {
+			continue
+		}
+		if _, _, err := parseAPIVersion(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return &apiTranslator{
+		canonicalVersion: canonicalVersion,
+		backendVersion:   backendVersion,
+		backend:          backend,
+	}, nil
+}
+
+// translate returns the translation of a versioned request, nil is returned if the request needn't translation
+func (t *apiTranslator) translate(ctx context.Context, method, clientVersion, unversionedPath string) *apiTranslation {
+	if t == nil || len(clientVersion) == 0 {
+		return nil
+	}
+
+	for _, r := range translationRoutes {
+		if r.method != method || !r.pattern.MatchString(unversionedPath) {
+			continue
+		}
+
+		backendVersion, err := t.getBackendVersion(ctx)
+		if err != nil {
+			klog.Errorf("can't get API version of backend, skip translation, %v", err)
+			return nil
+		}
+
+		if clientVersion == t.canonicalVersion && backendVersion == t.canonicalVersion {
+			return nil
+		}
+
+		return &apiTranslation{
+			clientVersion:    clientVersion,
+			canonicalVersion: t.canonicalVersion,
+			backendVersion:   backendVersion,
+			backendPath:      fmt.Sprintf("/v%s%s", backendVersion, unversionedPath),
+			requestRules:     r.requestRules,
+			responseRules:    r.responseRules,
+		}
+	}
+
+	return nil
+}
+
+// getBackendVersion returns the configured version, or queries /version of the backend. The concurrent requests
+// share a query, and a failure is returned without querying again until its backoff passes
+func (t *apiTranslator) getBackendVersion(ctx context.Context) (string, error) {
+	for {
+		t.lock.Lock()
+		if len(t.backendVersion) > 0 {
+			t.lock.Unlock()
+			return t.backendVersion, nil
+		}
+		if t.lastErr != nil && time.Now().Before(t.retryAt) {
+			err := t.lastErr
+			t.lock.Unlock()
+			return "", err
+		}
+
+		call := t.fetching
+		if call == nil {
+			call = &versionCall{done: make(chan struct{})}
+			t.fetching = call
+			t.lock.Unlock()
+
+			call.version, call.err = t.fetchBackendVersion(ctx)
+			t.lock.Lock()
+			switch {
+			case call.err == nil:
+				klog.Infof("API version of backend is %s", call.version)
+				t.backendVersion, t.lastErr = call.version, nil
+			case ctx.Err() == nil:
+				// the query canceled with its request is not a failure of the backend
+				t.backoff *= 2
+				if t.backoff < minVersionBackoff {
+					t.backoff = minVersionBackoff
+				} else if t.backoff > maxVersionBackoff {
+					t.backoff = maxVersionBackoff
+				}
+				t.lastErr, t.retryAt = call.err, time.Now().Add(t.backoff)
+			}
+			t.fetching = nil
+			t.lock.Unlock()
+			close(call.done)
+		} else {
+			t.lock.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+
+		if call.err != nil && (call.err == context.Canceled || call.err == context.DeadlineExceeded) &&
+			ctx.Err() == nil {
+			// the query of another request is canceled with it, the version is queried again
+			continue
+		}
+		return call.version, call.err
+	}
+}
+
+func (t *apiTranslator) fetchBackendVersion(ctx context.Context) (string, error) {
+	recorder := httptest.NewRecorder()
+	t.backend.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/version", nil).WithContext(ctx))
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if recorder.Code != http.StatusOK {
+		return "", fmt.Errorf("version status code is %d", recorder.Code)
+	}
+
+	version := struct {
+		APIVersion string `json:"ApiVersion"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &version); err != nil {
+		return "", err
+	}
+
+	if _, _, err := parseAPIVersion(version.APIVersion); err != nil {
+		return "", err
+	}
+
+	return version.APIVersion, nil
+}
+
+// toCanonical converts the request body of the client, or the response body of the backend to the canonical version
+func (at *apiTranslation) toCanonical(body []byte, fromClient bool) ([]byte, error) {
+	if fromClient {
+		return convertAPIVersion(body, at.requestRules, at.clientVersion, at.canonicalVersion)
+	}
+	return convertAPIVersion(body, at.responseRules, at.backendVersion, at.canonicalVersion)
+}
+
+// fromCanonical converts the request body to the backend version, or the response body to the client version
+func (at *apiTranslation) fromCanonical(body []byte, toClient bool) ([]byte, error) {
+	if toClient {
+		return convertAPIVersion(body, at.responseRules, at.canonicalVersion, at.clientVersion)
+	}
+	return convertAPIVersion(body, at.requestRules, at.canonicalVersion, at.backendVersion)
+}
+
+// convertAPIVersion applies the rules between from and to, upgrade rules are applied in ascending order and
+// downgrade rules are applied in descending order. body is returned as it is if no rule changes it
+func convertAPIVersion(body []byte, rules []translationRule, from, to string) ([]byte, error) {
+	cmp := compareAPIVersion(from, to)
+	if cmp == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+
+	low, high := from, to
+	if cmp > 0 {
+		low, high = to, from
+	}
+
+	applied := make([]translationRule, 0, len(rules))
+	for _, r := range rules {
+		if compareAPIVersion(r.version, low) > 0 && compareAPIVersion(r.version, high) <= 0 {
+			applied = append(applied, r)
+		}
+	}
+
+	if len(applied) == 0 {
+		return body, nil
+	}
+
+	sort.SliceStable(applied, func(i, j int) bool {
+		return compareAPIVersion(applied[i].version, applied[j].version) < 0
+	})
+
+	obj := make(map[string]interface{})
+	decoder := gjson.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	if cmp < 0 {
+		for _, r := range applied {
+			if r.upgrade != nil && r.upgrade(obj) {
+				changed = true
+			}
+		}
+	} else {
+		for i := len(applied) - 1; i >= 0; i-- {
+			if applied[i].downgrade != nil && applied[i].downgrade(obj) {
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return body, nil
+	}
+	return encodeJSON(obj)
+}
+
+func childObject(obj map[string]interface{}, key string, create bool) map[string]interface{} {
+	child, ok := obj[key].(map[string]interface{})
+	if !ok && create {
+		child = make(map[string]interface{})
+		obj[key] = child
+	}
+	return child
+}
+
+// downgradeDeviceRequests converts the requests of nvidia GPUs to the nvidia runtime and NVIDIA_VISIBLE_DEVICES which
+// are used before API 1.40, other requests are dropped
+func downgradeDeviceRequests(obj map[string]interface{}) bool {
+	hostConfig := childObject(obj, "HostConfig", false)
+	if _, found := hostConfig["DeviceRequests"]; !found {
+		return false
+	}
+
+	requests, _ := hostConfig["DeviceRequests"].([]interface{})
+	delete(hostConfig, "DeviceRequests")
+
+	for _, r := range requests {
+		req, _ := r.(map[string]interface{})
+		if req == nil || !isGPURequest(req) {
+			klog.Warningf("Drop device request %v which is not supported by backend", r)
+			continue
+		}
+
+		devices := "all"
+		if ids, _ := req["DeviceIDs"].([]interface{}); len(ids) > 0 {
+			strs := make([]string, 0, len(ids))
+			for _, id := range ids {
+				strs = append(strs, fmt.Sprint(id))
+			}
+			devices = strings.Join(strs, ",")
+		}
+
+		if runtime, _ := hostConfig["Runtime"].(string); len(runtime) == 0 {
+			hostConfig["Runtime"] = "nvidia"
+		}
+
+		// the environments are in Config of an inspect body, or at the top level of a create body
+		config := childObject(obj, "Config", false)
+		if config == nil {
+			config = obj
+		}
+		env, _ := config["Env"].([]interface{})
+		config["Env"] = append(env, "NVIDIA_VISIBLE_DEVICES="+devices)
+	}
+
+	return true
+}
+
+func isGPURequest(req map[string]interface{}) bool {
+	if driver, _ := req["Driver"].(string); driver == "nvidia" {
+		return true
+	}
+
+	capabilities, _ := req["Capabilities"].([]interface{})
+	for _, caps := range capabilities {
+		list, _ := caps.([]interface{})
+		for _, c := range list {
+			if c == "gpu" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// upgradeCgroupnsMode keeps the host cgroup namespace which is the default before API 1.41
+func upgradeCgroupnsMode(obj map[string]interface{}) bool {
+	hostConfig := childObject(obj, "HostConfig", true)
+	if mode, _ := hostConfig["CgroupnsMode"].(string); len(mode) > 0 {
+		return false
+	}
+	hostConfig["CgroupnsMode"] = "host"
+	return true
+}
+
+func downgradeCgroupnsMode(obj map[string]interface{}) bool {
+	hostConfig := childObject(obj, "HostConfig", false)
+	if _, found := hostConfig["CgroupnsMode"]; !found {
+		return false
+	}
+	delete(hostConfig, "CgroupnsMode")
+	return true
+}
+
+// macAddressNetwork returns the network whose endpoint holds the MAC address since API 1.44
+func macAddressNetwork(obj map[string]interface{}) string {
+	network := "bridge"
+	if hostConfig := childObject(obj, "HostConfig", false); hostConfig != nil {
+		if mode, _ := hostConfig["NetworkMode"].(string); len(mode) > 0 && mode != "default" {
+			network = mode
+		}
+	}
+	return network
+}
+
+// upgradeMacAddress moves the container MAC address to the endpoint of its network
+func upgradeMacAddress(obj map[string]interface{}) bool {
+	if _, found := obj["MacAddress"]; !found {
+		return false
+	}
+	mac, _ := obj["MacAddress"].(string)
+	delete(obj, "MacAddress")
+	if len(mac) == 0 {
+		return true
+	}
+
+	network := macAddressNetwork(obj)
+	if strings.HasPrefix(network, "container:") {
+		return true
+	}
+
+	endpoints := childObject(childObject(obj, "NetworkingConfig", true), "EndpointsConfig", true)
+	endpoint := childObject(endpoints, network, true)
+	if existed, _ := endpoint["MacAddress"].(string); len(existed) == 0 {
+		endpoint["MacAddress"] = mac
+	}
+	return true
+}
+
+// downgradeMacAddress moves the MAC address of the endpoint back to the container
+func downgradeMacAddress(obj map[string]interface{}) bool {
+	endpoints := childObject(childObject(obj, "NetworkingConfig", false), "EndpointsConfig", false)
+	endpoint := childObject(endpoints, macAddressNetwork(obj), false)
+	if _, found := endpoint["MacAddress"]; !found {
+		return false
+	}
+
+	mac, _ := endpoint["MacAddress"].(string)
+	delete(endpoint, "MacAddress")
+	if existed, _ := obj["MacAddress"].(string); len(mac) > 0 && len(existed) == 0 {
+		obj["MacAddress"] = mac
+	}
+	return true
+}
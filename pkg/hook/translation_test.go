@@ -0,0 +1,280 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/mYmNeo/lighthouse/pkg/apis/componentconfig"
+)
+
+func TestConvertAPIVersion(t *testing.T) {
+	for _, u := range []struct {
+		rules    []translationRule
+		from     string
+		to       string
+		payload  string
+		expected string
+	}{
+		{
+			rules:    createTranslationRules,
+			from:     "1.39",
+			to:       "1.44",
+			payload:  `{"Image":"busybox","MacAddress":"02:42:ac:11:00:02","HostConfig":{"Memory":1024}}`,
+			expected: `{"HostConfig":{"CgroupnsMode":"host","Memory":1024},"Image":"busybox","NetworkingConfig":{"EndpointsConfig":{"bridge":{"MacAddress":"02:42:ac:11:00:02"}}}}`,
+		},
+		{
+			rules: createTranslationRules,
+			from:  "1.44",
+			to:    "1.39",
+			payload: `{"Env":["A=1"],"HostConfig":{"CgroupnsMode":"private","NetworkMode":"net1","DeviceRequests":` +
+				`[{"Count":-1,"Capabilities":[["gpu"]]},{"Driver":"other"}]},` +
+				`"NetworkingConfig":{"EndpointsConfig":{"net1":{"MacAddress":"02:42:ac:11:00:02"}}}}`,
+			expected: `{"Env":["A=1","NVIDIA_VISIBLE_DEVICES=all"],"HostConfig":{"NetworkMode":"net1","Runtime":"nvidia"},"MacAddress":"02:42:ac:11:00:02","NetworkingConfig":{"EndpointsConfig":{"net1":{}}}}`,
+		},
+		{
+			rules:    inspectTranslationRules,
+			from:     "1.44",
+			to:       "1.39",
+			payload:  `{"Config":{"Env":[]},"HostConfig":{"DeviceRequests":[{"Driver":"nvidia","DeviceIDs":["0","1"]}]}}`,
+			expected: `{"Config":{"Env":["NVIDIA_VISIBLE_DEVICES=0,1"]},"HostConfig":{"Runtime":"nvidia"}}`,
+		},
+		{
+			rules:    createTranslationRules,
+			from:     "1.41",
+			to:       "1.43",
+			payload:  `{"MacAddress":"02:42:ac:11:00:02"}`,
+			expected: `{"MacAddress":"02:42:ac:11:00:02"}`,
+		},
+	} {
+		body, err := convertAPIVersion([]byte(u.payload), u.rules, u.from, u.to)
+		if err != nil {
+			t.Errorf("can't convert %s from %s to %s: %v", u.payload, u.from, u.to, err)
+			continue
+		}
+
+		if string(body) != u.expected {
+			t.Errorf("expect %s converted from %s to %s to be %s, got %s", u.payload, u.from, u.to, u.expected,
+				string(body))
+		}
+	}
+}
+
+func TestHookManagerAPITranslation(t *testing.T) {
+	var backendPath, backendBody string
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.Write([]byte(`{"Version":"19.03.15","ApiVersion":"1.40"}`))
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		backendPath, backendBody = r.URL.Path, string(body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc","Warnings":[]}`))
+	})
+
+	var hookBody string
+	hm := NewManager(WithBackend(backend), WithTimeout(10*time.Second))
+
+	translator, err := newAPITranslator("1.44", "", backend)
+	if err != nil {
+		t.Fatalf("can't create translator: %v", err)
+	}
+
+	router := &hookRouter{serveHooks: hm.serveHooks, backend: backend, translator: translator}
+	if err := router.addRoute(componentconfig.HookStage{
+		Method:        http.MethodPost,
+		URLPattern:    "/containers/create",
+		Type:          componentconfig.PreHookType,
+		MinAPIVersion: "1.44",
+	}, &hookHandle{
+		name: "mac",
+		HookHandler: &fakeHookHandler{
+			preHook: func(patch *PatchData, body []byte) error {
+				hookBody = string(body)
+				patch.PatchType = string(types.MergePatchType)
+				patch.PatchData = []byte(`{"HostConfig":{"CgroupnsMode":"private"}}`)
+				return nil
+			},
+		},
+	}); err != nil {
+		t.Fatalf("can't add route: %v", err)
+	}
+
+	ans := httptest.NewRecorder()
+	router.ServeHTTP(ans, httptest.NewRequest(http.MethodPost, "/v1.39/containers/create",
+		bytes.NewBufferString(`{"Image":"busybox","MacAddress":"02:42:ac:11:00:02"}`)))
+
+	if ans.Code != http.StatusCreated {
+		t.Fatalf("expect status code %d to be %d, body %s", ans.Code, http.StatusCreated, ans.Body.String())
+	}
+
+	expected := `{"HostConfig":{"CgroupnsMode":"host"},"Image":"busybox","NetworkingConfig":{"EndpointsConfig":` +
+		`{"bridge":{"MacAddress":"02:42:ac:11:00:02"}}}}`
+	if hookBody != expected {
+		t.Errorf("expect hook body %s to be %s", hookBody, expected)
+	}
+
+	if backendPath != "/v1.40/containers/create" {
+		t.Errorf("expect backend path %s to be %s", backendPath, "/v1.40/containers/create")
+	}
+
+	expected = `{"HostConfig":{},"Image":"busybox","MacAddress":"02:42:ac:11:00:02","NetworkingConfig":` +
+		`{"EndpointsConfig":{"bridge":{}}}}`
+	if backendBody != expected {
+		t.Errorf("expect backend body %s to be %s", backendBody, expected)
+	}
+}
+
+func TestHookManagerAPITranslationEndToEnd(t *testing.T) {
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"Version":"19.03.15","ApiVersion":"1.40"}`))
+		case "/v1.40/containers/create":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"abc","Warnings":[]}`))
+		case "/v1.40/containers/abc/json":
+			w.Write([]byte(`{"Id":"abc","HostConfig":{"Memory":0}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer docker.Close()
+
+	dialer := &net.Dialer{}
+	hm := NewManager(WithBackendTransport(&http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", docker.Listener.Addr().String())
+		},
+	}), WithSystemd(false))
+	if err := hm.InitFromConfig(&componentconfig.HookConfiguration{
+		Timeout:        1,
+		APITranslation: componentconfig.APITranslationConfiguration{Enabled: true, CanonicalAPIVersion: "1.44"},
+	}); err != nil {
+		t.Fatalf("can't init hook manager: %v", err)
+	}
+	if err := hm.RegisterHook(HookRegistration{
+		Name: "label",
+		Handler: &fakeHookHandler{
+			postHook: func(patch *PatchData, body []byte) error {
+				patch.PatchType = string(types.MergePatchType)
+				patch.PatchData = []byte(`{"Config":{"Labels":{"a":"b"}}}`)
+				return nil
+			},
+		},
+		Stages: componentconfig.HookStageList{
+			{Method: http.MethodPost, URLPattern: "/containers/create", Type: componentconfig.PreHookType},
+			{Method: http.MethodGet, URLPattern: "/containers/{name:.*}/json", Type: componentconfig.PostHookType},
+		},
+	}); err != nil {
+		t.Fatalf("can't register hook: %v", err)
+	}
+
+	server := httptest.NewServer(hm)
+	defer server.Close()
+	// a Content-Length larger than the body makes the client wait for the missing bytes
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for _, c := range []struct {
+		method   string
+		path     string
+		body     string
+		expected string
+	}{
+		{http.MethodPost, "/v1.40/containers/create", `{"Image":"busybox"}`, `{"Id":"abc","Warnings":[]}`},
+		{
+			http.MethodGet, "/v1.40/containers/abc/json", "",
+			`{"Config":{"Labels":{"a":"b"}},"HostConfig":{"Memory":0},"Id":"abc"}`,
+		},
+	} {
+		req, _ := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.method, c.path, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("%s %s: can't read body, %v", c.method, c.path, err)
+			continue
+		}
+		if string(body) != c.expected {
+			t.Errorf("%s %s: expect body %s to be %s", c.method, c.path, body, c.expected)
+		}
+	}
+}
+
+func TestAPITranslatorBackendVersion(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	fail := int32(1)
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"Version":"19.03.15","ApiVersion":"1.40"}`))
+	})
+
+	translator, err := newAPITranslator("1.44", "", backend)
+	if err != nil {
+		t.Fatalf("can't create translator: %v", err)
+	}
+
+	// the concurrent requests share a query
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := translator.getBackendVersion(context.Background())
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			t.Errorf("expect the failure of the backend to be returned")
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expect the version to be queried once, got %d", n)
+	}
+
+	// the failure is kept until the backoff passes
+	atomic.StoreInt32(&fail, 0)
+	if _, err := translator.getBackendVersion(context.Background()); err == nil {
+		t.Errorf("expect the failure to be kept during the backoff")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expect the version not to be queried during the backoff, got %d queries", n)
+	}
+
+	translator.lock.Lock()
+	translator.retryAt = time.Now()
+	translator.lock.Unlock()
+	if v, err := translator.getBackendVersion(context.Background()); err != nil || v != "1.40" {
+		t.Errorf("expect the version to be 1.40 after the backoff, got %s, %v", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expect the version to be queried again after the backoff, got %d queries", n)
+	}
+}
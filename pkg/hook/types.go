@@ -3,18 +3,41 @@ package hook
 import (
 	"context"
 	gjson "encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 )
 
 type PatchData struct {
 	PatchType string `json:"patchType,omitempty"`
 	PatchData []byte `json:"patchData,omitempty"`
+	// State is the opaque state attached by a pre hook, it's handed back to the post hook of the same webhook
+	State []byte `json:"state,omitempty"`
+	// Query replaces the query of the request if it's not nil, and Header sets the headers of the request, a header
+	// without values is deleted. Only the pre hooks running in-process can rewrite the request
+	Query  url.Values  `json:"-"`
+	Header http.Header `json:"-"`
 }
 
+// PatchDataV2 is the response of a hook of protocol v2, the patch is a raw JSON value
+type PatchDataV2 struct {
+	PatchType string           `json:"patchType,omitempty"`
+	Patch     gjson.RawMessage `json:"patch,omitempty"`
+	State     []byte           `json:"state,omitempty"`
+}
+
+// PostHookData is the body sent to a post hook of protocol v1
 type PostHookData struct {
 	StatusCode int              `json:"statusCode,omitempty"`
 	Body       gjson.RawMessage `json:"body,omitempty"`
+	UID        string           `json:"uid,omitempty"`
+	// OriginalRequest is the request body sent by the client, and Request is the one patched by the pre hooks. They
+	// are omitted if they are not JSON
+	OriginalRequest gjson.RawMessage `json:"originalRequest,omitempty"`
+	Request         gjson.RawMessage `json:"request,omitempty"`
+	// State is the state attached by the pre hook of the webhook
+	State []byte `json:"state,omitempty"`
 }
 
 type HookHandler interface {
@@ -22,5 +45,15 @@ type HookHandler interface {
 	PostHook(ctx context.Context, patch *PatchData, method, path string, body []byte) error
 }
 
+// DeniedError is returned by a hook rejecting the request, the request fails with 403 whatever the failure policy is
+type DeniedError struct {
+	Hook    string
+	Message string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by %s: %s", e.Hook, e.Message)
+}
+
 type PreHookFunc func(w http.ResponseWriter, r *http.Request) error
 type PostHookFunc func(w *httptest.ResponseRecorder, r *http.Request)
@@ -1,6 +1,8 @@
 package hook
 
 import (
+	"bytes"
+	gjson "encoding/json"
 	"strings"
 
 	jsoniter "github.com/json-iterator/go"
@@ -18,6 +20,39 @@ func HookPath(hookType componentconfig.HookType, path string) string {
 	return strings.ToLower(strings.Join([]string{"/", string(hookType), path}, ""))
 }
 
+// fixUnexpectedEscape unescapes < and > escaped by encoding/json, an escaped backslash followed by u003c is kept
 func fixUnexpectedEscape(d []byte) []byte {
-	return []byte(strings.ReplaceAll(strings.ReplaceAll(string(d), `\u003c`, "<"), `\u003e`, ">"))
+	out := make([]byte, 0, len(d))
+	for i := 0; i < len(d); i++ {
+		if d[i] != '\\' || i+1 >= len(d) {
+			out = append(out, d[i])
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(d[i:], []byte(`\u003c`)):
+			out = append(out, '<')
+			i += 5
+		case bytes.HasPrefix(d[i:], []byte(`\u003e`)):
+			out = append(out, '>')
+			i += 5
+		default:
+			// the escaped character is kept as it is
+			out = append(out, d[i], d[i+1])
+			i++
+		}
+	}
+	return out
+}
+
+// encodeJSON marshals generic maps decoded from payloads, keys are sorted and HTML characters are not escaped
+func encodeJSON(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	encoder := gjson.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
 }
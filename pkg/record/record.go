@@ -0,0 +1,261 @@
+// Package record records the requests passing through lighthouse to fixtures, and replays them
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// maxRecordedBody is the maximum size of a recorded body, streaming responses like logs are truncated
+const maxRecordedBody = 1 << 20
+
+// Exchange is a request sent by a client through lighthouse, with the responses of the backend and lighthouse. A
+// fixture file has an exchange per line in JSON
+type Exchange struct {
+	Method string `json:"method"`
+	// URI is the path and the query of the request
+	URI  string `json:"uri"`
+	Body string `json:"body,omitempty"`
+	// BackendStatusCode and BackendBody are the response of the backend before the post hooks, BackendStatusCode is
+	// 0 if the request is not sent to the backend
+	BackendStatusCode int    `json:"backendStatusCode,omitempty"`
+	BackendBody       string `json:"backendBody,omitempty"`
+	// StatusCode and ResponseBody are the response sent to the client
+	StatusCode   int    `json:"statusCode"`
+	ResponseBody string `json:"responseBody,omitempty"`
+	// Truncated is set if a body is larger than the recorded size
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type exchangeKey struct{}
+
+// Recorder writes the exchanges passing through lighthouse to a fixture. Client wraps the handler serving the
+// clients, and Backend wraps the backend, the responses of the backend are recorded to the exchange of the client
+// request by its context
+type Recorder struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &Recorder{encoder: encoder}
+}
+
+// Client records the requests of the clients and the responses sent to them
+func (rec *Recorder) Client(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ex := &Exchange{
+			Method: r.Method,
+			URI:    r.URL.RequestURI(),
+		}
+
+		// the body is copied while it's read by next, so a large upload is not buffered
+		var tee *teeBody
+		if r.Body != nil && r.Body != http.NoBody {
+			tee = &teeBody{ReadCloser: r.Body}
+			r.Body = tee
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), exchangeKey{}, ex)))
+		// the exchange of a hijacked connection, e.g. attach, is not recorded
+		if rw.hijacked {
+			return
+		}
+
+		if tee != nil {
+			ex.Body, ex.Truncated = tee.recorded()
+		}
+		ex.StatusCode = rw.statusCode
+		ex.ResponseBody = rw.body.String()
+		ex.Truncated = ex.Truncated || rw.truncated
+
+		rec.lock.Lock()
+		defer rec.lock.Unlock()
+		rec.encoder.Encode(ex)
+	})
+}
+
+// Backend records the responses of the backend to the exchanges of the client requests
+func (rec *Recorder) Backend(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ex, ok := r.Context().Value(exchangeKey{}).(*Exchange)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		ex.BackendStatusCode = rw.statusCode
+		ex.BackendBody = rw.body.String()
+		ex.Truncated = ex.Truncated || rw.truncated
+	})
+}
+
+// teeBody copies at most maxRecordedBody bytes of the request body read by the handler, the body which is not read
+// by the handler is not recorded
+type teeBody struct {
+	io.ReadCloser
+	// lock protects the copy, the body may be still read by the transport of the backend after the handler returns
+	lock      sync.Mutex
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (tb *teeBody) Read(p []byte) (int, error) {
+	n, err := tb.ReadCloser.Read(p)
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	if remain := maxRecordedBody - tb.body.Len(); remain < n {
+		tb.body.Write(p[:remain])
+		tb.truncated = true
+	} else {
+		tb.body.Write(p[:n])
+	}
+	return n, err
+}
+
+func (tb *teeBody) recorded() (string, bool) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	return tb.body.String(), tb.truncated
+}
+
+// recordingWriter copies the response written to the ResponseWriter
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	truncated   bool
+	hijacked    bool
+}
+
+func (rw *recordingWriter) WriteHeader(statusCode int) {
+	if !rw.wroteHeader {
+		rw.statusCode, rw.wroteHeader = statusCode, true
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	rw.wroteHeader = true
+	if remain := maxRecordedBody - rw.body.Len(); remain < len(data) {
+		rw.body.Write(data[:remain])
+		rw.truncated = true
+	} else {
+		rw.body.Write(data)
+	}
+	return rw.ResponseWriter.Write(data)
+}
+
+func (rw *recordingWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *recordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer can't be hijacked")
+	}
+	rw.hijacked = true
+	return h.Hijack()
+}
+
+// LoadFixture reads the exchanges of a fixture
+func LoadFixture(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	decoder := json.NewDecoder(r)
+	for {
+		var ex Exchange
+		err := decoder.Decode(&ex)
+		if err == io.EOF {
+			return exchanges, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't decode exchange %d, %v", len(exchanges)+1, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+}
+
+// Replayer is a backend serving the recorded responses of the backend. The exchanges of the same method and URI are
+// replayed in order, and the last one is repeated after all of them are served
+type Replayer struct {
+	lock      sync.Mutex
+	responses map[string][]*Exchange
+}
+
+func NewReplayer(exchanges []Exchange) *Replayer {
+	rp := &Replayer{responses: make(map[string][]*Exchange)}
+	for i := range exchanges {
+		ex := &exchanges[i]
+		if ex.BackendStatusCode == 0 {
+			continue
+		}
+		key := ex.Method + " " + ex.URI
+		rp.responses[key] = append(rp.responses[key], ex)
+	}
+	return rp
+}
+
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + r.URL.RequestURI()
+
+	rp.lock.Lock()
+	responses := rp.responses[key]
+	var ex *Exchange
+	if len(responses) > 0 {
+		ex = responses[0]
+		if len(responses) > 1 {
+			rp.responses[key] = responses[1:]
+		}
+	}
+	rp.lock.Unlock()
+
+	if ex == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("no recorded response of %s", key)})
+		return
+	}
+
+	if json.Valid([]byte(ex.BackendBody)) {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(ex.BackendStatusCode)
+	w.Write([]byte(ex.BackendBody))
+}
+
+// Replay sends the recorded requests of the exchanges to handler in order, and returns the exchanges with the
+// responses of handler. The responses of the backend are recorded too if the backend is wrapped by Recorder.Backend
+func Replay(handler http.Handler, exchanges []Exchange) []Exchange {
+	ret := make([]Exchange, 0, len(exchanges))
+	for _, ex := range exchanges {
+		req := httptest.NewRequest(ex.Method, ex.URI, bytes.NewBufferString(ex.Body))
+		if len(ex.Body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		replayed := Exchange{Method: ex.Method, URI: ex.URI, Body: ex.Body}
+		ans := httptest.NewRecorder()
+		handler.ServeHTTP(ans, req.WithContext(context.WithValue(req.Context(), exchangeKey{}, &replayed)))
+		replayed.StatusCode = ans.Code
+		replayed.ResponseBody = ans.Body.String()
+		ret = append(ret, replayed)
+	}
+	return ret
+}
@@ -0,0 +1,39 @@
+package record
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecorderTruncatesLargeBody(t *testing.T) {
+	fixture := &bytes.Buffer{}
+	recorder := NewRecorder(fixture)
+
+	var read int
+	handler := recorder.Client(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("can't read body: %v", err)
+		}
+		read = len(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	body := strings.Repeat("a", maxRecordedBody+10)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(body)))
+	if read != len(body) {
+		t.Errorf("expect handler to read %d bytes, got %d", len(body), read)
+	}
+
+	exchanges, err := LoadFixture(fixture)
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("expect an exchange, got %v, %v", exchanges, err)
+	}
+	if len(exchanges[0].Body) != maxRecordedBody || !exchanges[0].Truncated {
+		t.Errorf("expect body of %d bytes to be truncated to %d", len(exchanges[0].Body), maxRecordedBody)
+	}
+}
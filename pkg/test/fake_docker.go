@@ -0,0 +1,520 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// FakeDockerVersion is the version reported by /version of FakeDocker
+	FakeDockerVersion = "19.03.15"
+	// FakeDockerAPIVersion is the API version of FakeDocker
+	FakeDockerAPIVersion = "1.40"
+	// FakeDockerDefaultRuntime is the default runtime reported by /info of FakeDocker
+	FakeDockerDefaultRuntime = "runc"
+)
+
+var versionedPathRegexp = regexp.MustCompile(`^/v[0-9]+\.[0-9]+(/.*)$`)
+
+// FakeContainer is a container created in FakeDocker
+type FakeContainer struct {
+	ID      string
+	Name    string
+	Created time.Time
+	// Config is the body of the create request without HostConfig and NetworkingConfig
+	Config     map[string]interface{}
+	HostConfig map[string]interface{}
+	Running    bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// FakeImage is an image pulled or tagged in FakeDocker
+type FakeImage struct {
+	ID string
+	// References are the name:tag or name@digest the image is pulled or tagged with, as they are given
+	References []string
+}
+
+// FakeDocker is an in-memory Docker Engine implementing the container lifecycle used by kubelet: create, start,
+// stop, inspect, list and remove, together with /_ping and /version. Requests with a version prefix are served as
+// the unversioned ones. /info reports the runtimes set by SetRuntimes. Images are pulled, tagged and inspected by
+// their references without contacting a registry
+type FakeDocker struct {
+	*UnixSocketServer
+	router *mux.Router
+
+	lock       sync.Mutex
+	containers []*FakeContainer
+	images     []*FakeImage
+	runtimes   []string
+}
+
+// NewFakeDocker returns a FakeDocker serving on an abstract unix socket after Start
+func NewFakeDocker() *FakeDocker {
+	fd := &FakeDocker{
+		UnixSocketServer: NewUnixSocketServer(),
+		router:           mux.NewRouter(),
+		runtimes:         []string{FakeDockerDefaultRuntime},
+	}
+
+	fd.router.HandleFunc("/_ping", fd.ping).Methods(http.MethodGet, http.MethodHead)
+	fd.router.HandleFunc("/version", fd.version).Methods(http.MethodGet)
+	fd.router.HandleFunc("/info", fd.info).Methods(http.MethodGet)
+	fd.router.HandleFunc("/containers/create", fd.create).Methods(http.MethodPost)
+	fd.router.HandleFunc("/containers/json", fd.list).Methods(http.MethodGet)
+	fd.router.HandleFunc("/containers/{id}/json", fd.inspect).Methods(http.MethodGet)
+	fd.router.HandleFunc("/containers/{id}/start", fd.start).Methods(http.MethodPost)
+	fd.router.HandleFunc("/containers/{id}/stop", fd.stop).Methods(http.MethodPost)
+	fd.router.HandleFunc("/containers/{id}", fd.remove).Methods(http.MethodDelete)
+	fd.router.HandleFunc("/images/create", fd.pull).Methods(http.MethodPost)
+	fd.router.HandleFunc("/images/{name:.+}/tag", fd.tag).Methods(http.MethodPost)
+	fd.router.HandleFunc("/images/{name:.+}/json", fd.inspectImage).Methods(http.MethodGet)
+	fd.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "page not found")
+	})
+	fd.RegisterHandler("/", fd.ServeHTTP)
+
+	return fd
+}
+
+func (fd *FakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Api-Version", FakeDockerAPIVersion)
+
+	if m := versionedPathRegexp.FindStringSubmatch(r.URL.Path); m != nil {
+		u := *r.URL
+		u.Path, u.RawPath = m[1], ""
+		req := new(http.Request)
+		*req = *r
+		req.URL = &u
+		r = req
+	}
+
+	fd.router.ServeHTTP(w, r)
+}
+
+// Containers returns a copy of the containers in the order of creation
+func (fd *FakeDocker) Containers() []FakeContainer {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	ret := make([]FakeContainer, 0, len(fd.containers))
+	for _, c := range fd.containers {
+		ret = append(ret, *c)
+	}
+	return ret
+}
+
+// Images returns a copy of the images in the order of pulling
+func (fd *FakeDocker) Images() []FakeImage {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	ret := make([]FakeImage, 0, len(fd.images))
+	for _, img := range fd.images {
+		ret = append(ret, FakeImage{ID: img.ID, References: append([]string(nil), img.References...)})
+	}
+	return ret
+}
+
+// SetRuntimes sets the runtimes installed besides the default one
+func (fd *FakeDocker) SetRuntimes(runtimes ...string) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	fd.runtimes = append([]string{FakeDockerDefaultRuntime}, runtimes...)
+}
+
+func (fd *FakeDocker) ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+func (fd *FakeDocker) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Version":       FakeDockerVersion,
+		"ApiVersion":    FakeDockerAPIVersion,
+		"MinAPIVersion": "1.12",
+		"Os":            "linux",
+		"Arch":          "amd64",
+	})
+}
+
+func (fd *FakeDocker) info(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	runtimes := make(map[string]interface{}, len(fd.runtimes))
+	for _, name := range fd.runtimes {
+		runtimes[name] = map[string]string{"path": name}
+	}
+	containers := len(fd.containers)
+	fd.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Containers":      containers,
+		"ServerVersion":   FakeDockerVersion,
+		"OperatingSystem": "linux",
+		"DefaultRuntime":  FakeDockerDefaultRuntime,
+		"Runtimes":        runtimes,
+	})
+}
+
+func (fd *FakeDocker) create(w http.ResponseWriter, r *http.Request) {
+	config := make(map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid create body, %v", err))
+		return
+	}
+
+	if image, _ := config["Image"].(string); len(image) == 0 {
+		writeError(w, http.StatusBadRequest, "no image")
+		return
+	}
+
+	hostConfig, _ := config["HostConfig"].(map[string]interface{})
+	delete(config, "HostConfig")
+	delete(config, "NetworkingConfig")
+
+	id := strings.Replace(uuid.New().String()+uuid.New().String(), "-", "", -1)
+	name := strings.TrimPrefix(r.URL.Query().Get("name"), "/")
+	if len(name) == 0 {
+		name = id[:12]
+	}
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	for _, c := range fd.containers {
+		if c.Name == name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("the container name %q is already in use by %s", name,
+				c.ID))
+			return
+		}
+	}
+
+	fd.containers = append(fd.containers, &FakeContainer{
+		ID:         id,
+		Name:       name,
+		Created:    time.Now().UTC(),
+		Config:     config,
+		HostConfig: hostConfig,
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"Id": id, "Warnings": []string{}})
+}
+
+func (fd *FakeDocker) start(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	c := fd.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	if c.Running {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c.Running, c.StartedAt = true, time.Now().UTC()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fd *FakeDocker) stop(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	c := fd.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	if !c.Running {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c.Running, c.FinishedAt = false, time.Now().UTC()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fd *FakeDocker) remove(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	c := fd.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	if c.Running && !queryBool(r, "force") {
+		writeError(w, http.StatusConflict, fmt.Sprintf("you cannot remove a running container %s", c.ID))
+		return
+	}
+
+	for i := range fd.containers {
+		if fd.containers[i] == c {
+			fd.containers = append(fd.containers[:i], fd.containers[i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fd *FakeDocker) inspect(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	c := fd.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	status := containerState(c)
+	pid := 0
+	if c.Running {
+		pid = 1000 + len(c.ID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Id":      c.ID,
+		"Name":    "/" + c.Name,
+		"Created": c.Created.Format(time.RFC3339Nano),
+		"Image":   c.Config["Image"],
+		"State": map[string]interface{}{
+			"Status":     status,
+			"Running":    c.Running,
+			"Pid":        pid,
+			"ExitCode":   0,
+			"StartedAt":  formatTime(c.StartedAt),
+			"FinishedAt": formatTime(c.FinishedAt),
+		},
+		"Config":     c.Config,
+		"HostConfig": c.HostConfig,
+	})
+}
+
+func (fd *FakeDocker) list(w http.ResponseWriter, r *http.Request) {
+	filters := make(map[string]map[string]bool)
+	if f := r.URL.Query().Get("filters"); len(f) > 0 {
+		if err := json.Unmarshal([]byte(f), &filters); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid filters, %v", err))
+			return
+		}
+	}
+
+	all := queryBool(r, "all")
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	ret := make([]map[string]interface{}, 0, len(fd.containers))
+	for i := len(fd.containers) - 1; i >= 0; i-- {
+		c := fd.containers[i]
+		if !all && !c.Running {
+			continue
+		}
+
+		if !matchFilters(c, filters) {
+			continue
+		}
+
+		state := containerState(c)
+		status := map[string]string{"created": "Created", "running": "Up", "exited": "Exited (0)"}[state]
+
+		ret = append(ret, map[string]interface{}{
+			"Id":      c.ID,
+			"Names":   []string{"/" + c.Name},
+			"Image":   c.Config["Image"],
+			"Created": c.Created.Unix(),
+			"Labels":  c.Config["Labels"],
+			"State":   state,
+			"Status":  status,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (fd *FakeDocker) pull(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ref := query.Get("fromImage")
+	if len(ref) == 0 {
+		writeError(w, http.StatusBadRequest, "no image")
+		return
+	}
+	if tag := query.Get("tag"); strings.Contains(tag, ":") {
+		ref += "@" + tag
+	} else if len(tag) > 0 {
+		ref += ":" + tag
+	}
+	ref = withDefaultTag(ref)
+
+	fd.lock.Lock()
+	if fd.lookupImage(ref) == nil {
+		id := "sha256:" + strings.Replace(uuid.New().String()+uuid.New().String(), "-", "", -1)
+		fd.images = append(fd.images, &FakeImage{ID: id, References: []string{ref}})
+	}
+	fd.lock.Unlock()
+
+	// a pull answers 200 with a stream of progress messages
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "Pulling from " + query.Get("fromImage")})
+	json.NewEncoder(w).Encode(map[string]string{"status": "Downloaded newer image for " + ref})
+}
+
+func (fd *FakeDocker) tag(w http.ResponseWriter, r *http.Request) {
+	repo, tag := r.URL.Query().Get("repo"), r.URL.Query().Get("tag")
+	if len(repo) == 0 {
+		writeError(w, http.StatusBadRequest, "no repository")
+		return
+	}
+	if len(tag) == 0 {
+		tag = "latest"
+	}
+
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	img := fd.lookupImage(mux.Vars(r)["name"])
+	if img == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such image: %s", mux.Vars(r)["name"]))
+		return
+	}
+	if ref := repo + ":" + tag; fd.lookupImage(ref) != img {
+		img.References = append(img.References, ref)
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (fd *FakeDocker) inspectImage(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+
+	img := fd.lookupImage(mux.Vars(r)["name"])
+	if img == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No such image: %s", mux.Vars(r)["name"]))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Id": img.ID, "RepoTags": img.References})
+}
+
+// lookupImage finds the image by its ID or a reference, a reference without tag or digest refers to latest
+func (fd *FakeDocker) lookupImage(ref string) *FakeImage {
+	ref = withDefaultTag(ref)
+	for _, img := range fd.images {
+		if img.ID == ref {
+			return img
+		}
+		for _, r := range img.References {
+			if r == ref {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+// withDefaultTag returns ref tagged with latest if it has neither a tag nor a digest
+func withDefaultTag(ref string) string {
+	if strings.Contains(ref, "@") || strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		return ref
+	}
+	return ref + ":latest"
+}
+
+// lookup finds the container by its ID, ID prefix or name, 404 is written if not found
+func (fd *FakeDocker) lookup(w http.ResponseWriter, r *http.Request) *FakeContainer {
+	id := mux.Vars(r)["id"]
+	for _, c := range fd.containers {
+		if c.ID == id || c.Name == strings.TrimPrefix(id, "/") {
+			return c
+		}
+	}
+
+	for _, c := range fd.containers {
+		if strings.HasPrefix(c.ID, id) {
+			return c
+		}
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("No such container: %s", id))
+	return nil
+}
+
+// matchFilters supports the id, name, label and status filters
+func matchFilters(c *FakeContainer, filters map[string]map[string]bool) bool {
+	labels, _ := c.Config["Labels"].(map[string]interface{})
+
+	for kind, values := range filters {
+		matched := false
+		for v := range values {
+			switch kind {
+			case "id":
+				matched = strings.HasPrefix(c.ID, v)
+			case "name":
+				matched = strings.Contains(c.Name, strings.TrimPrefix(v, "/"))
+			case "label":
+				kv := strings.SplitN(v, "=", 2)
+				lv, found := labels[kv[0]]
+				matched = found && (len(kv) == 1 || lv == kv[1])
+			case "status":
+				matched = v == containerState(c)
+			default:
+				matched = true
+			}
+
+			if matched {
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containerState returns created, running or exited
+func containerState(c *FakeContainer) string {
+	switch {
+	case c.Running:
+		return "running"
+	case !c.FinishedAt.IsZero():
+		return "exited"
+	default:
+		return "created"
+	}
+}
+
+func queryBool(r *http.Request, name string) bool {
+	v := r.URL.Query().Get(name)
+	return v == "1" || v == "true" || v == "True"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0001-01-01T00:00:00Z"
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"message": message})
+}
@@ -0,0 +1,319 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	otlpTracesPath     = "/v1/traces"
+	otlpBatchSize      = 512
+	otlpQueueSize      = 4096
+	otlpExportInterval = 5 * time.Second
+	otlpExportTimeout  = 10 * time.Second
+)
+
+// Exporter sends the ended spans out of the process
+type Exporter interface {
+	// Export must not block the caller for long, the spans are exported in the background if it's slow
+	Export(span *Span)
+	Close() error
+}
+
+// spanRecord is a span written by WriterExporter
+type spanRecord struct {
+	TraceID      string            `json:"traceId"`
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Name         string            `json:"name"`
+	Service      string            `json:"service"`
+	Start        time.Time         `json:"start"`
+	Duration     string            `json:"duration"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// WriterExporter writes a span per line in JSON, it's used for stdout and file
+type WriterExporter struct {
+	lock    sync.Mutex
+	service string
+	encoder *json.Encoder
+	// closer is the file opened by NewFileExporter
+	closer io.Closer
+}
+
+func NewWriterExporter(service string, w io.Writer) *WriterExporter {
+	return &WriterExporter{service: service, encoder: json.NewEncoder(w)}
+}
+
+// NewFileExporter returns an exporter appending the spans to the file of path
+func NewFileExporter(service, path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open trace file %s, %v", path, err)
+	}
+
+	e := NewWriterExporter(service, f)
+	e.closer = f
+	return e, nil
+}
+
+func (e *WriterExporter) Export(span *Span) {
+	record := &spanRecord{
+		TraceID:    span.SpanContext.TraceID.String(),
+		SpanID:     span.SpanContext.SpanID.String(),
+		Name:       span.Name,
+		Service:    e.service,
+		Start:      span.Start,
+		Duration:   span.End.Sub(span.Start).String(),
+		Attributes: span.Attributes(),
+		Error:      span.Error,
+	}
+	if span.ParentSpanID.IsValid() {
+		record.ParentSpanID = span.ParentSpanID.String()
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err := e.encoder.Encode(record); err != nil {
+		klog.Warningf("can't write span %s, %v", record.SpanID, err)
+	}
+}
+
+// Close closes the file opened by NewFileExporter
+func (e *WriterExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends the spans to a collector by OTLP/HTTP in JSON. The spans are batched in the background, and
+// dropped if the queue is full
+type OTLPExporter struct {
+	service  string
+	endpoint string
+	client   *http.Client
+	queue    chan *Span
+	stopCh   chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewOTLPExporter returns an exporter sending to endpoint, the path /v1/traces is used if endpoint has no path
+func NewOTLPExporter(service, endpoint string) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpTracesPath
+	}
+
+	e := &OTLPExporter{
+		service:  service,
+		endpoint: u.String(),
+		client:   &http.Client{Timeout: otlpExportTimeout},
+		queue:    make(chan *Span, otlpQueueSize),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+
+	return e, nil
+}
+
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		klog.V(4).Infof("Drop span %s, OTLP queue is full", span.SpanContext.SpanID)
+	}
+}
+
+// Close sends the queued spans and stops the exporter
+func (e *OTLPExporter) Close() error {
+	e.once.Do(func() {
+		close(e.stopCh)
+	})
+	<-e.done
+	return nil
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			klog.Warningf("can't export %d spans to %s, %v", len(batch), e.endpoint, err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			if batch = append(batch, span); len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopCh:
+			for {
+				select {
+				case span := <-e.queue:
+					if batch = append(batch, span); len(batch) >= otlpBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("status code is %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The types below are the OTLP/JSON encoding of ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code"`
+}
+
+// otlpStatusError is STATUS_CODE_ERROR of OTLP
+const otlpStatusError = 2
+
+func (e *OTLPExporter) encode(spans []*Span) *otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/mYmNeo/lighthouse/pkg/trace"}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes()),
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		if len(s.Error) > 0 {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: otlpAttributes(map[string]string{"service.name": e.service})},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ret := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, otlpAttribute{Key: k, Value: otlpValue{StringValue: attributes[k]}})
+	}
+	return ret
+}
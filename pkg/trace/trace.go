@@ -0,0 +1,257 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderTraceParent is the W3C trace context header
+const HeaderTraceParent = "traceparent"
+
+// Kinds of a span, the values are the ones of OTLP
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span propagated to other processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// TraceParent returns the traceparent header of sc
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent parses the traceparent header of version 00, the fields appended by later versions are ignored
+func ParseTraceParent(value string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, fmt.Errorf("invalid trace ID of traceparent %q", value)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, fmt.Errorf("invalid span ID of traceparent %q", value)
+	}
+
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, fmt.Errorf("invalid flags of traceparent %q", value)
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("invalid lowercase hex %q", s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// Span is a timed operation of a trace, it's exported when it ends
+type Span struct {
+	Name         string
+	Kind         int
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	// Error is the error message of a failed span
+	Error string
+
+	lock       sync.Mutex
+	attributes map[string]string
+	tracer     *Tracer
+	ended      bool
+}
+
+// SetAttribute sets an attribute of the span, it's a no-op on a nil span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Error = err.Error()
+}
+
+// Attributes returns a copy of the attributes
+func (s *Span) Attributes() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make(map[string]string, len(s.attributes))
+	for k, v := range s.attributes {
+		ret[k] = v
+	}
+	return ret
+}
+
+// Finish ends the span and exports it if it's sampled, only the first call takes effect
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.lock.Unlock()
+
+	if s.SpanContext.Sampled {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Tracer creates the spans and sends them to its exporter. A nil Tracer creates nil spans, so tracing costs nothing
+// if it's disabled
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start returns a span which is a child of the span in ctx, or the root of a new trace
+func (t *Tracer) Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		attributes: make(map[string]string),
+		tracer:     t,
+	}
+
+	parent := SpanContextFrom(ctx)
+	if parent.IsValid() {
+		span.SpanContext.TraceID = parent.TraceID
+		span.SpanContext.Sampled = parent.Sampled
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.SpanContext.TraceID[:])
+		span.SpanContext.Sampled = true
+	}
+	rand.Read(span.SpanContext.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span.SpanContext), span
+}
+
+// Extract returns a copy of ctx carrying the remote span context of the traceparent header. The invalid header is
+// ignored, so a new trace is started
+func (t *Tracer) Extract(ctx context.Context, header http.Header) context.Context {
+	if t == nil {
+		return ctx
+	}
+
+	value := header.Get(HeaderTraceParent)
+	if len(value) == 0 {
+		return ctx
+	}
+
+	sc, err := ParseTraceParent(value)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// Close flushes and closes the exporter
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.Close()
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc, spans started from it are the children of sc. ctx is
+// returned if sc is invalid
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFrom returns the span context carried by ctx, it's invalid if there is none
+func SpanContextFrom(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Inject sets the traceparent header of the span context carried by ctx
+func Inject(ctx context.Context, header http.Header) {
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		header.Set(HeaderTraceParent, sc.TraceParent())
+	}
+}
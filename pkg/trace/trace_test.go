@@ -0,0 +1,100 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceParent(t *testing.T) {
+	testUnits := []struct {
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true, sampled: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		{value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", valid: true, sampled: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future"},
+		{value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+	}
+
+	for _, u := range testUnits {
+		sc, err := ParseTraceParent(u.value)
+		if (err == nil) != u.valid {
+			t.Errorf("%s: expect valid to be %t, err %v", u.value, u.valid, err)
+			continue
+		}
+		if !u.valid {
+			continue
+		}
+
+		if sc.Sampled != u.sampled {
+			t.Errorf("%s: expect sampled to be %t", u.value, u.sampled)
+		}
+		if u.value[:2] == "00" && sc.TraceParent() != u.value {
+			t.Errorf("expect traceparent %s to be %s", sc.TraceParent(), u.value)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan *otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			t.Errorf("expect path %s to be %s", r.URL.Path, otlpTracesPath)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &otlpRequest{}
+		if err := json.Unmarshal(body, req); err != nil {
+			t.Errorf("can't decode %s, %v", body, err)
+		}
+		requests <- req
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter("lighthouse", server.URL)
+	if err != nil {
+		t.Fatalf("can't create exporter: %v", err)
+	}
+	tracer := NewTracer(exporter)
+
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("can't parse traceparent: %v", err)
+	}
+	ctx, span := tracer.Start(ContextWithSpanContext(context.Background(), parent), "request", SpanKindServer)
+	_, child := tracer.Start(ctx, "hook", SpanKindClient)
+	child.SetAttribute("hook.name", "label")
+	child.Finish()
+	span.Finish()
+
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("can't close tracer: %v", err)
+	}
+
+	req := <-requests
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expect %d spans to be 2", len(spans))
+	}
+
+	if spans[0].Name != "hook" || spans[0].TraceID != parent.TraceID.String() ||
+		spans[0].ParentSpanID != spans[1].SpanID || len(spans[0].Attributes) != 1 ||
+		spans[0].Attributes[0].Value.StringValue != "label" {
+		t.Errorf("unexpected child span %+v", spans[0])
+	}
+	if spans[1].TraceID != parent.TraceID.String() || spans[1].ParentSpanID != parent.SpanID.String() {
+		t.Errorf("unexpected span %+v", spans[1])
+	}
+}